@@ -2,9 +2,7 @@ package gamestrategy
 
 import (
 	"fmt"
-	"log"
 	"math"
-	"math/rand"
 	"sort"
 )
 
@@ -13,6 +11,10 @@ type AI struct {
 	*Grid                                     // The grid that the AI is playing on
 	DesirabilityModifiers map[string]float64  // How much the AI prefers a certain action
 	Opinion               map[*Player]float64 // How much the AI likes or dislikes a player
+	Treaties              map[*Player]int64   // Bitmask of treaties with a player
+	PactExpires           map[*Player]int     // Tick at which a non-aggression pact expires
+	Knowledge             *Knowledge          // What the AI knows about the grid
+	Strategy              Strategy            // Decides which task to perform each tick
 }
 
 func NewAI(p *Player, g *Grid) *AI {
@@ -20,34 +22,85 @@ func NewAI(p *Player, g *Grid) *AI {
 		Player: p,
 		Grid:   g,
 		DesirabilityModifiers: map[string]float64{
-			ActionBuild:   (3 + rand.Float64()) / 3.0, // 1.0 - 1.33
-			ActionExpand:  (3 + rand.Float64()) / 3.0, // 1.0 - 1.33
-			ActionAttack:  (3 + rand.Float64()) / 3.0, // 1.0 - 1.33
-			ActionAbandon: (3 + rand.Float64()) / 3.0, // 1.0 - 1.33
+			ActionBuild:    (3 + g.Rand.Float64()) / 3.0, // 1.0 - 1.33
+			ActionExpand:   (3 + g.Rand.Float64()) / 3.0, // 1.0 - 1.33
+			ActionAttack:   (3 + g.Rand.Float64()) / 3.0, // 1.0 - 1.33
+			ActionAbandon:  (3 + g.Rand.Float64()) / 3.0, // 1.0 - 1.33
+			ActionRecruit:  (3 + g.Rand.Float64()) / 3.0, // 1.0 - 1.33
+			ActionMove:     (3 + g.Rand.Float64()) / 3.0, // 1.0 - 1.33
+			ActionResearch: (3 + g.Rand.Float64()) / 3.0, // 1.0 - 1.33
+			ActionClear:    (3 + g.Rand.Float64()) / 3.0, // 1.0 - 1.33
 		},
-		Opinion: map[*Player]float64{},
+		Opinion:     map[*Player]float64{},
+		Treaties:    map[*Player]int64{},
+		PactExpires: map[*Player]int{},
+		Knowledge:   newKnowledge(len(g.Cells)),
+		Strategy:    GreedyStrategy{},
 	}
 }
 
 const (
-	ActionBuild   = "build"
-	ActionExpand  = "expand"
-	ActionAttack  = "attack"
-	ActionAbandon = "abandon"
+	ActionBuild    = "build"
+	ActionExpand   = "expand"
+	ActionAttack   = "attack"
+	ActionAbandon  = "abandon"
+	ActionRecruit  = "recruit"
+	ActionMove     = "move"
+	ActionResearch = "research"
+	ActionClear    = "clear"
 )
 
+// Strategy decides which task an AI performs next.
+type Strategy interface {
+	// NextTask returns the next task the AI should perform, or false if the AI
+	// should do nothing.
+	NextTask(a *AI) (Task, bool)
+}
+
+// GreedyStrategy picks the most desirable task that the AI can afford right now.
+type GreedyStrategy struct{}
+
+func (GreedyStrategy) NextTask(a *AI) (Task, bool) {
+	// Pick the first one we can afford.
+	for _, ac := range a.possibleTasks() {
+		// Check if we can afford this action
+		if ac.Cost() <= a.Gold {
+			return ac, true
+		}
+	}
+	return Task{}, false
+}
+
+// IdleStrategy never does anything.
+type IdleStrategy struct{}
+
+func (IdleStrategy) NextTask(a *AI) (Task, bool) {
+	return Task{}, false
+}
+
 func (a *AI) Act() {
+	// Take care of diplomacy first.
+	a.diplomacy()
+
+	if t, ok := a.Strategy.NextTask(a); ok {
+		a.Do(t)
+	}
+}
+
+// possibleTasks returns all tasks that the AI considers, sorted by desirability.
+func (a *AI) possibleTasks() []Task {
 	// TODO:
 	// - Separate short term and long term desirability.
 	// - Short term desirability is based on the current state of the game.
 	// - Long term desirability is based on the current and future state of the game (maximize future yield).
 	// - Weight these depending on how financially stable (or savvy) the AI is, and how impulsive it is.
+	// NOTE: The MCTSStrategy takes care of long term desirability by simulating the future.
 
 	// Calculate current balance per tick.
 	var currentBalance float64
 	for _, c := range a.Cells {
 		if c.ControlledBy == a.Player {
-			currentBalance += c.Yield() - c.Cost()
+			currentBalance += c.Yield() - c.Cost() - c.Upkeep()
 		}
 	}
 
@@ -59,10 +112,10 @@ func (a *AI) Act() {
 
 		// Use a queue to do a breadth-first search
 		queue := make([]*Cell, 0, 1000)
-		// Start with all cells that the player owns
+		// Start with all cells that we know the player owns
 		for i := range a.Cells {
 			c := &a.Cells[i]
-			if c.ControlledBy == p {
+			if m := a.Known(c); m.Seen && m.ControlledBy == p {
 				queue = append(queue, c)
 				distToPlayer[i] = 0
 			}
@@ -82,11 +135,17 @@ func (a *AI) Act() {
 				queuePos = 0
 			}
 
-			for _, n := range a.CellNeighbors(c.X, c.Y) {
+			// NOTE: We don't use CellNeighbors here to avoid allocations, since
+			// this is called a lot (especially when simulating games).
+			for _, d := range Directions {
+				n := a.Cell(c.X+d.X, c.Y+d.Y)
+				if n == nil {
+					continue
+				}
 				cellID := n.Y*a.Width + n.X
 				if distToPlayer[cellID] == -1 {
 					queue = append(queue, n)
-					distToPlayer[cellID] = distToPlayer[cellID] + 1
+					distToPlayer[cellID] = distToPlayer[c.Y*a.Width+c.X] + 1
 				}
 			}
 		}
@@ -94,7 +153,7 @@ func (a *AI) Act() {
 		return distToPlayer
 	}
 
-	log.Printf("AI %s acts", a.Name)
+	a.logf("AI %s acts", a.Name)
 
 	// Calculate the distance to all players.
 	distToPlayers := make([][]float64, len(a.Players))
@@ -102,12 +161,10 @@ func (a *AI) Act() {
 		distToPlayers[i] = calcDistancesToPlayer(p)
 	}
 
-	// Look at all cells that we own and decide what to do
-	var possibleActions []Task
+	// Calculate the proximity value to the nearest hostile player for each cell.
+	// TODO: Also calculate the proximity value to the nearest friendly player.
+	proximityToHostiles := make([]float64, len(a.Cells))
 	for i := range a.Cells {
-		c := &a.Cells[i]
-		// Calculate the proximity value to the nearest hostile player.
-		// TODO: Also calculate the proximity value to the nearest friendly player.
 		var proximityToHostile float64
 		for j, p := range a.Players {
 			if p == a.Player {
@@ -132,6 +189,14 @@ func (a *AI) Act() {
 				proximityToHostile = max(proxVal, proximityToHostile-a.Opinion[p])
 			}
 		}
+		proximityToHostiles[i] = proximityToHostile
+	}
+
+	// Look at all cells that we own and decide what to do
+	var possibleActions []Task
+	for i := range a.Cells {
+		c := &a.Cells[i]
+		proximityToHostile := proximityToHostiles[i]
 
 		// Check if we own this cell.
 		if c.ControlledBy == a.Player {
@@ -144,8 +209,8 @@ func (a *AI) Act() {
 					At:      c,
 					Payload: TaskAbandon{},
 				}
-				// We lose the yield, but also the cost of maintaining the cell.
-				futureSavings := c.Cost() - c.Yield()
+				// We lose the yield, but also the cost of maintaining the cell and its troops.
+				futureSavings := c.Cost() + c.Upkeep() - c.Yield()
 				if futureSavings <= 0.0 {
 					continue
 				}
@@ -159,6 +224,9 @@ func (a *AI) Act() {
 				// Subtract the current yield so we can calculate the future yield after building.
 				currentBalanceExcl := currentBalance - c.Yield()
 				for _, f := range splitFeatures(c.AllowedFeatures &^ c.Features) {
+					if !c.CanBuild(f) {
+						continue // We lack the technology.
+					}
 					// Build: Attempt to build a feature here
 					// TODO:
 					// - Also determine the one-time cost of building here.
@@ -182,13 +250,79 @@ func (a *AI) Act() {
 					}
 					balanceDiff := futureBalance - currentBalance
 
-					t.Desirability = a.DesirabilityModifiers[ActionBuild] * (balanceDiff - proximityToHostile)
+					if f == FeatureFort {
+						// Fortifications don't yield anything, but the closer we are to
+						// a hostile player, the more desirable they become.
+						t.Desirability = a.DesirabilityModifiers[ActionBuild] * proximityToHostile
+						if t.Desirability <= 0.0 {
+							continue
+						}
+					} else {
+						t.Desirability = a.DesirabilityModifiers[ActionBuild] * (balanceDiff - proximityToHostile)
+					}
 
 					// We can build here
 					possibleActions = append(possibleActions, t)
 				}
 			}
 
+			// Check if we should clear the forest to make room for farms and settlements.
+			if c.CanClear() && c.Features&FeatureLumber == 0 {
+				t := Task{
+					Action:  ActionClear,
+					At:      c,
+					Payload: TaskClear{},
+				}
+				// We save on the cost of the cell and gain potential yield.
+				gain := c.Cost() - TypeMeadow.Cost + resourceYield(TypeMeadow.AllowedFeatures) - resourceYield(c.AllowedFeatures)
+				if gain > 0.0 && a.Gold >= t.Cost() {
+					t.Desirability = a.DesirabilityModifiers[ActionClear] * gain
+					possibleActions = append(possibleActions, t)
+				}
+			}
+
+			// Check if we can raise troops here.
+			// Recruiting is more desirable the closer we are to a hostile player.
+			if c.CanRecruit() && proximityToHostile > 0.0 {
+				t := Task{
+					Action: ActionRecruit,
+					At:     c,
+					Payload: TaskRecruit{
+						Amount: RecruitBatch,
+					},
+				}
+
+				// Subtract the upkeep of the new troops.
+				futureBalance := currentBalance - RecruitBatch*UnitUpkeep
+				if futureBalance > 0.0 && a.Gold >= t.Cost() {
+					t.Desirability = a.DesirabilityModifiers[ActionRecruit] * proximityToHostile
+					possibleActions = append(possibleActions, t)
+				}
+			}
+
+			// Check if we should move troops closer to a hostile player.
+			if c.Troops > 0.0 {
+				for _, n := range a.CellNeighbors(c.X, c.Y) {
+					if n.ControlledBy != a.Player {
+						continue
+					}
+					proxDiff := proximityToHostiles[n.Y*a.Width+n.X] - proximityToHostile
+					if proxDiff <= 0.0 {
+						continue
+					}
+					t := Task{
+						Action:       ActionMove,
+						At:           n,
+						Desirability: a.DesirabilityModifiers[ActionMove] * proxDiff,
+						Payload: TaskMove{
+							From:   c,
+							Amount: c.Troops,
+						},
+					}
+					possibleActions = append(possibleActions, t)
+				}
+			}
+
 			// Check if we can expand anywhere around us.
 			//
 			// TODO:
@@ -243,7 +377,7 @@ func (a *AI) Act() {
 
 					// We can expand here
 					possibleActions = append(possibleActions, t)
-				} else {
+				} else if c.Troops > 0.0 && !a.HasTreaty(n.ControlledBy, TreatyPact|TreatyAlliance) {
 					// Attack: Attempt to take over this cell
 					// TODO:
 					// - Also determine the one-time cost of attacking here. (possible gain vs possible loss)
@@ -266,7 +400,16 @@ func (a *AI) Act() {
 					}
 					balanceDiff := futureBalance - currentBalance
 
-					t.Desirability = a.DesirabilityModifiers[ActionAttack] * (balanceDiff + ownershipFactor + proximityToHostile)
+					// Estimate our chances of winning based on what we know about the defenders.
+					attMod, defMod := a.combatModifiers(c, n)
+					chance := winChance(c.Troops*attMod, max(a.Known(n).Troops, MilitiaStrength)*defMod)
+
+					t.Desirability = a.DesirabilityModifiers[ActionAttack] * (balanceDiff + ownershipFactor + proximityToHostile) * chance
+
+					// If we are already at war, attacking is more desirable.
+					if a.HasTreaty(n.ControlledBy, TreatyWar) {
+						t.Desirability *= 1.5
+					}
 
 					// We can attack here
 					possibleActions = append(possibleActions, t)
@@ -275,8 +418,11 @@ func (a *AI) Act() {
 		}
 	}
 
+	// Consider investing in research.
+	possibleActions = append(possibleActions, a.researchTasks(proximityToHostiles)...)
+
 	// Randomize the order of possible actions to avoid artifacts.
-	rand.Shuffle(len(possibleActions), func(i, j int) {
+	a.Rand.Shuffle(len(possibleActions), func(i, j int) {
 		possibleActions[i], possibleActions[j] = possibleActions[j], possibleActions[i]
 	})
 
@@ -295,21 +441,14 @@ func (a *AI) Act() {
 	doLog := false
 	if doLog {
 		for _, ac := range possibleActions {
-			log.Printf("AI %s possible action %s on %d,%d for %f (%f)", a.Name, ac.Action, ac.At.X, ac.At.Y, ac.Cost(), ac.Desirability)
-		}
-	}
-
-	// Pick the first one we can afford.
-	for _, ac := range possibleActions {
-		// Check if we can afford this action
-		if ac.Cost() <= a.Gold {
-			a.Do(ac)
-			return
+			a.logf("AI %s possible action %s on %d,%d for %f (%f)", a.Name, ac.Action, ac.At.X, ac.At.Y, ac.Cost(), ac.Desirability)
 		}
 	}
+	return possibleActions
 }
 
 func (a *AI) Do(t Task) {
+	a.Events.task(a, t)
 	switch t.Action {
 	case ActionBuild:
 		a.Build(t.At, t.Payload.(TaskBuild))
@@ -319,19 +458,27 @@ func (a *AI) Do(t Task) {
 		a.Attack(t.At, t.Payload.(TaskAttack))
 	case ActionAbandon:
 		a.Abandon(t.At, t.Payload.(TaskAbandon))
+	case ActionRecruit:
+		a.Recruit(t.At, t.Payload.(TaskRecruit))
+	case ActionMove:
+		a.Move(t.At, t.Payload.(TaskMove))
+	case ActionResearch:
+		a.Research(t.Payload.(TaskResearch))
+	case ActionClear:
+		a.Clear(t.At, t.Payload.(TaskClear))
 	}
 }
 
 func (a *AI) Build(c *Cell, payload TaskBuild) {
 	f := payload.Feature
-	log.Printf("AI %s builds %d on %d,%d", a.Name, f, c.X, c.Y)
+	a.logf("AI %s builds %d on %d,%d", a.Name, f, c.X, c.Y)
 
-	// Only build features that are allowed and not already built.
+	// Only build features that are allowed, not already built and researched.
 	// NOTE: This should already be ensured by the task generation.
-	if f&c.AllowedFeatures != 0 && f&c.Features == 0 {
+	if c.CanBuild(f) {
 		c.Features |= f
 		cost := c.CostToBuild(f)
-		log.Printf("AI %s builds %d on %d,%d for %f", a.Name, f, c.X, c.Y, cost)
+		a.logf("AI %s builds %d on %d,%d for %f", a.Name, f, c.X, c.Y, cost)
 		a.Gold -= cost
 
 		// Broadcast the build to all players.
@@ -344,9 +491,9 @@ func (a *AI) Build(c *Cell, payload TaskBuild) {
 }
 
 func (a *AI) Expand(c *Cell, payload TaskExpand) {
-	log.Printf("AI %s expands to %d,%d", a.Name, c.X, c.Y)
+	a.logf("AI %s expands to %d,%d", a.Name, c.X, c.Y)
 	cost := c.Cost()
-	log.Printf("AI %s expands to %d,%d for %f", a.Name, c.X, c.Y, cost)
+	a.logf("AI %s expands to %d,%d for %f", a.Name, c.X, c.Y, cost)
 	a.Gold -= cost
 
 	// Update the controlling player of the cell.
@@ -361,43 +508,42 @@ func (a *AI) Expand(c *Cell, payload TaskExpand) {
 }
 
 func (a *AI) Attack(c *Cell, payload TaskAttack) {
-	log.Printf("AI %s attacks %d,%d", a.Name, c.X, c.Y)
+	a.logf("AI %s attacks %d,%d", a.Name, c.X, c.Y)
 	cost := c.Cost() * 2.0
-	log.Printf("AI %s attacks %d,%d for %f", a.Name, c.X, c.Y, cost)
+	a.logf("AI %s attacks %d,%d for %f", a.Name, c.X, c.Y, cost)
 	a.Gold -= cost
 
-	// Check if we won
-	// TODO: This should depend on ...
-	// - how many neighboring cells we own vs. how many the opponent owns
-	// - the number of offensive features that we have, and the number of defensive
-	// features that the opponent has
-
-	// Get the neighbors of the cell that we want to attack.
-	nbs := a.CellNeighbors(c.X, c.Y)
-
-	// Count the number of neighbors that we own vs. the opponent.
-	var numNeighborsOwned, numNeighborsOpponent int
-	for _, nb := range nbs {
-		if nb.ControlledBy == a.Player {
-			numNeighborsOwned++
-		} else if nb.ControlledBy == payload.On {
-			numNeighborsOpponent++
-		}
+	// Attacking a player we are not at war with is a declaration of war.
+	defender := c.ControlledBy
+	if !a.HasTreaty(defender, TreatyWar) {
+		a.DeclareWar(defender)
 	}
 
-	// Ownership factor is the fraction of neighbors that we own vs. the opponent.
-	ownershipFactor := float64(numNeighborsOwned) / float64(numNeighborsOpponent+1)
+	// Resolve the combat between our troops and the defenders.
+	attMod, defMod := a.combatModifiers(payload.From, c)
+	outcome := resolveCombat(a.Rand, payload.From.Troops, c.DefenderStrength(), attMod, defMod)
+	payload.From.Troops -= outcome.AttackerLosses
+	c.Troops = max(0, c.Troops-outcome.DefenderLosses)
+
+	if outcome.Success {
+		a.logf("AI %s wins against %s: %s", a.Name, defender.Name, outcome)
+		// Surviving defenders retreat to a neighboring cell, if possible.
+		if c.Troops > 0 {
+			for _, nb := range a.CellNeighbors(c.X, c.Y) {
+				if nb.ControlledBy == defender {
+					nb.Troops += c.Troops
+					break
+				}
+			}
+		}
 
-	var success bool
-	if c.ControlledBy.Gold <= 0 || rand.Intn(int(c.ControlledBy.Gold)) < int(a.Gold*ownershipFactor) {
-		log.Printf("AI %s wins against %s", a.Name, c.ControlledBy.Name)
-		// Update the controlling player of the cell.
+		// Update the controlling player of the cell and move half of
+		// our surviving troops in.
 		c.ControlledBy = a.Player
-
-		// We won!
-		success = true
+		c.Troops = payload.From.Troops / 2
+		payload.From.Troops -= c.Troops
 	} else {
-		log.Printf("AI %s loses against %s", a.Name, c.ControlledBy.Name)
+		a.logf("AI %s loses against %s: %s", a.Name, defender.Name, outcome)
 	}
 
 	// TODO: Should our opinion of the attacked player actually change?
@@ -407,16 +553,34 @@ func (a *AI) Attack(c *Cell, payload TaskAttack) {
 	// TODO: Should this be a broadcast so allies can help?
 	a.Messenger.Send(a.Player.ID, []int{payload.On.ID}, MsgAttack{
 		FromID:  a.Player.ID,
-		ToID:    c.ControlledBy.ID,
-		Success: success,
+		ToID:    defender.ID,
+		AtCell:  c,
+		Success: outcome.Success,
+		Outcome: outcome,
 	})
 }
 
+func (a *AI) Recruit(c *Cell, payload TaskRecruit) {
+	cost := payload.Amount * UnitCost
+	a.logf("AI %s recruits %f troops on %d,%d for %f", a.Name, payload.Amount, c.X, c.Y, cost)
+	a.Gold -= cost
+	c.Troops += payload.Amount
+}
+
+func (a *AI) Move(c *Cell, payload TaskMove) {
+	a.logf("AI %s moves %f troops from %d,%d to %d,%d", a.Name, payload.Amount, payload.From.X, payload.From.Y, c.X, c.Y)
+	amount := min(payload.Amount, payload.From.Troops)
+	a.Gold -= moveCost(c)
+	payload.From.Troops -= amount
+	c.Troops += amount
+}
+
 func (a *AI) Abandon(c *Cell, payload TaskAbandon) {
-	log.Printf("AI %s abandons %d,%d", a.Name, c.X, c.Y)
+	a.logf("AI %s abandons %d,%d", a.Name, c.X, c.Y)
 
-	// Update the controlling player of the cell.
+	// Update the controlling player of the cell and disband the troops.
 	c.ControlledBy = nil
+	c.Troops = 0
 
 	// Broadcast the abandon action to all players.
 	a.Messenger.Broadcast(a.Player.ID, MsgAbandon{
@@ -458,7 +622,13 @@ func (a *AI) Receive(from int, message any) {
 		return nil
 	}
 
-	log.Printf("AI %s received message from %d: %v", a.Name, from, message)
+	a.logf("AI %s received message from %d: %v", a.Name, from, message)
+	if loc, ok := message.(Located); ok {
+		a.observe(loc.Location())
+	}
+	if a.receiveDiplomacy(from, message) {
+		return
+	}
 	switch message.(type) {
 	case MsgBuild:
 		// TODO: If the player builds some offensive feature close to us, we should like them less.
@@ -538,7 +708,7 @@ func (a *AI) Receive(from int, message any) {
 			}
 		*/
 	default:
-		log.Printf("AI %s received unknown message from %s: %v", a.Name, from, message)
+		a.logf("AI %s received unknown message from %d: %v", a.Name, from, message)
 	}
 }
 
@@ -552,11 +722,12 @@ func (a *AI) ChangeOpinion(p *Player, amount float64, action string) {
 		a.Opinion[p] = 1.0
 	}
 
-	log.Printf("AI %s changed opinion of %s by %f (%q), new %f", a.Name, p.Name, amount, action, a.Opinion[p])
+	a.logf("AI %s changed opinion of %s by %f (%q), new %f", a.Name, p.Name, amount, action, a.Opinion[p])
+	a.Events.opinion(a, p, amount, action)
 }
 
 type Task struct {
-	Action       string  // build, expand, attack
+	Action       string  // build, expand, attack, abandon, recruit, move
 	At           *Cell   // In which cell to do the action
 	Desirability float64 // How desirable this action is
 	Payload      any
@@ -578,15 +749,31 @@ type TaskAttack struct {
 type TaskAbandon struct {
 }
 
+type TaskRecruit struct {
+	Amount float64 // Troop strength to raise
+}
+
+type TaskMove struct {
+	From   *Cell   // From which cell to move troops
+	Amount float64 // Troop strength to move
+}
+
+type TaskResearch struct {
+	Tech int64 // Which technology to research
+}
+
+type TaskClear struct {
+}
+
 // HeightDiff returns the height difference between the from and at cells.
 func (t *Task) HeightDiff() float64 {
 	switch t.Action {
 	case ActionExpand:
 		taskExpand := t.Payload.(TaskExpand)
-		return t.At.Value - taskExpand.From.Value
+		return t.At.Elevation - taskExpand.From.Elevation
 	case ActionAttack:
 		taskAttack := t.Payload.(TaskAttack)
-		return t.At.Value - taskAttack.From.Value
+		return t.At.Elevation - taskAttack.From.Elevation
 	}
 	return 0.0
 }
@@ -611,6 +798,16 @@ func (t *Task) Cost() float64 {
 		return t.At.Type.Cost*2.0 + extra
 	case ActionAbandon:
 		return 0
+	case ActionRecruit:
+		taskRecruit := t.Payload.(TaskRecruit)
+		return taskRecruit.Amount * UnitCost
+	case ActionMove:
+		return moveCost(t.At)
+	case ActionResearch:
+		taskResearch := t.Payload.(TaskResearch)
+		return TechByID(taskResearch.Tech).Cost
+	case ActionClear:
+		return t.At.Type.Cost * ClearCost
 	}
 	return 0.0
 }
@@ -3,12 +3,16 @@ package gamestrategy
 import "image/color"
 
 type Cell struct {
-	X     int
-	Y     int
-	Value float64
+	X           int
+	Y           int
+	Elevation   float64 // Elevation in the range [0, 1]
+	Moisture    float64 // Moisture in the range [0, 1]
+	Temperature float64 // Temperature in the range [0, 1]
+	River       bool    // A river flows through this cell
 	*Type
 	ControlledBy *Player
 	Features     int64
+	Troops       float64 // Strength of the troops stationed in this cell
 }
 
 // Cost returns the cost of occupying (or attacking) this cell.
@@ -17,8 +21,17 @@ func (c *Cell) Cost() float64 {
 }
 
 // Yield returns the amount of resources this cell yields.
+// Rivers provide water and trade, so they increase the yield of a cell.
+// Farms yield more if the owner knows irrigation.
 func (c *Cell) Yield() float64 {
-	return resourceYield(c.Features) + c.BaseYield
+	yield := resourceYield(c.Features) + c.BaseYield
+	if c.River {
+		yield += RiverYield
+	}
+	if c.Features&FeatureFarm != 0 && c.ControlledBy != nil && c.ControlledBy.HasTech(TechIrrigation) {
+		yield += IrrigationYield
+	}
+	return yield
 }
 
 // IsOccupied returns true if the cell is occupied by a player.
@@ -37,11 +50,12 @@ func (c *Cell) Occupy(p *Player) bool {
 // Type represents the type of a cell.
 // The type determines the cost of occupying the cell and the base yield, as well as the features
 // that can be built on the cell.
-// TODO: Add offensive and defensive modifiers and features.
+// The defense modifier is applied to the strength of troops defending the cell.
 type Type struct {
-	Name            string  // Water, Meadow, Forest, Mountain, Desert...
+	Name            string  // Water, Coast, Meadow, Forest, Mountain, Desert...
 	Cost            float64 // Occupation cost and multiplier for actions
 	BaseYield       float64 // Base yield for the cell
+	Defense         float64 // Defense multiplier for troops defending the cell
 	AllowedFeatures int64   // Bitmask of allowed features
 	Color           color.Color
 }
@@ -51,6 +65,7 @@ var (
 		Name:      "Capital",
 		Cost:      0.0,
 		BaseYield: 10.0,
+		Defense:   2.0,
 		Color: color.RGBA{
 			R: 0xff,
 			G: 0xff,
@@ -59,8 +74,9 @@ var (
 		},
 	}
 	TypeWater = Type{
-		Name: "Water",
-		Cost: 5.0,
+		Name:    "Water",
+		Cost:    5.0,
+		Defense: 1.0,
 		Color: color.RGBA{
 			R: 0x00,
 			G: 0x00,
@@ -71,7 +87,8 @@ var (
 	TypeMeadow = Type{
 		Name:            "Meadow",
 		Cost:            1.0,
-		AllowedFeatures: FeatureFarm | FeatureSettlement,
+		Defense:         1.0,
+		AllowedFeatures: FeatureFarm | FeatureSettlement | FeatureFort,
 		Color: color.RGBA{
 			R: 0x00,
 			G: 0xff,
@@ -82,7 +99,8 @@ var (
 	TypeForest = Type{
 		Name:            "Forest",
 		Cost:            2.0,
-		AllowedFeatures: FeatureLumber,
+		Defense:         1.25,
+		AllowedFeatures: FeatureLumber | FeatureFort,
 		Color: color.RGBA{
 			R: 0x00,
 			G: 0x80,
@@ -93,7 +111,8 @@ var (
 	TypeMountain = Type{
 		Name:            "Mountain",
 		Cost:            3.0,
-		AllowedFeatures: FeatureQuarry | FeatureMine | FeatureSettlement,
+		Defense:         1.5,
+		AllowedFeatures: FeatureQuarry | FeatureMine | FeatureSettlement | FeatureFort,
 		Color: color.RGBA{
 			R: 0x80,
 			G: 0x80,
@@ -101,9 +120,23 @@ var (
 			A: 0xff,
 		},
 	}
+	TypeCoast = Type{
+		Name:            "Coast",
+		Cost:            1.5,
+		BaseYield:       1.0, // Fishing
+		Defense:         0.9,
+		AllowedFeatures: FeatureFarm | FeatureSettlement | FeatureFort,
+		Color: color.RGBA{
+			R: 0xee,
+			G: 0xdd,
+			B: 0x99,
+			A: 0xff,
+		},
+	}
 	TypeDesert = Type{
-		Name: "Desert",
-		Cost: 4.0,
+		Name:    "Desert",
+		Cost:    4.0,
+		Defense: 0.9,
 		Color: color.RGBA{
 			R: 0xff,
 			G: 0xff,
@@ -120,6 +153,7 @@ const (
 	FeatureQuarry
 	FeatureMine
 	FeatureSettlement
+	FeatureFort
 )
 
 func resourceYield(f int64) float64 {
@@ -155,6 +189,8 @@ func costToBuild(f int64) float64 {
 		cost = 4.0
 	case FeatureSettlement:
 		cost = 10.0
+	case FeatureFort:
+		cost = 8.0
 	}
 	return cost
 }
@@ -180,6 +216,28 @@ func splitFeatures(f int64) []int64 {
 	if f&FeatureSettlement != 0 {
 		features = append(features, FeatureSettlement)
 	}
+	if f&FeatureFort != 0 {
+		features = append(features, FeatureFort)
+	}
 
 	return features
 }
+
+// FeatureName returns the name of the given feature.
+func FeatureName(f int64) string {
+	switch f {
+	case FeatureFarm:
+		return "farm"
+	case FeatureLumber:
+		return "lumber"
+	case FeatureQuarry:
+		return "quarry"
+	case FeatureMine:
+		return "mine"
+	case FeatureSettlement:
+		return "settlement"
+	case FeatureFort:
+		return "fort"
+	}
+	return "none"
+}
@@ -0,0 +1,145 @@
+package gamestrategy
+
+import "math/rand"
+
+// Clone returns a deep copy of the grid including all players and AIs.
+// The clone has its own messenger and doesn't record any WebP frames.
+func (g *Grid) Clone() *Grid {
+	c := &Grid{
+		Width:     g.Width,
+		Height:    g.Height,
+		Ticks:     g.Ticks,
+		Silent:    g.Silent,
+		Rand:      rand.New(rand.NewSource(g.Rand.Int63())),
+		Messenger: NewMessenger(),
+	}
+
+	// Copy the players and remember which copy belongs to which original.
+	players := make(map[*Player]*Player, len(g.Players))
+	for _, p := range g.Players {
+		np := *p
+		c.Players = append(c.Players, &np)
+		players[p] = &np
+	}
+
+	// Copy the cells.
+	c.Cells = make([]Cell, len(g.Cells))
+	copy(c.Cells, g.Cells)
+	for i := range c.Cells {
+		if owner := c.Cells[i].ControlledBy; owner != nil {
+			c.Cells[i].ControlledBy = players[owner]
+		}
+	}
+
+	// Copy the AIs and register them with the new messenger.
+	for _, ai := range g.AIs {
+		nai := ai.clone(c, players)
+		c.AIs = append(c.AIs, nai)
+		if nai.Player.Human {
+			c.Human = NewHuman(nai)
+			c.Messenger.Register(nai.Player.ID, c.Human)
+		} else {
+			c.Messenger.Register(nai.Player.ID, nai)
+		}
+	}
+	return c
+}
+
+// clone returns a copy of the AI that plays on the given grid.
+// 'players' maps the original players to their copies.
+func (a *AI) clone(g *Grid, players map[*Player]*Player) *AI {
+	na := &AI{
+		Player:                players[a.Player],
+		Grid:                  g,
+		DesirabilityModifiers: make(map[string]float64, len(a.DesirabilityModifiers)),
+		Opinion:               make(map[*Player]float64, len(a.Opinion)),
+		Treaties:              make(map[*Player]int64, len(a.Treaties)),
+		PactExpires:           make(map[*Player]int, len(a.PactExpires)),
+		Knowledge:             newKnowledge(len(g.Cells)),
+		Strategy:              a.Strategy,
+	}
+	for k, v := range a.DesirabilityModifiers {
+		na.DesirabilityModifiers[k] = v
+	}
+	for p, v := range a.Opinion {
+		na.Opinion[players[p]] = v
+	}
+	for p, v := range a.Treaties {
+		na.Treaties[players[p]] = v
+	}
+	for p, v := range a.PactExpires {
+		na.PactExpires[players[p]] = v
+	}
+	copy(na.Knowledge.Visible, a.Knowledge.Visible)
+	copy(na.Knowledge.Memory, a.Knowledge.Memory)
+	for i, m := range na.Knowledge.Memory {
+		if m.ControlledBy != nil {
+			na.Knowledge.Memory[i].ControlledBy = players[m.ControlledBy]
+		}
+	}
+	return na
+}
+
+// CloneAsSeenBy returns a copy of the grid as the given AI knows it, so that
+// simulations can't peek through the fog of war.
+// Cells the AI can't see hold what it remembers of them, and cells it has
+// never seen hold nothing but their natural terrain (and the militia that
+// defends every cell). The gold of the other players is estimated from the
+// size of their territory compared to ours, and we assume that they have
+// researched what we have. The other AIs only know what they can see on the
+// copy.
+func (g *Grid) CloneAsSeenBy(a *AI) *Grid {
+	c := g.Clone()
+	var me *AI
+	for i, ai := range g.AIs {
+		if ai == a {
+			me = c.AIs[i]
+			break
+		}
+	}
+	if me == nil {
+		return c
+	}
+
+	// Replace what we can't see with what we remember.
+	k := me.Knowledge
+	cells := make(map[*Player]int)
+	for i := range c.Cells {
+		cell := &c.Cells[i]
+		if !k.Visible[i] {
+			if m := k.Memory[i]; m.Seen {
+				cell.Type = m.Type
+				cell.ControlledBy = m.ControlledBy
+				cell.Features = m.Features
+				cell.Troops = m.Troops
+			} else {
+				cell.Type = c.terrainType(cell)
+				cell.ControlledBy = nil
+				cell.Features = 0
+				cell.Troops = 0
+			}
+		}
+		if cell.ControlledBy != nil {
+			cells[cell.ControlledBy]++
+		}
+	}
+
+	// Estimate what we don't know about the other players.
+	for _, p := range c.Players {
+		if p == me.Player {
+			continue
+		}
+		p.Gold = 0
+		if cells[me.Player] > 0 {
+			p.Gold = me.Gold * float64(cells[p]) / float64(cells[me.Player])
+		}
+		p.Techs = me.Player.Techs
+	}
+	for _, ai := range c.AIs {
+		if ai != me {
+			ai.Knowledge = newKnowledge(len(c.Cells))
+			ai.UpdateKnowledge()
+		}
+	}
+	return c
+}
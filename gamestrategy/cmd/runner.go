@@ -1,17 +1,97 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"log"
+	"os"
 
 	"github.com/Flokey82/genideas/gamestrategy"
+	"github.com/hajimehoshi/ebiten"
+)
+
+var (
+	play = flag.Bool("play", false, "play against the AIs instead of watching them")
+	mcts = flag.Bool("mcts", false, "let the first AI use Monte Carlo tree search")
+	tour = flag.Int("tournament", 0, "play the given number of games between the default AI profiles")
+	load = flag.String("load", "", "resume the game saved in the given file")
+	save = flag.String("save", "", "save the game to the given file when done")
+	logf = flag.String("events", "", "record all events to the given file as JSON lines")
+	view = flag.String("replay", "", "step through the events recorded in the given file")
 )
 
 func main() {
+	flag.Parse()
+	if *tour > 0 {
+		cfg := gamestrategy.DefaultTournamentConfig()
+		cfg.Games = *tour
+		res := gamestrategy.RunTournament(cfg, gamestrategy.DefaultProfiles)
+		res.WriteReport(os.Stdout)
+		f, err := os.Create("tournament.csv")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if err := res.WriteCurvesCSV(f); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *view != "" {
+		r, err := gamestrategy.LoadReplayFile(*view)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ebiten.SetWindowSize(gamestrategy.ScreenWidth, gamestrategy.ScreenHeight)
+		ebiten.SetWindowTitle("gamestrategy replay")
+		if err := ebiten.RunGame(gamestrategy.NewReplayViewer(r)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *play {
+		ebiten.SetWindowSize(gamestrategy.ScreenWidth, gamestrategy.ScreenHeight)
+		ebiten.SetWindowTitle("gamestrategy")
+		var g *gamestrategy.Game
+		if *load != "" {
+			grid, err := gamestrategy.LoadFile(*load)
+			if err != nil {
+				log.Fatal(err)
+			}
+			g = gamestrategy.NewGameFromGrid(grid)
+		} else {
+			g = gamestrategy.NewGame(100, 100, 3, "You")
+		}
+		defer recordEvents(g.Grid)()
+		if err := ebiten.RunGame(g); err != nil {
+			log.Fatal(err)
+		}
+		if *save != "" {
+			if err := g.SaveFile(*save); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+
 	fmt.Println("Hello world!")
-	g := gamestrategy.NewGrid(100, 100)
-	g.AddPlayer(gamestrategy.NewPlayer("Player 1"))
-	g.AddPlayer(gamestrategy.NewPlayer("Player 2"))
-	g.AddPlayer(gamestrategy.NewPlayer("Player 3"))
+	var g *gamestrategy.Grid
+	if *load != "" {
+		var err error
+		if g, err = gamestrategy.LoadFile(*load); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		g = gamestrategy.NewGrid(100, 100)
+		g.AddPlayer(gamestrategy.NewPlayer("Player 1"))
+		g.AddPlayer(gamestrategy.NewPlayer("Player 2"))
+		g.AddPlayer(gamestrategy.NewPlayer("Player 3"))
+	}
+	defer recordEvents(g)()
+	if *mcts {
+		g.AIs[0].Strategy = gamestrategy.NewMCTSStrategy()
+	}
 
 	for i := 0; i < 4000; i++ {
 		if !g.Tick() {
@@ -20,4 +100,32 @@ func main() {
 	}
 
 	g.ExportWebp("test.webp")
+	if *save != "" {
+		if err := g.SaveFile(*save); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// recordEvents records the events of the game if requested and returns a
+// function that finishes the recording.
+func recordEvents(g *gamestrategy.Grid) func() {
+	if *logf == "" {
+		return func() {}
+	}
+	f, err := os.Create(*logf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	l := g.RecordEvents(w)
+	return func() {
+		if err := l.Err(); err != nil {
+			log.Println(err)
+		}
+		if err := w.Flush(); err != nil {
+			log.Println(err)
+		}
+		f.Close()
+	}
 }
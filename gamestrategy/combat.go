@@ -0,0 +1,136 @@
+package gamestrategy
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	UnitCost        = 1.0  // Gold per unit of troop strength raised
+	UnitUpkeep      = 0.05 // Gold per unit of troop strength per tick
+	RecruitBatch    = 5.0  // Troop strength raised per recruitment
+	StartingTroops  = 5.0  // Troop strength in the capital at the start
+	MilitiaStrength = 1.0  // Strength of the local population defending a cell without troops
+	FortDefense     = 1.5  // Defense multiplier of a fortification
+)
+
+// CanRecruit returns true if troops can be raised in this cell.
+// Troops are raised from settlements and the capital.
+func (c *Cell) CanRecruit() bool {
+	return c.Type == &TypeCapital || c.Features&FeatureSettlement != 0
+}
+
+// Upkeep returns the cost of maintaining the troops stationed in this cell.
+func (c *Cell) Upkeep() float64 {
+	return c.Troops * UnitUpkeep
+}
+
+// Defense returns the defense multiplier of this cell, based on the terrain,
+// rivers and fortifications.
+func (c *Cell) Defense() float64 {
+	def := c.Type.Defense
+	if def == 0 {
+		def = 1.0
+	}
+	if c.Features&FeatureFort != 0 {
+		def *= FortDefense
+	}
+	if c.River {
+		def *= RiverDefense
+	}
+	return def
+}
+
+// DefenderStrength returns the strength of the defenders of this cell.
+func (c *Cell) DefenderStrength() float64 {
+	return math.Max(c.Troops, MilitiaStrength)
+}
+
+// moveCost returns the cost of marching troops into the given cell.
+// Crossing a river is more expensive.
+func moveCost(c *Cell) float64 {
+	cost := math.Max(c.Type.Cost, 1.0) * 0.5
+	if c.River {
+		cost *= RiverCrossing
+	}
+	return cost
+}
+
+// combatModifiers returns the attacker and defender strength multipliers for
+// an attack from cell 'from' on cell 'at'.
+func (g *Grid) combatModifiers(from, at *Cell) (attMod, defMod float64) {
+	// The attacker gets a flanking bonus for each neighbor of the attacked cell
+	// that they own.
+	nbs := g.CellNeighbors(at.X, at.Y)
+	var numNeighborsOwned int
+	for _, nb := range nbs {
+		if nb.ControlledBy == from.ControlledBy {
+			numNeighborsOwned++
+		}
+	}
+	attMod = 1.0 + 0.5*float64(numNeighborsOwned)/float64(len(nbs))
+	if from.ControlledBy != nil && from.ControlledBy.HasTech(TechTactics) {
+		attMod *= TacticsBonus
+	}
+
+	// The defender benefits from terrain, fortifications and higher ground.
+	defMod = at.Defense()
+	if heightDiff := at.Elevation - from.Elevation; heightDiff > 0 {
+		defMod *= 1.0 + heightDiff
+	} else {
+		attMod *= 1.0 - heightDiff
+	}
+	return attMod, defMod
+}
+
+// CombatOutcome describes the result of an attack on a cell.
+type CombatOutcome struct {
+	AttackerStrength float64 // Troops committed by the attacker
+	DefenderStrength float64 // Troops (or militia) defending the cell
+	AttackerPower    float64 // Effective attacker strength after modifiers and luck
+	DefenderPower    float64 // Effective defender strength after modifiers and luck
+	AttackerLosses   float64 // Troops lost by the attacker
+	DefenderLosses   float64 // Troops lost by the defender
+	Success          bool    // Did the attacker win?
+}
+
+func (o CombatOutcome) String() string {
+	return fmt.Sprintf("attacker %.1f (power %.1f, lost %.1f) vs defender %.1f (power %.1f, lost %.1f), success: %t",
+		o.AttackerStrength, o.AttackerPower, o.AttackerLosses,
+		o.DefenderStrength, o.DefenderPower, o.DefenderLosses, o.Success)
+}
+
+// resolveCombat resolves an attack of 'att' troops on a cell defended by 'def' troops.
+// 'attMod' and 'defMod' are the multipliers applied to the respective strength
+// (flanking, terrain, fortifications, elevation, ...).
+func resolveCombat(r *rand.Rand, att, def, attMod, defMod float64) CombatOutcome {
+	o := CombatOutcome{
+		AttackerStrength: att,
+		DefenderStrength: def,
+	}
+
+	// Each side gets a random luck factor between 0.75 and 1.25.
+	o.AttackerPower = att * attMod * (0.75 + r.Float64()*0.5)
+	o.DefenderPower = def * defMod * (0.75 + r.Float64()*0.5)
+	o.Success = o.AttackerPower > o.DefenderPower
+
+	// Each side loses troops relative to the power of the opponent.
+	// The loser suffers heavier casualties.
+	attLossRate, defLossRate := 0.5, 0.3
+	if o.Success {
+		attLossRate, defLossRate = 0.3, 1.0
+	}
+	o.AttackerLosses = math.Min(att, o.DefenderPower*attLossRate)
+	o.DefenderLosses = math.Min(def, o.AttackerPower*defLossRate)
+	return o
+}
+
+// winChance estimates the probability of winning an attack with the given
+// effective attacker and defender power (ignoring luck).
+func winChance(attPower, defPower float64) float64 {
+	if attPower+defPower <= 0 {
+		return 0
+	}
+	return attPower / (attPower + defPower)
+}
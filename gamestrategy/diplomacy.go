@@ -0,0 +1,301 @@
+package gamestrategy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Treaties between two players.
+const (
+	TreatyNone     = 0
+	TreatyAlliance = 1 << iota // Mutual defense
+	TreatyPact                 // Non-aggression pact
+	TreatyTrade                // Trade agreement
+	TreatyWar                  // Open war
+)
+
+const (
+	PactDuration     = 200  // Ticks until a non-aggression pact expires
+	TradeIncome      = 1.0  // Gold per tick for each trade agreement
+	TributeFraction  = 0.2  // Fraction of the gold of the target demanded as tribute
+	DiplomacyChance  = 0.02 // Chance per tick and player that the AI considers diplomacy
+	StrengthPerCell  = 0.5  // Military strength contributed by each owned cell (militia)
+	allianceOpinion  = 0.4  // Minimum opinion to accept an alliance
+	tradeOpinion     = 0.0  // Minimum opinion to accept a trade agreement
+	pactOpinion      = -0.2 // Minimum opinion to accept a pact (modified by relative strength)
+	warOpinion       = -0.7 // Opinion at which the AI considers declaring war
+	tributeThreshold = 0.65 // Relative strength at which a demand for tribute is accepted
+)
+
+type MsgProposeAlliance struct {
+	FromID int // Proposing player
+	ToID   int // Receiving player
+}
+
+type MsgProposePact struct {
+	FromID   int // Proposing player
+	ToID     int // Receiving player
+	Duration int // Number of ticks the pact lasts
+}
+
+type MsgProposeTrade struct {
+	FromID int // Proposing player
+	ToID   int // Receiving player
+}
+
+type MsgDemandTribute struct {
+	FromID int     // Demanding player
+	ToID   int     // Player that should pay
+	Amount float64 // Gold demanded
+}
+
+type MsgDeclareWar struct {
+	FromID int // Aggressor
+	ToID   int // Player that war was declared on
+}
+
+type MsgDiplomacyReply struct {
+	FromID   int  // Player that replies
+	ToID     int  // Player that made the proposal
+	Proposal any  // The original proposal
+	Accepted bool // Was the proposal accepted?
+}
+
+// treatyNames returns a short description of the given treaties.
+func treatyNames(t int64) string {
+	var names []string
+	if t&TreatyAlliance != 0 {
+		names = append(names, "ALLY")
+	}
+	if t&TreatyPact != 0 {
+		names = append(names, "PACT")
+	}
+	if t&TreatyTrade != 0 {
+		names = append(names, "TRADE")
+	}
+	if t&TreatyWar != 0 {
+		names = append(names, "WAR")
+	}
+	return strings.Join(names, ",")
+}
+
+// Strength returns the military strength of the given player.
+func (g *Grid) Strength(p *Player) float64 {
+	var strength float64
+	for _, c := range g.Cells {
+		if c.ControlledBy == p {
+			strength += c.Troops + StrengthPerCell
+		}
+	}
+	return strength
+}
+
+// relativeStrength returns our strength relative to the combined strength of
+// us and the given player (as far as we know). 0.5 means we are equally strong.
+func (a *AI) relativeStrength(p *Player) float64 {
+	ours := a.Strength(a.Player)
+	theirs := a.knownStrength(p)
+	if ours+theirs <= 0 {
+		return 0.5
+	}
+	return ours / (ours + theirs)
+}
+
+// HasTreaty returns true if we have any of the given treaties with the player.
+func (a *AI) HasTreaty(p *Player, t int64) bool {
+	return a.Treaties[p]&t != 0
+}
+
+func (a *AI) setTreaty(p *Player, t int64) {
+	switch t {
+	case TreatyWar:
+		// War ends all other treaties.
+		a.Treaties[p] = TreatyWar
+		delete(a.PactExpires, p)
+	case TreatyPact:
+		// A pact ends any war.
+		a.Treaties[p] = a.Treaties[p]&^TreatyWar | TreatyPact
+		a.PactExpires[p] = a.Ticks + PactDuration
+	case TreatyAlliance, TreatyTrade:
+		a.Treaties[p] = a.Treaties[p]&^TreatyWar | t
+	}
+	a.logf("AI %s now has treaties %b with %s", a.Name, a.Treaties[p], p.Name)
+}
+
+// expireTreaties removes all pacts that have expired.
+func (a *AI) expireTreaties() {
+	for p, t := range a.PactExpires {
+		if t <= a.Ticks {
+			a.Treaties[p] &^= TreatyPact
+			delete(a.PactExpires, p)
+			a.logf("AI %s pact with %s expired", a.Name, p.Name)
+		}
+	}
+}
+
+// diplomacy lets the AI consider diplomatic actions towards other players.
+func (a *AI) diplomacy() {
+	for _, p := range a.Players {
+		if p == a.Player || a.Rand.Float64() > DiplomacyChance {
+			continue
+		}
+		opinion := a.Opinion[p]
+		relStrength := a.relativeStrength(p)
+		aggression := a.DesirabilityModifiers[ActionAttack]
+		switch {
+		case opinion <= warOpinion/aggression && relStrength > 0.5 && !a.HasTreaty(p, TreatyWar|TreatyPact|TreatyAlliance):
+			a.DeclareWar(p)
+		case opinion < 0 && relStrength < 0.5 && !a.HasTreaty(p, TreatyPact|TreatyAlliance):
+			// They are hostile and stronger than us, so we'd better make peace.
+			a.Propose(p, MsgProposePact{
+				FromID:   a.Player.ID,
+				ToID:     p.ID,
+				Duration: PactDuration,
+			})
+		case opinion < 0 && relStrength > tributeThreshold*aggression && !a.HasTreaty(p, TreatyAlliance):
+			a.Propose(p, MsgDemandTribute{
+				FromID: a.Player.ID,
+				ToID:   p.ID,
+				Amount: max(p.Gold, 0) * TributeFraction,
+			})
+		case opinion >= allianceOpinion && !a.HasTreaty(p, TreatyAlliance|TreatyWar):
+			a.Propose(p, MsgProposeAlliance{
+				FromID: a.Player.ID,
+				ToID:   p.ID,
+			})
+		case opinion > tradeOpinion && !a.HasTreaty(p, TreatyTrade|TreatyWar):
+			a.Propose(p, MsgProposeTrade{
+				FromID: a.Player.ID,
+				ToID:   p.ID,
+			})
+		}
+	}
+}
+
+// Propose sends a diplomatic proposal to the given player.
+func (a *AI) Propose(p *Player, proposal any) {
+	a.logf("AI %s proposes %T to %s", a.Name, proposal, p.Name)
+	a.Messenger.Send(a.Player.ID, []int{p.ID}, proposal)
+}
+
+// DeclareWar declares war on the given player and lets everyone know.
+func (a *AI) DeclareWar(p *Player) {
+	a.logf("AI %s declares war on %s", a.Name, p.Name)
+	a.setTreaty(p, TreatyWar)
+	a.Messenger.Broadcast(a.Player.ID, MsgDeclareWar{
+		FromID: a.Player.ID,
+		ToID:   p.ID,
+	})
+}
+
+// considerProposal decides if we accept a diplomatic proposal from the given
+// player based on our opinion of them and our relative strength.
+func (a *AI) considerProposal(from *Player, proposal any) bool {
+	opinion := a.Opinion[from]
+	relStrength := a.relativeStrength(from)
+	switch msg := proposal.(type) {
+	case MsgProposeAlliance:
+		return opinion >= allianceOpinion && !a.HasTreaty(from, TreatyWar)
+	case MsgProposePact:
+		// The weaker we are, the more willing we are to accept a pact.
+		return opinion+(0.5-relStrength) >= pactOpinion
+	case MsgProposeTrade:
+		return opinion > tradeOpinion && !a.HasTreaty(from, TreatyWar)
+	case MsgDemandTribute:
+		// We only pay if they are much stronger than us and we can afford it.
+		return 1-relStrength >= tributeThreshold && a.Gold >= msg.Amount && !a.HasTreaty(from, TreatyAlliance)
+	}
+	return false
+}
+
+// acceptProposal applies the effects of an accepted proposal on our side.
+func (a *AI) acceptProposal(from *Player, proposal any) {
+	switch msg := proposal.(type) {
+	case MsgProposeAlliance:
+		a.setTreaty(from, TreatyAlliance)
+		a.ChangeOpinion(from, 0.2, "alliance")
+	case MsgProposePact:
+		a.setTreaty(from, TreatyPact)
+		a.ChangeOpinion(from, 0.1, "non-aggression pact")
+	case MsgProposeTrade:
+		a.setTreaty(from, TreatyTrade)
+		a.ChangeOpinion(from, 0.1, "trade agreement")
+	case MsgDemandTribute:
+		a.Gold -= msg.Amount
+		from.Gold += msg.Amount
+		a.ChangeOpinion(from, -0.1, "paid tribute")
+	}
+}
+
+// replyToProposal decides on a proposal and sends the reply.
+func (a *AI) replyToProposal(from int, proposal any, accepted bool) {
+	p := a.Players[from]
+	if accepted {
+		a.acceptProposal(p, proposal)
+	}
+	a.Messenger.Send(a.Player.ID, []int{from}, MsgDiplomacyReply{
+		FromID:   a.Player.ID,
+		ToID:     from,
+		Proposal: proposal,
+		Accepted: accepted,
+	})
+}
+
+// receiveDiplomacy handles diplomatic messages and returns true if the message
+// was a diplomatic message.
+func (a *AI) receiveDiplomacy(from int, message any) bool {
+	switch msg := message.(type) {
+	case MsgProposeAlliance, MsgProposePact, MsgProposeTrade, MsgDemandTribute:
+		p := a.Players[from]
+		if _, ok := msg.(MsgDemandTribute); ok {
+			a.ChangeOpinion(p, -0.1, "demanded tribute")
+		}
+		accepted := a.considerProposal(p, msg)
+		a.logf("AI %s considers %T from %s: %t", a.Name, msg, p.Name, accepted)
+		a.replyToProposal(from, msg, accepted)
+	case MsgDiplomacyReply:
+		p := a.Players[from]
+		if msg.Accepted {
+			switch proposal := msg.Proposal.(type) {
+			case MsgProposeAlliance:
+				a.setTreaty(p, TreatyAlliance)
+			case MsgProposePact:
+				a.setTreaty(p, TreatyPact)
+			case MsgProposeTrade:
+				a.setTreaty(p, TreatyTrade)
+			case MsgDemandTribute:
+				a.logf("AI %s received %f tribute from %s", a.Name, proposal.Amount, p.Name)
+			}
+			return true
+		}
+		// If they refused to pay tribute, we might go to war.
+		if _, ok := msg.Proposal.(MsgDemandTribute); ok && !a.Player.Human {
+			a.ChangeOpinion(p, -0.2, "refused tribute")
+			if a.relativeStrength(p) > 0.5 && !a.HasTreaty(p, TreatyWar|TreatyPact) {
+				a.DeclareWar(p)
+			}
+		} else {
+			a.ChangeOpinion(p, -0.05, fmt.Sprintf("refused %T", msg.Proposal))
+		}
+	case MsgDeclareWar:
+		if msg.ToID == a.Player.ID {
+			a.setTreaty(a.Players[msg.FromID], TreatyWar)
+			a.ChangeOpinion(a.Players[msg.FromID], -0.5, "declared war on us")
+			return true
+		}
+		if msg.FromID == a.Player.ID {
+			return true
+		}
+		// If they declared war on an ally, we join the war.
+		// A human decides for themselves whether to join.
+		if a.HasTreaty(a.Players[msg.ToID], TreatyAlliance) {
+			a.ChangeOpinion(a.Players[msg.FromID], -0.3, "declared war on our ally")
+			if !a.Player.Human && !a.HasTreaty(a.Players[msg.FromID], TreatyWar|TreatyAlliance) {
+				a.DeclareWar(a.Players[msg.FromID])
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
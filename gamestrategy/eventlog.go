@@ -0,0 +1,290 @@
+package gamestrategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kinds of events in the event log.
+const (
+	EventInit     = "init"     // Initial state of the grid
+	EventTick     = "tick"     // End of a tick with all changes to the grid
+	EventTask     = "task"     // A player performed a task
+	EventMessage  = "message"  // A player sent a message
+	EventOpinion  = "opinion"  // An AI changed its opinion of a player
+	EventBankrupt = "bankrupt" // A player went bankrupt
+)
+
+// Event is a single entry in the event log.
+// Depending on the kind, only one of the detail fields is set.
+type Event struct {
+	Tick    int           `json:"tick"`
+	Kind    string        `json:"kind"`
+	Player  int           `json:"player"` // Player that caused the event (-1 = none)
+	Init    *InitEvent    `json:"init,omitempty"`
+	Changes *TickEvent    `json:"changes,omitempty"`
+	Task    *TaskEvent    `json:"task,omitempty"`
+	Message *MessageEvent `json:"message,omitempty"`
+	Opinion *OpinionEvent `json:"opinion,omitempty"`
+}
+
+// InitEvent describes the grid at the start of the recording.
+type InitEvent struct {
+	Width   int          `json:"width"`
+	Height  int          `json:"height"`
+	Players []string     `json:"players"`
+	Rivers  []int        `json:"rivers"` // Indices of cells with a river
+	Cells   []CellChange `json:"cells"`  // State of all cells
+}
+
+// TickEvent lists the cells that changed during a tick and the gold of each
+// player at the end of it.
+type TickEvent struct {
+	Gold  []float64    `json:"gold"`
+	Cells []CellChange `json:"cells"`
+}
+
+// CellChange is the new state of a cell.
+type CellChange struct {
+	Index    int     `json:"i"`
+	Type     string  `json:"type"`
+	Owner    int     `json:"owner"` // Player ID or -1
+	Features int64   `json:"features"`
+	Troops   float64 `json:"troops"`
+}
+
+// TaskEvent describes a task performed by a player and why it was picked.
+type TaskEvent struct {
+	Action       string  `json:"action"`
+	X            int     `json:"x"`
+	Y            int     `json:"y"`
+	Detail       string  `json:"detail,omitempty"` // Feature, technology, source cell...
+	Cost         float64 `json:"cost"`
+	Desirability float64 `json:"desirability"`
+	Gold         float64 `json:"gold"`     // Gold before performing the task
+	Strategy     string  `json:"strategy"` // Strategy that picked the task
+}
+
+// MessageEvent describes a message sent by a player.
+type MessageEvent struct {
+	Type    string `json:"type"`
+	To      []int  `json:"to,omitempty"` // Empty for broadcasts
+	Located bool   `json:"located"`      // Does the message refer to a cell?
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// OpinionEvent describes a change in the opinion of an AI about a player.
+type OpinionEvent struct {
+	Of      int     `json:"of"` // Player ID
+	Change  float64 `json:"change"`
+	Opinion float64 `json:"opinion"` // New opinion
+	Reason  string  `json:"reason"`
+}
+
+// String returns a short description of the event.
+func (e *Event) String() string {
+	switch e.Kind {
+	case EventTask:
+		t := e.Task
+		s := fmt.Sprintf("P%d %s %d,%d cost %.1f des %.2f", e.Player, t.Action, t.X, t.Y, t.Cost, t.Desirability)
+		if t.Detail != "" {
+			s += " " + t.Detail
+		}
+		return s
+	case EventMessage:
+		m := e.Message
+		s := fmt.Sprintf("P%d %s", e.Player, m.Type)
+		if len(m.To) > 0 {
+			s += fmt.Sprintf(" to %v", m.To)
+		}
+		if m.Located {
+			s += fmt.Sprintf(" at %d,%d", m.X, m.Y)
+		}
+		if m.Detail != "" {
+			s += " " + m.Detail
+		}
+		return s
+	case EventOpinion:
+		o := e.Opinion
+		return fmt.Sprintf("P%d opinion of P%d %+.2f = %.2f (%s)", e.Player, o.Of, o.Change, o.Opinion, o.Reason)
+	case EventBankrupt:
+		return fmt.Sprintf("P%d is bankrupt", e.Player)
+	}
+	return e.Kind
+}
+
+// typeName returns the name of the type of v without the package name.
+func typeName(v any) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", v), "gamestrategy.")
+}
+
+// EventLog writes the events of a game as JSON lines.
+type EventLog struct {
+	enc      *json.Encoder
+	err      error        // First error while writing
+	last     []CellChange // State of the cells at the end of the last tick
+	bankrupt map[int]bool // Players that are bankrupt
+}
+
+// RecordEvents starts writing all events of the game to the given writer.
+// The first event is the current state of the grid.
+func (g *Grid) RecordEvents(w io.Writer) *EventLog {
+	l := &EventLog{
+		enc:      json.NewEncoder(w),
+		last:     g.cellStates(),
+		bankrupt: make(map[int]bool),
+	}
+	init := &InitEvent{
+		Width:  g.Width,
+		Height: g.Height,
+		Cells:  l.last,
+	}
+	for _, p := range g.Players {
+		init.Players = append(init.Players, p.Name)
+	}
+	for i, c := range g.Cells {
+		if c.River {
+			init.Rivers = append(init.Rivers, i)
+		}
+	}
+	l.write(Event{Tick: g.Ticks, Kind: EventInit, Player: -1, Init: init})
+
+	g.Events = l
+	g.Messenger.Tap = func(from int, to []int, message any) {
+		l.message(g.Ticks, from, to, message)
+	}
+	return l
+}
+
+// Err returns the first error that occurred while writing the log.
+func (l *EventLog) Err() error {
+	return l.err
+}
+
+func (l *EventLog) write(e Event) {
+	if l.err == nil {
+		l.err = l.enc.Encode(e)
+	}
+}
+
+// cellStates returns the current state of all cells.
+func (g *Grid) cellStates() []CellChange {
+	states := make([]CellChange, len(g.Cells))
+	for i, c := range g.Cells {
+		states[i] = CellChange{
+			Index:    i,
+			Type:     c.Type.Name,
+			Owner:    playerID(c.ControlledBy),
+			Features: c.Features,
+			Troops:   c.Troops,
+		}
+	}
+	return states
+}
+
+// tick logs all cells that changed since the last tick.
+func (l *EventLog) tick(g *Grid) {
+	if l == nil {
+		return
+	}
+	ev := &TickEvent{}
+	for _, p := range g.Players {
+		ev.Gold = append(ev.Gold, p.Gold)
+	}
+	states := g.cellStates()
+	for i, s := range states {
+		if s != l.last[i] {
+			ev.Cells = append(ev.Cells, s)
+		}
+	}
+	l.last = states
+	l.write(Event{Tick: g.Ticks, Kind: EventTick, Player: -1, Changes: ev})
+}
+
+// task logs a task that is about to be performed by the AI.
+func (l *EventLog) task(a *AI, t Task) {
+	if l == nil {
+		return
+	}
+	ev := &TaskEvent{
+		Action:       t.Action,
+		X:            t.At.X,
+		Y:            t.At.Y,
+		Cost:         t.Cost(),
+		Desirability: t.Desirability,
+		Gold:         a.Gold,
+		Strategy:     typeName(a.Strategy),
+	}
+	if a.Player.Human {
+		ev.Strategy = "human"
+	}
+	switch p := t.Payload.(type) {
+	case TaskBuild:
+		ev.Detail = FeatureName(p.Feature)
+	case TaskResearch:
+		ev.Detail = TechByID(p.Tech).Name
+	case TaskExpand:
+		ev.Detail = fmt.Sprintf("from %d,%d", p.From.X, p.From.Y)
+	case TaskAttack:
+		ev.Detail = fmt.Sprintf("from %d,%d", p.From.X, p.From.Y)
+	case TaskMove:
+		ev.Detail = fmt.Sprintf("%.1f troops from %d,%d", p.Amount, p.From.X, p.From.Y)
+	case TaskRecruit:
+		ev.Detail = fmt.Sprintf("%.1f troops", p.Amount)
+	}
+	l.write(Event{Tick: a.Ticks, Kind: EventTask, Player: a.Player.ID, Task: ev})
+}
+
+// message logs a message sent by a player.
+func (l *EventLog) message(tick, from int, to []int, message any) {
+	if l == nil {
+		return
+	}
+	ev := &MessageEvent{
+		Type: typeName(message),
+		To:   to,
+	}
+	if loc, ok := message.(Located); ok && loc.Location() != nil {
+		ev.Located = true
+		ev.X, ev.Y = loc.Location().X, loc.Location().Y
+	}
+	switch msg := message.(type) {
+	case MsgBuild:
+		ev.Detail = FeatureName(msg.Feature)
+	case MsgAttack:
+		ev.Detail = fmt.Sprintf("on P%d success %t (%s)", msg.ToID, msg.Success, msg.Outcome)
+	case MsgDemandTribute:
+		ev.Detail = fmt.Sprintf("%.1f gold", msg.Amount)
+	case MsgDeclareWar:
+		ev.Detail = fmt.Sprintf("on P%d", msg.ToID)
+	case MsgDiplomacyReply:
+		ev.Detail = fmt.Sprintf("accepted %t %s", msg.Accepted, typeName(msg.Proposal))
+	}
+	l.write(Event{Tick: tick, Kind: EventMessage, Player: from, Message: ev})
+}
+
+// opinion logs a change in the opinion of the AI about the given player.
+func (l *EventLog) opinion(a *AI, p *Player, change float64, reason string) {
+	if l == nil {
+		return
+	}
+	l.write(Event{Tick: a.Ticks, Kind: EventOpinion, Player: a.Player.ID, Opinion: &OpinionEvent{
+		Of:      p.ID,
+		Change:  change,
+		Opinion: a.Opinion[p],
+		Reason:  reason,
+	}})
+}
+
+// bankruptcy logs that the given player went bankrupt.
+func (l *EventLog) bankruptcy(g *Grid, p *Player) {
+	if l == nil || l.bankrupt[p.ID] {
+		return
+	}
+	l.bankrupt[p.ID] = true
+	l.write(Event{Tick: g.Ticks, Kind: EventBankrupt, Player: p.ID})
+}
@@ -25,6 +25,8 @@ func (w *Grid) renderFrame(img imageIf) {
 	for _, c := range w.Cells {
 		if c.ControlledBy != nil {
 			img.Set(int(c.X), int(c.Y), nameToColor[c.ControlledBy.Name])
+		} else if c.River {
+			img.Set(int(c.X), int(c.Y), RiverColor)
 		} else {
 			img.Set(int(c.X), int(c.Y), c.Type.Color)
 		}
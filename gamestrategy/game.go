@@ -0,0 +1,281 @@
+package gamestrategy
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/mazznoer/colorgrad"
+)
+
+const (
+	ScreenWidth  = 960
+	ScreenHeight = 600
+	tileSize     = 6
+	panelX       = 610 // X offset of the info panel
+)
+
+// Game is an interactive front-end for a game with a human player.
+// The human selects a cell with the mouse and issues tasks via the keyboard,
+// which are executed through the same AI.Do code path as the AI tasks.
+// Each task issued by the human ends the turn and advances the game by a tick.
+type Game struct {
+	*Grid
+	Selected *Cell  // Currently selected cell
+	Status   string // Result of the last action
+	Research int    // Index of the selected technology in Techs
+	AutoPlay bool   // Advance the game without waiting for the human
+	GameOver bool   // The game has ended
+	colors   map[*Player]color.Color
+}
+
+// NewGame creates a new interactive game with a human player and the given
+// number of AI opponents.
+func NewGame(width, height, numAIs int, humanName string) *Game {
+	grid := NewGrid(width, height)
+	grid.AddPlayer(NewHumanPlayer(humanName))
+	for i := 0; i < numAIs; i++ {
+		grid.AddPlayer(NewPlayer(fmt.Sprintf("AI %d", i+1)))
+	}
+	return NewGameFromGrid(grid)
+}
+
+// NewGameFromGrid returns a new game for the given grid (e.g. a loaded game).
+// The grid should have a human player.
+func NewGameFromGrid(grid *Grid) *Game {
+	g := &Game{
+		Grid:   grid,
+		colors: make(map[*Player]color.Color),
+	}
+	cols := colorgrad.Rainbow().Colors(uint(len(g.Players) + 1))
+	for i, p := range g.Players {
+		g.colors[p] = cols[i]
+	}
+	return g
+}
+
+// keyBindings maps keys to actions (and features for build actions).
+var keyBindings = []struct {
+	Key     ebiten.Key
+	Action  string
+	Feature int64
+}{
+	{ebiten.Key1, ActionBuild, FeatureFarm},
+	{ebiten.Key2, ActionBuild, FeatureLumber},
+	{ebiten.Key3, ActionBuild, FeatureQuarry},
+	{ebiten.Key4, ActionBuild, FeatureMine},
+	{ebiten.Key5, ActionBuild, FeatureSettlement},
+	{ebiten.Key6, ActionBuild, FeatureFort},
+	{ebiten.KeyE, ActionExpand, FeatureNone},
+	{ebiten.KeyA, ActionAttack, FeatureNone},
+	{ebiten.KeyX, ActionAbandon, FeatureNone},
+	{ebiten.KeyR, ActionRecruit, FeatureNone},
+	{ebiten.KeyM, ActionMove, FeatureNone},
+	{ebiten.KeyC, ActionClear, FeatureNone},
+}
+
+func (g *Game) Update() error {
+	if g.GameOver {
+		return nil
+	}
+
+	// Select a cell.
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		x, y := ebiten.CursorPosition()
+		if c := g.Cell(x/tileSize, y/tileSize); c != nil {
+			g.Selected = c
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		g.AutoPlay = !g.AutoPlay
+	}
+
+	// Answer diplomatic proposals.
+	if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+		g.Human.Answer(true)
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyN) {
+		g.Human.Answer(false)
+	}
+
+	// Diplomatic actions towards the owner of the selected cell.
+	// NOTE: These don't end the turn.
+	if g.Selected != nil && g.Selected.ControlledBy != nil {
+		owner := g.Selected.ControlledBy
+		if inpututil.IsKeyJustPressed(ebiten.KeyL) {
+			g.Human.ProposeTo(owner, TreatyAlliance)
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyK) {
+			g.Human.ProposeTo(owner, TreatyPact)
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+			g.Human.ProposeTo(owner, TreatyTrade)
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyW) {
+			g.Human.ProposeTo(owner, TreatyWar)
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+			g.Human.DemandTribute(owner)
+		}
+	}
+
+	// Select and research a technology.
+	if inpututil.IsKeyJustPressed(ebiten.KeyU) {
+		g.Research = (g.Research + 1) % len(Techs)
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyI) {
+		tech := Techs[g.Research]
+		t, err := g.Human.NewTask(ActionResearch, nil, tech.ID)
+		if err != nil {
+			g.Status = fmt.Sprintf("Can't research %s: %v", tech.Name, err)
+		} else {
+			g.Human.Do(t)
+			g.Status = fmt.Sprintf("Researched %s for %.1f gold", tech.Name, t.Cost())
+			g.endTurn()
+			return nil
+		}
+	}
+
+	// Issue a task on the selected cell.
+	if g.Selected != nil {
+		for _, kb := range keyBindings {
+			if !inpututil.IsKeyJustPressed(kb.Key) {
+				continue
+			}
+			t, err := g.Human.NewTask(kb.Action, g.Selected, kb.Feature)
+			if err != nil {
+				g.Status = fmt.Sprintf("Can't %s: %v", kb.Action, err)
+				break
+			}
+			g.Human.Do(t)
+			g.Status = fmt.Sprintf("%s on %d,%d for %.1f gold", kb.Action, t.At.X, t.At.Y, t.Cost())
+			g.endTurn()
+			return nil
+		}
+	}
+
+	// End the turn without doing anything.
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) || g.AutoPlay {
+		g.endTurn()
+	}
+	return nil
+}
+
+func (g *Game) endTurn() {
+	if !g.Tick() || g.Human.Gold < 0 {
+		g.GameOver = true
+	}
+	g.Human.UpdateKnowledge()
+}
+
+func (g *Game) Draw(screen *ebiten.Image) {
+	// Draw the grid as far as the human knows it.
+	k := g.Human.Knowledge
+	for i := range g.Cells {
+		c := &g.Cells[i]
+		m := k.Memory[i]
+		if !m.Seen {
+			continue // Unexplored.
+		}
+		col := m.Type.Color
+		if m.ControlledBy != nil {
+			col = g.colors[m.ControlledBy]
+		}
+		ebitenutil.DrawRect(screen, float64(c.X*tileSize), float64(c.Y*tileSize), tileSize, tileSize, col)
+		if c.River {
+			ebitenutil.DrawRect(screen, float64(c.X*tileSize+1), float64(c.Y*tileSize+1), tileSize-2, tileSize-2, RiverColor)
+		}
+
+		// Dim cells that are not currently visible.
+		if !k.Visible[i] {
+			ebitenutil.DrawRect(screen, float64(c.X*tileSize), float64(c.Y*tileSize), tileSize, tileSize, color.RGBA{0, 0, 0, 0x80})
+		}
+
+		// Mark cells with troops.
+		if m.Troops > 0 {
+			ebitenutil.DrawRect(screen, float64(c.X*tileSize+2), float64(c.Y*tileSize+2), 2, 2, color.Black)
+		}
+	}
+
+	// Highlight the selected cell.
+	if c := g.Selected; c != nil {
+		ebitenutil.DrawRect(screen, float64(c.X*tileSize-1), float64(c.Y*tileSize-1), tileSize+2, tileSize+2, color.White)
+	}
+
+	ebitenutil.DebugPrintAt(screen, g.info(), panelX, 0)
+}
+
+// info returns the text for the info panel.
+func (g *Game) info() string {
+	var sb strings.Builder
+	h := g.Human
+
+	// Calculate the yield and cost per tick.
+	var yield, cost float64
+	var cells int
+	for _, c := range g.Cells {
+		if c.ControlledBy == h.Player {
+			yield += c.Yield()
+			cost += c.Cost() + c.Upkeep()
+			cells++
+		}
+	}
+	fmt.Fprintf(&sb, "%s\nGOLD  %.1f\nYIELD %.1f\nCOST  %.1f\nCELLS %d\n", h.Name, h.Gold, yield, cost, cells)
+	if g.GameOver {
+		sb.WriteString("GAME OVER\n")
+	}
+
+	// Opinions of the AIs about us.
+	sb.WriteString("\nOPINIONS\n")
+	for _, ai := range g.AIs {
+		if ai.Player == h.Player {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s: %+.2f (gold %.0f) %s\n", ai.Name, ai.Opinion[h.Player], ai.Gold, treatyNames(h.Treaties[ai.Player]))
+	}
+
+	// Research.
+	tech := Techs[g.Research]
+	state := fmt.Sprintf("%.0f gold", tech.Cost)
+	if h.HasTech(tech.ID) {
+		state = "known"
+	} else if !h.CanResearch(tech) {
+		state = "needs " + techNames(tech.Requires)
+	}
+	fmt.Fprintf(&sb, "\nRESEARCH %s (%s)\nKNOWN    %s\n", tech.Name, state, techNames(h.Techs))
+
+	// The selected cell as far as we know it.
+	if c := g.Selected; c != nil && h.Known(c).Seen {
+		m := h.Known(c)
+		owner := "nobody"
+		if m.ControlledBy != nil {
+			owner = m.ControlledBy.Name
+		}
+		fmt.Fprintf(&sb, "\nCELL %d,%d %s\nOWNER  %s\nTROOPS %.1f\nSEEN   %d\nHEIGHT %.2f\n", c.X, c.Y, m.Type.Name, owner, m.Troops, m.LastSeen, c.Elevation)
+		if c.River {
+			sb.WriteString("RIVER\n")
+		}
+		if h.Knowledge.Visible[c.Y*g.Width+c.X] {
+			fmt.Fprintf(&sb, "YIELD  %.1f\nCOST   %.1f\nDEF    %.2f\n", c.Yield(), c.Cost(), c.Defense())
+		}
+		var features []string
+		for _, f := range splitFeatures(m.Features) {
+			features = append(features, FeatureName(f))
+		}
+		fmt.Fprintf(&sb, "BUILT  %s\n", strings.Join(features, ","))
+	}
+
+	sb.WriteString("\nKEYS\n1-6 BUILD FARM,LUMBER,QUARRY,\n    MINE,SETTLEMENT,FORT\nE EXPAND  A ATTACK  X ABANDON\nR RECRUIT M MOVE TROOPS\nC CLEAR FOREST\nU SELECT TECH  I RESEARCH\nSPACE END TURN  P AUTOPLAY\nL ALLY K PACT T TRADE W WAR\nG DEMAND TRIBUTE  Y/N ANSWER\n")
+	if g.Status != "" {
+		fmt.Fprintf(&sb, "\n%s\n", g.Status)
+	}
+
+	// Recent messages.
+	sb.WriteString("\nMESSAGES\n")
+	for _, m := range h.Inbox {
+		sb.WriteString(m + "\n")
+	}
+	return sb.String()
+}
+
+func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return ScreenWidth, ScreenHeight
+}
@@ -2,8 +2,7 @@ package gamestrategy
 
 import (
 	"log"
-
-	"github.com/ojrac/opensimplex-go"
+	"math/rand"
 )
 
 type Grid struct {
@@ -12,62 +11,78 @@ type Grid struct {
 	Cells   []Cell
 	Players []*Player
 	AIs     []*AI
+	Human   *Human     // The human player (if any)
+	Ticks   int        // Number of ticks that have passed
+	Silent  bool       // Disables logging (e.g. for simulated games)
+	Rand    *rand.Rand // Source of randomness for the game
+	Events  *EventLog  // Records all events (if any)
 	*webpExport
 	*Messenger
 }
 
+// NewGrid returns a new grid with random AI behavior.
 func NewGrid(width, height int) *Grid {
+	g := newGrid(width, height, 0)
+	g.Rand = rand.New(rand.NewSource(rand.Int63()))
+	return g
+}
+
+// NewGridWithSeed returns a new grid where the terrain and all randomness
+// is derived from the given seed, so games can be reproduced.
+func NewGridWithSeed(width, height int, seed int64) *Grid {
+	return newGrid(width, height, seed)
+}
+
+func newGrid(width, height int, seed int64) *Grid {
 	g := &Grid{
 		Width:      width,
 		Height:     height,
+		Rand:       rand.New(rand.NewSource(seed)),
 		webpExport: newWebPExport(width, height),
 		Messenger:  NewMessenger(),
 	}
 	g.Cells = make([]Cell, width*height)
-	// Use noise bands to set the type of each cell
-	noise := opensimplex.NewNormalized(0)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			c := g.Cell(x, y)
-			c.X = x
-			c.Y = y
-			val := noise.Eval2(float64(x)*2/float64(width), float64(y)*2/float64(height)) * 0.5
-			val += noise.Eval2(float64(x)*4/float64(width), float64(y)*4/float64(height)) * 0.25
-			val += noise.Eval2(float64(x)*8/float64(width), float64(y)*8/float64(height)) * 0.25
-			c.Value = val
-			if val < 0.2 {
-				c.Type = &TypeWater
-			} else if val < 0.4 {
-				c.Type = &TypeMeadow
-			} else if val < 0.6 {
-				c.Type = &TypeForest
-			} else {
-				c.Type = &TypeMountain
-			}
-		}
-	}
-	log.Printf("Grid created with %d cells", len(g.Cells))
+	g.generateTerrain(seed)
 	return g
 }
 
 // Tick advances the game by one step. If the game is over, it returns false.
 func (g *Grid) Tick() bool {
-	// Loop over all cells and deduct cost from player
+	// Loop over all cells and deduct cost and troop upkeep from player
 	playerYield := make(map[*Player]float64)
 	playerCost := make(map[*Player]float64)
 	for _, c := range g.Cells {
 		if c.ControlledBy != nil {
 			playerYield[c.ControlledBy] += c.Yield()
-			playerCost[c.ControlledBy] += c.Cost()
-			c.ControlledBy.Gold += c.Yield() - c.Cost()
+			playerCost[c.ControlledBy] += c.Cost() + c.Upkeep()
+			c.ControlledBy.Gold += c.Yield() - c.Cost() - c.Upkeep()
+		}
+	}
+
+	// Add income from trade agreements.
+	for _, ai := range g.AIs {
+		for _, p := range g.Players {
+			if ai.HasTreaty(p, TreatyTrade) {
+				ai.Gold += TradeIncome
+				playerYield[ai.Player] += TradeIncome
+			}
 		}
 	}
 
-	log.Printf("Tick! Players: %d, AIs: %d", len(g.Players), len(g.AIs))
+	g.logf("Tick! Players: %d, AIs: %d", len(g.Players), len(g.AIs))
+
+	// Expire old treaties and look around.
+	for _, ai := range g.AIs {
+		ai.expireTreaties()
+		ai.UpdateKnowledge()
+	}
 
 	// AI actions
 	for _, ai := range g.AIs {
-		log.Println("AI tick for player", ai.Player.Name, "with gold", ai.Player.Gold, "and yield", playerYield[ai.Player], "and cost", playerCost[ai.Player])
+		if ai.Player.Human {
+			continue // The human issues their tasks through the UI.
+		}
+		g.logf("AI tick for player %s with gold %f and yield %f and cost %f", ai.Player.Name, ai.Player.Gold, playerYield[ai.Player], playerCost[ai.Player])
 		ai.Act()
 	}
 
@@ -75,15 +90,27 @@ func (g *Grid) Tick() bool {
 	var bankrupt int
 	for _, p := range g.Players {
 		if p.Gold < 0 {
-			log.Printf("Player %s is bankrupt!", p.Name)
+			g.logf("Player %s is bankrupt!", p.Name)
+			g.Events.bankruptcy(g, p)
 			bankrupt++
 		}
 	}
 
-	g.storeWebPFrame()
+	g.Events.tick(g)
+	g.Ticks++
+	if g.webpExport != nil {
+		g.storeWebPFrame()
+	}
 	return bankrupt < len(g.Players)
 }
 
+// logf logs the given message unless the grid is silent.
+func (g *Grid) logf(format string, v ...any) {
+	if !g.Silent {
+		log.Printf(format, v...)
+	}
+}
+
 func (g *Grid) Cell(x, y int) *Cell {
 	if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 		return nil
@@ -0,0 +1,269 @@
+package gamestrategy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Human is the message receiver for a human player.
+// It wraps the AI of the player (which executes the tasks issued by the human)
+// and keeps a log of all received messages so they can be displayed.
+type Human struct {
+	*AI
+	Inbox    []string   // Received messages, newest last
+	MaxInbox int        // Maximum number of messages to keep
+	Pending  []Proposal // Diplomatic proposals waiting for an answer
+}
+
+// Proposal is a diplomatic proposal received by the human.
+type Proposal struct {
+	FromID   int // Proposing player
+	Proposal any // The proposal message
+}
+
+func NewHuman(ai *AI) *Human {
+	return &Human{
+		AI:       ai,
+		MaxInbox: 10,
+	}
+}
+
+// Receive a message.
+func (h *Human) Receive(from int, message any) {
+	if from == h.Player.ID {
+		return // Ignore our own broadcasts.
+	}
+	h.notify(h.describeMessage(from, message))
+	if loc, ok := message.(Located); ok {
+		h.observe(loc.Location())
+	}
+
+	switch message.(type) {
+	case MsgProposeAlliance, MsgProposePact, MsgProposeTrade, MsgDemandTribute:
+		// Let the human decide.
+		h.Pending = append(h.Pending, Proposal{
+			FromID:   from,
+			Proposal: message,
+		})
+	case MsgDiplomacyReply, MsgDeclareWar:
+		h.receiveDiplomacy(from, message)
+	}
+}
+
+// notify adds a message to the inbox.
+func (h *Human) notify(msg string) {
+	h.Inbox = append(h.Inbox, msg)
+	if len(h.Inbox) > h.MaxInbox {
+		h.Inbox = h.Inbox[len(h.Inbox)-h.MaxInbox:]
+	}
+}
+
+// Answer accepts or rejects the oldest pending proposal.
+func (h *Human) Answer(accept bool) {
+	if len(h.Pending) == 0 {
+		return
+	}
+	p := h.Pending[0]
+	h.Pending = h.Pending[1:]
+	if msg, ok := p.Proposal.(MsgDemandTribute); ok && accept && h.Gold < msg.Amount {
+		accept = false // We can't afford it.
+	}
+	h.replyToProposal(p.FromID, p.Proposal, accept)
+}
+
+// ProposeTo sends a diplomatic action of the given kind to the given player.
+func (h *Human) ProposeTo(p *Player, treaty int64) {
+	if p == nil || p == h.Player {
+		return
+	}
+	switch treaty {
+	case TreatyAlliance:
+		h.Propose(p, MsgProposeAlliance{FromID: h.Player.ID, ToID: p.ID})
+	case TreatyPact:
+		h.Propose(p, MsgProposePact{FromID: h.Player.ID, ToID: p.ID, Duration: PactDuration})
+	case TreatyTrade:
+		h.Propose(p, MsgProposeTrade{FromID: h.Player.ID, ToID: p.ID})
+	case TreatyWar:
+		h.DeclareWar(p)
+	}
+}
+
+// DemandTribute demands tribute from the given player.
+func (h *Human) DemandTribute(p *Player) {
+	if p == nil || p == h.Player {
+		return
+	}
+	h.Propose(p, MsgDemandTribute{
+		FromID: h.Player.ID,
+		ToID:   p.ID,
+		Amount: max(p.Gold, 0) * TributeFraction,
+	})
+}
+
+func (h *Human) describeMessage(from int, message any) string {
+	name := fmt.Sprintf("Player %d", from)
+	if from >= 0 && from < len(h.Players) {
+		name = h.Players[from].Name
+	}
+	switch msg := message.(type) {
+	case MsgBuild:
+		return fmt.Sprintf("%s built a %s at %d,%d", name, FeatureName(msg.Feature), msg.AtCell.X, msg.AtCell.Y)
+	case MsgExpand:
+		return fmt.Sprintf("%s expanded to %d,%d", name, msg.AtCell.X, msg.AtCell.Y)
+	case MsgAbandon:
+		return fmt.Sprintf("%s abandoned %d,%d", name, msg.AtCell.X, msg.AtCell.Y)
+	case MsgAttack:
+		if msg.Success {
+			return fmt.Sprintf("%s took %d,%d from us (%s)", name, msg.AtCell.X, msg.AtCell.Y, msg.Outcome)
+		}
+		return fmt.Sprintf("%s attacked %d,%d and failed (%s)", name, msg.AtCell.X, msg.AtCell.Y, msg.Outcome)
+	case MsgProposeAlliance:
+		return fmt.Sprintf("%s proposes an alliance (Y/N)", name)
+	case MsgProposePact:
+		return fmt.Sprintf("%s proposes a non-aggression pact for %d ticks (Y/N)", name, msg.Duration)
+	case MsgProposeTrade:
+		return fmt.Sprintf("%s proposes a trade agreement (Y/N)", name)
+	case MsgDemandTribute:
+		return fmt.Sprintf("%s demands %.1f gold tribute (Y/N)", name, msg.Amount)
+	case MsgDeclareWar:
+		if msg.ToID != h.Player.ID && h.HasTreaty(h.Players[msg.ToID], TreatyAlliance) {
+			return fmt.Sprintf("%s declares war on our ally %s (declare war to join them)", name, h.Players[msg.ToID].Name)
+		}
+		return fmt.Sprintf("%s declares war on %s", name, h.Players[msg.ToID].Name)
+	case MsgDiplomacyReply:
+		if msg.Accepted {
+			return fmt.Sprintf("%s accepts our %T", name, msg.Proposal)
+		}
+		return fmt.Sprintf("%s refuses our %T", name, msg.Proposal)
+	}
+	return fmt.Sprintf("%s: %v", name, message)
+}
+
+// Errors returned when a task can't be issued.
+var (
+	ErrNotOwned      = errors.New("we don't own this cell")
+	ErrOwned         = errors.New("this cell is already owned")
+	ErrNotAdjacent   = errors.New("this cell is not adjacent to our territory")
+	ErrNoTroops      = errors.New("no troops nearby")
+	ErrNotAllowed    = errors.New("this action is not allowed here")
+	ErrNotAffordable = errors.New("not enough gold")
+	ErrNoCapital     = errors.New("we have no capital")
+	ErrUnknownTech   = errors.New("unknown technology")
+	ErrTreaty        = errors.New("we have a treaty with this player, declare war first")
+)
+
+// NewTask creates a task for the given action at the given cell and checks if
+// it is valid. The argument is the feature for build tasks and the technology
+// for research tasks (which take place in the capital, regardless of the cell).
+// This is used to issue tasks on behalf of a human player, who then executes
+// them via AI.Do, just like the AI does.
+func (a *AI) NewTask(action string, at *Cell, arg int64) (Task, error) {
+	t := Task{
+		Action: action,
+		At:     at,
+	}
+	switch action {
+	case ActionBuild:
+		if at.ControlledBy != a.Player {
+			return t, ErrNotOwned
+		}
+		if !at.CanBuild(arg) {
+			return t, ErrNotAllowed
+		}
+		t.Payload = TaskBuild{Feature: arg}
+	case ActionExpand:
+		if at.IsOccupied() {
+			return t, ErrOwned
+		}
+		from := a.ownedNeighbor(at, false)
+		if from == nil {
+			return t, ErrNotAdjacent
+		}
+		t.Payload = TaskExpand{From: from}
+	case ActionAttack:
+		if !at.IsOccupied() || at.ControlledBy == a.Player {
+			return t, ErrNotAllowed
+		}
+		if a.HasTreaty(at.ControlledBy, TreatyPact|TreatyAlliance) {
+			return t, ErrTreaty
+		}
+		if a.ownedNeighbor(at, false) == nil {
+			return t, ErrNotAdjacent
+		}
+		from := a.ownedNeighbor(at, true)
+		if from == nil {
+			return t, ErrNoTroops
+		}
+		t.Payload = TaskAttack{From: from, On: at.ControlledBy}
+	case ActionAbandon:
+		if at.ControlledBy != a.Player {
+			return t, ErrNotOwned
+		}
+		if at.Type == &TypeCapital {
+			return t, ErrNotAllowed
+		}
+		t.Payload = TaskAbandon{}
+	case ActionRecruit:
+		if at.ControlledBy != a.Player {
+			return t, ErrNotOwned
+		}
+		if !at.CanRecruit() {
+			return t, ErrNotAllowed
+		}
+		t.Payload = TaskRecruit{Amount: RecruitBatch}
+	case ActionMove:
+		if at.ControlledBy != a.Player {
+			return t, ErrNotOwned
+		}
+		from := a.ownedNeighbor(at, true)
+		if from == nil {
+			return t, ErrNoTroops
+		}
+		t.Payload = TaskMove{From: from, Amount: from.Troops}
+	case ActionResearch:
+		tech := TechByID(arg)
+		if tech == nil {
+			return t, ErrUnknownTech
+		}
+		if !a.CanResearch(tech) {
+			return t, ErrNotAllowed
+		}
+		if t.At = a.capital(); t.At == nil {
+			return t, ErrNoCapital
+		}
+		t.Payload = TaskResearch{Tech: arg}
+	case ActionClear:
+		if at.ControlledBy != a.Player {
+			return t, ErrNotOwned
+		}
+		if !at.CanClear() {
+			return t, ErrNotAllowed
+		}
+		t.Payload = TaskClear{}
+	default:
+		return t, fmt.Errorf("unknown action %q", action)
+	}
+	if t.Cost() > a.Gold {
+		return t, ErrNotAffordable
+	}
+	a.logf("Player %s issues %s on %d,%d", a.Name, action, t.At.X, t.At.Y)
+	return t, nil
+}
+
+// ownedNeighbor returns the neighbor of the given cell that we own.
+// If withTroops is true, the neighbor with the most troops is returned.
+func (a *AI) ownedNeighbor(c *Cell, withTroops bool) *Cell {
+	var best *Cell
+	for _, n := range a.CellNeighbors(c.X, c.Y) {
+		if n.ControlledBy != a.Player {
+			continue
+		}
+		if !withTroops {
+			return n
+		}
+		if n.Troops > 0 && (best == nil || n.Troops > best.Troops) {
+			best = n
+		}
+	}
+	return best
+}
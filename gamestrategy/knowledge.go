@@ -0,0 +1,120 @@
+package gamestrategy
+
+const (
+	SightRadius  = 2  // How far a player can see from each owned cell
+	MessageRange = 10 // How far away a player notices what others do
+)
+
+// CellMemory is what a player remembers about a cell from the last time they
+// saw it.
+type CellMemory struct {
+	Seen         bool    // Has the cell ever been seen?
+	LastSeen     int     // Tick at which the cell was last seen
+	Type         *Type   // Type of the cell
+	ControlledBy *Player // Owner of the cell
+	Features     int64   // Features built on the cell
+	Troops       float64 // Troops stationed in the cell
+}
+
+// Knowledge is what a player knows about the grid.
+type Knowledge struct {
+	Visible []bool       // Is the cell currently visible?
+	Memory  []CellMemory // Last seen state of each cell
+}
+
+func newKnowledge(numCells int) *Knowledge {
+	return &Knowledge{
+		Visible: make([]bool, numCells),
+		Memory:  make([]CellMemory, numCells),
+	}
+}
+
+// sightRadius returns how far a player can see from the given cell.
+func (c *Cell) sightRadius() int {
+	r := SightRadius
+	if c.Type == &TypeCapital || c.Features&(FeatureSettlement|FeatureFort) != 0 {
+		r++
+	}
+	if c.Type == &TypeMountain {
+		r++
+	}
+	return r
+}
+
+// observe updates our memory of the given cell with its current state.
+func (a *AI) observe(c *Cell) {
+	a.Knowledge.Memory[c.Y*a.Width+c.X] = CellMemory{
+		Seen:         true,
+		LastSeen:     a.Ticks,
+		Type:         c.Type,
+		ControlledBy: c.ControlledBy,
+		Features:     c.Features,
+		Troops:       c.Troops,
+	}
+}
+
+// UpdateKnowledge updates the visible cells and our memory of them.
+func (a *AI) UpdateKnowledge() {
+	k := a.Knowledge
+	for i := range k.Visible {
+		k.Visible[i] = false
+	}
+	for i := range a.Cells {
+		c := &a.Cells[i]
+		if c.ControlledBy != a.Player {
+			continue
+		}
+		r := c.sightRadius()
+		for y := c.Y - r; y <= c.Y+r; y++ {
+			for x := c.X - r; x <= c.X+r; x++ {
+				if n := a.Cell(x, y); n != nil {
+					k.Visible[y*a.Width+x] = true
+				}
+			}
+		}
+	}
+	for i := range a.Cells {
+		if k.Visible[i] {
+			a.observe(&a.Cells[i])
+		}
+	}
+}
+
+// Known returns what we know about the given cell.
+func (a *AI) Known(c *Cell) *CellMemory {
+	return &a.Knowledge.Memory[c.Y*a.Width+c.X]
+}
+
+// knownStrength returns the military strength of the given player as far as
+// we know.
+func (a *AI) knownStrength(p *Player) float64 {
+	var strength float64
+	for _, m := range a.Knowledge.Memory {
+		if m.Seen && m.ControlledBy == p {
+			strength += m.Troops + StrengthPerCell
+		}
+	}
+	return strength
+}
+
+// InRange returns true if the given cell is close enough to our territory for
+// us to notice what happens there.
+func (a *AI) InRange(c *Cell) bool {
+	for i := range a.Cells {
+		o := &a.Cells[i]
+		if o.ControlledBy != a.Player {
+			continue
+		}
+		if abs(o.X-c.X) <= MessageRange && abs(o.Y-c.Y) <= MessageRange {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,220 @@
+package gamestrategy
+
+import "math"
+
+// MCTSStrategy uses Monte Carlo tree search to pick the task that maximizes
+// our gold and future yield over the given horizon.
+//
+// Each iteration simulates the game on a copy of the grid as far as we know
+// it (see CloneAsSeenBy), so the search can't see through the fog of war.
+// Our own tasks are picked by the search tree (and by the greedy strategy
+// once we leave the tree), while all other players use the greedy strategy.
+// The tree is open-loop, which means that nodes represent sequences of tasks
+// rather than game states, since combat outcomes and opponent moves are random.
+type MCTSStrategy struct {
+	Iterations  int     // Number of simulated games per decision
+	Horizon     int     // Number of ticks to simulate
+	Branching   int     // Number of candidate tasks considered per node
+	Exploration float64 // UCB1 exploration constant
+	Potential   float64 // Weight of the potential yield of features not built yet (beyond the horizon)
+}
+
+// NewMCTSStrategy returns a new MCTS strategy with default settings.
+func NewMCTSStrategy() *MCTSStrategy {
+	return &MCTSStrategy{
+		Iterations:  20,
+		Horizon:     8,
+		Branching:   5,
+		Exploration: math.Sqrt2,
+		Potential:   4.0,
+	}
+}
+
+// taskRef references a task by cell coordinates, so it can be replayed on
+// any clone of the grid.
+type taskRef struct {
+	Action  string
+	X, Y    int
+	Feature int64 // Feature to build or technology to research
+}
+
+func newTaskRef(t Task) *taskRef {
+	ref := &taskRef{
+		Action: t.Action,
+		X:      t.At.X,
+		Y:      t.At.Y,
+	}
+	switch p := t.Payload.(type) {
+	case TaskBuild:
+		ref.Feature = p.Feature
+	case TaskResearch:
+		ref.Feature = p.Tech
+	}
+	return ref
+}
+
+// task returns the referenced task for the given AI, if it is still valid.
+func (r *taskRef) task(a *AI) (Task, bool) {
+	c := a.Cell(r.X, r.Y)
+	if c == nil {
+		return Task{}, false
+	}
+	t, err := a.NewTask(r.Action, c, r.Feature)
+	return t, err == nil
+}
+
+type mctsNode struct {
+	move     *taskRef    // Task leading to this node (nil = do nothing)
+	children []*mctsNode // Expanded children
+	untried  []*taskRef  // Candidate tasks that have not been tried yet
+	expanded bool        // Have the candidate tasks been generated?
+	visits   int
+	value    float64 // Sum of rewards
+}
+
+// expand generates the candidate tasks for this node.
+func (n *mctsNode) expand(a *AI, branching int) {
+	n.expanded = true
+	n.untried = append(n.untried, nil) // Doing nothing is always an option.
+	seen := make(map[taskRef]bool)
+	for _, t := range a.possibleTasks() {
+		if len(n.untried) > branching {
+			break
+		}
+		if t.Cost() > a.Gold {
+			continue
+		}
+		ref := newTaskRef(t)
+		if seen[*ref] {
+			continue
+		}
+		seen[*ref] = true
+		n.untried = append(n.untried, ref)
+	}
+}
+
+// bestChild returns the child with the highest UCB1 score.
+// Rewards are normalized to [0, 1] using the given min and max reward.
+func (n *mctsNode) bestChild(exploration, minReward, maxReward float64) *mctsNode {
+	var best *mctsNode
+	bestScore := math.Inf(-1)
+	for _, c := range n.children {
+		mean := c.value / float64(c.visits)
+		if maxReward > minReward {
+			mean = (mean - minReward) / (maxReward - minReward)
+		}
+		score := mean + exploration*math.Sqrt(math.Log(float64(n.visits))/float64(c.visits))
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+// score returns the value of the current state for the AI, which is the gold
+// plus the expected income over the horizon and the potential yield of our
+// territory once all features are built.
+func (s *MCTSStrategy) score(a *AI) float64 {
+	var income, potential float64
+	for _, c := range a.Cells {
+		if c.ControlledBy == a.Player {
+			income += c.Yield() - c.Cost() - c.Upkeep()
+			potential += resourceYield(c.AllowedFeatures &^ c.Features)
+		}
+	}
+	return a.Gold + income*float64(s.Horizon) + potential*s.Potential
+}
+
+// simulate plays a single task (or nothing) and advances the simulation by a tick.
+func simulate(sim *Grid, me *AI, ref *taskRef) bool {
+	if ref != nil {
+		if t, ok := ref.task(me); ok {
+			me.Do(t)
+		}
+	}
+	return sim.Tick()
+}
+
+func (s *MCTSStrategy) NextTask(a *AI) (Task, bool) {
+	// Find our index so we can find ourselves in the clones.
+	idx := -1
+	for i, ai := range a.AIs {
+		if ai == a {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return Task{}, false
+	}
+
+	root := &mctsNode{}
+	minReward, maxReward := math.Inf(1), math.Inf(-1)
+	for i := 0; i < s.Iterations; i++ {
+		sim := a.Grid.CloneAsSeenBy(a)
+		sim.Silent = true
+		for _, ai := range sim.AIs {
+			ai.Strategy = GreedyStrategy{}
+		}
+		me := sim.AIs[idx]
+		me.Strategy = IdleStrategy{} // We pick our own tasks.
+		start := s.score(me)
+
+		// Selection and expansion.
+		path := []*mctsNode{root}
+		node := root
+		depth := 0
+		running := true
+		for depth < s.Horizon && running {
+			if !node.expanded {
+				node.expand(me, s.Branching)
+			}
+			if len(node.untried) > 0 {
+				// Expand a random untried task and leave the tree.
+				j := me.Rand.Intn(len(node.untried))
+				child := &mctsNode{move: node.untried[j]}
+				node.untried = append(node.untried[:j], node.untried[j+1:]...)
+				node.children = append(node.children, child)
+				path = append(path, child)
+				running = simulate(sim, me, child.move)
+				depth++
+				break
+			}
+			if len(node.children) == 0 {
+				break
+			}
+			node = node.bestChild(s.Exploration, minReward, maxReward)
+			path = append(path, node)
+			running = simulate(sim, me, node.move)
+			depth++
+		}
+
+		// Rollout using the greedy strategy.
+		me.Strategy = GreedyStrategy{}
+		for ; depth < s.Horizon && running; depth++ {
+			running = sim.Tick()
+		}
+
+		// Backpropagation.
+		reward := s.score(me) - start
+		minReward = min(minReward, reward)
+		maxReward = max(maxReward, reward)
+		for _, n := range path {
+			n.visits++
+			n.value += reward
+		}
+	}
+
+	// Pick the most visited task.
+	var best *mctsNode
+	for _, c := range root.children {
+		if best == nil || c.visits > best.visits {
+			best = c
+		}
+	}
+	if best == nil || best.move == nil {
+		return Task{}, false
+	}
+	a.logf("AI %s picks %s on %d,%d after %d simulations (avg reward %f)", a.Name, best.move.Action, best.move.X, best.move.Y, best.visits, best.value/float64(best.visits))
+	return best.move.task(a)
+}
@@ -6,9 +6,22 @@ type MsgReceiver interface {
 	Receive(from int, message any)
 }
 
+// Located is implemented by messages that refer to something happening at a
+// specific cell.
+type Located interface {
+	Location() *Cell
+}
+
+// Observer is implemented by receivers that only notice located messages if
+// they happen within range.
+type Observer interface {
+	InRange(c *Cell) bool
+}
+
 type Messenger struct {
 	Receivers []MsgReceiver
 	ByID      map[int]MsgReceiver
+	Tap       func(from int, to []int, message any) // Called for every message (e.g. for logging)
 }
 
 func NewMessenger() *Messenger {
@@ -27,10 +40,16 @@ func (m *Messenger) Broadcast(from int, message any) {
 }
 
 func (m *Messenger) Send(from int, to []int, message any) {
+	if m.Tap != nil {
+		m.Tap(from, to, message)
+	}
 	if len(to) == 0 {
-		// Broadcast to all receivers.
-		// TODO: Only broadcast if the receiver is in range?
+		// Broadcast to all receivers that are in range.
+		loc, isLocated := message.(Located)
 		for _, r := range m.Receivers {
+			if o, ok := r.(Observer); ok && isLocated && !o.InRange(loc.Location()) {
+				continue
+			}
 			r.Receive(from, message)
 		}
 		return
@@ -54,25 +73,34 @@ func (m Message) String() string {
 }
 
 type MsgAttack struct {
-	FromID  int   // Attacker
-	ToID    int   // Defender
-	AtCell  *Cell // Cell that was attacked
-	Success bool  // Did the attack succeed?
+	FromID  int           // Attacker
+	ToID    int           // Defender
+	AtCell  *Cell         // Cell that was attacked
+	Success bool          // Did the attack succeed?
+	Outcome CombatOutcome // Detailed outcome of the combat
 }
 
+func (m MsgAttack) Location() *Cell { return m.AtCell }
+
 type MsgBuild struct {
 	FromID  int   // Player
 	AtCell  *Cell // Cell that was built on
 	Feature int64 // Feature that was built
 }
 
+func (m MsgBuild) Location() *Cell { return m.AtCell }
+
 type MsgExpand struct {
 	FromID   int   // Player
 	FromCell *Cell // Cell that was expanded from
 	AtCell   *Cell // Cell that was expanded to
 }
 
+func (m MsgExpand) Location() *Cell { return m.AtCell }
+
 type MsgAbandon struct {
 	FromID int   // Player
 	AtCell *Cell // Cell that was abandoned
 }
+
+func (m MsgAbandon) Location() *Cell { return m.AtCell }
@@ -1,41 +1,45 @@
 package gamestrategy
 
-import (
-	"log"
-	"math/rand"
-)
-
 func (g *Grid) AddPlayer(p *Player) {
 	p.ID = len(g.Players)
-	log.Printf("Adding player %s with ID %d", p.Name, p.ID)
+	g.logf("Adding player %s with ID %d", p.Name, p.ID)
 	g.Players = append(g.Players, p)
 
 	// Find a random cell to start in that is not occupied
 	for {
-		c := g.Cell(rand.Intn(g.Width), rand.Intn(g.Height))
+		c := g.Cell(g.Rand.Intn(g.Width), g.Rand.Intn(g.Height))
 		if c == nil {
 			continue
 		}
 		if c.ControlledBy == nil && c.Type != &TypeWater {
 			c.Occupy(p)
 			c.Type = &TypeCapital
+			c.Troops = StartingTroops
 			break
 		}
 	}
 
 	// Add AI
+	// NOTE: Human players also get an AI, which executes the tasks issued by
+	// the human, but the AI won't act on its own.
 	ai := NewAI(p, g)
+	ai.UpdateKnowledge()
 	g.AIs = append(g.AIs, ai)
-	g.Messenger.Register(p.ID, ai)
-
-	// TODO: Register with messenger
-	log.Printf("Player %s added to grid", p.Name)
+	if p.Human {
+		g.Human = NewHuman(ai)
+		g.Messenger.Register(p.ID, g.Human)
+	} else {
+		g.Messenger.Register(p.ID, ai)
+	}
+	g.logf("Player %s added to grid", p.Name)
 }
 
 type Player struct {
-	ID   int
-	Name string
-	Gold float64
+	ID    int
+	Name  string
+	Gold  float64
+	Human bool  // Controlled by a human player
+	Techs int64 // Researched technologies
 }
 
 func NewPlayer(name string) *Player {
@@ -44,3 +48,10 @@ func NewPlayer(name string) *Player {
 		Gold: 100.0,
 	}
 }
+
+// NewHumanPlayer returns a new player that is controlled by a human.
+func NewHumanPlayer(name string) *Player {
+	p := NewPlayer(name)
+	p.Human = true
+	return p
+}
@@ -0,0 +1,144 @@
+package gamestrategy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Replay allows stepping forward and backward through a recorded event log.
+type Replay struct {
+	Width   int
+	Height  int
+	Players []string
+	Rivers  []bool
+	Cells   []CellChange // State of the cells at the current frame
+	Frame   int          // Current frame (0 = initial state)
+	frames  []replayFrame
+}
+
+// replayFrame holds the events of a tick and the changes to the grid.
+type replayFrame struct {
+	Tick     int
+	Events   []Event      // Events that happened during this tick
+	Gold     []float64    // Gold of each player at the end of the tick
+	forward  []CellChange // Changes to apply when stepping forward
+	backward []CellChange // Changes to apply when stepping backward
+}
+
+// LoadReplay reads an event log written by Grid.RecordEvents.
+func LoadReplay(r io.Reader) (*Replay, error) {
+	dec := json.NewDecoder(r)
+	var init Event
+	if err := dec.Decode(&init); err != nil {
+		return nil, err
+	}
+	if init.Kind != EventInit || init.Init == nil {
+		return nil, errors.New("event log doesn't start with an init event")
+	}
+	rp := &Replay{
+		Width:   init.Init.Width,
+		Height:  init.Init.Height,
+		Players: init.Init.Players,
+		Rivers:  make([]bool, init.Init.Width*init.Init.Height),
+		Cells:   init.Init.Cells,
+	}
+	if len(rp.Cells) != len(rp.Rivers) {
+		return nil, fmt.Errorf("expected %d cells, got %d", len(rp.Rivers), len(rp.Cells))
+	}
+	for _, i := range init.Init.Rivers {
+		if i >= 0 && i < len(rp.Rivers) {
+			rp.Rivers[i] = true
+		}
+	}
+
+	// Frame 0 is the initial state, without any events.
+	rp.frames = append(rp.frames, replayFrame{Tick: init.Tick})
+
+	// Collect the events of each tick and calculate the changes in both
+	// directions, so we can step backward as well.
+	state := make([]CellChange, len(rp.Cells))
+	copy(state, rp.Cells)
+	cur := replayFrame{Tick: init.Tick}
+	for {
+		var ev Event
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if ev.Kind != EventTick {
+			cur.Events = append(cur.Events, ev)
+			continue
+		}
+		if ev.Changes == nil {
+			return nil, fmt.Errorf("tick %d: missing changes", ev.Tick)
+		}
+		cur.Tick = ev.Tick
+		cur.Gold = ev.Changes.Gold
+		for _, c := range ev.Changes.Cells {
+			if c.Index < 0 || c.Index >= len(state) {
+				return nil, fmt.Errorf("tick %d: unknown cell %d", ev.Tick, c.Index)
+			}
+			cur.forward = append(cur.forward, c)
+			cur.backward = append(cur.backward, state[c.Index])
+			state[c.Index] = c
+		}
+		rp.frames = append(rp.frames, cur)
+		cur = replayFrame{Tick: ev.Tick + 1}
+	}
+	return rp, nil
+}
+
+// LoadReplayFile reads an event log from the given file.
+func LoadReplayFile(name string) (*Replay, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadReplay(f)
+}
+
+// Len returns the number of frames.
+func (r *Replay) Len() int {
+	return len(r.frames)
+}
+
+// Tick returns the tick of the current frame.
+func (r *Replay) Tick() int {
+	return r.frames[r.Frame].Tick
+}
+
+// Events returns the events that led to the current frame.
+func (r *Replay) Events() []Event {
+	return r.frames[r.Frame].Events
+}
+
+// Gold returns the gold of each player at the current frame.
+func (r *Replay) Gold() []float64 {
+	return r.frames[r.Frame].Gold
+}
+
+// Step moves the given number of frames forward (or backward if negative).
+func (r *Replay) Step(n int) {
+	for ; n > 0 && r.Frame < len(r.frames)-1; n-- {
+		r.Frame++
+		for _, c := range r.frames[r.Frame].forward {
+			r.Cells[c.Index] = c
+		}
+	}
+	for ; n < 0 && r.Frame > 0; n++ {
+		for _, c := range r.frames[r.Frame].backward {
+			r.Cells[c.Index] = c
+		}
+		r.Frame--
+	}
+}
+
+// Seek moves to the given frame.
+func (r *Replay) Seek(frame int) {
+	r.Step(frame - r.Frame)
+}
@@ -0,0 +1,166 @@
+package gamestrategy
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/mazznoer/colorgrad"
+)
+
+// maxReplayEvents is the maximum number of events shown in the replay viewer.
+const maxReplayEvents = 20
+
+// ReplayViewer is a front-end to step through a recorded game.
+// Use the arrow keys to step forward and backward (up and down skip ten
+// frames), space to play and pause, tab to only show the events of a single
+// player and click on a cell to inspect it.
+type ReplayViewer struct {
+	*Replay
+	Selected int  // Index of the selected cell (-1 = none)
+	Filter   int  // Only show events of this player (-1 = all)
+	Playing  bool // Advance automatically
+	colors   []color.Color
+}
+
+// NewReplayViewer returns a new viewer for the given replay.
+func NewReplayViewer(r *Replay) *ReplayViewer {
+	return &ReplayViewer{
+		Replay:   r,
+		Selected: -1,
+		Filter:   -1,
+		colors:   colorgrad.Rainbow().Colors(uint(len(r.Players) + 1)),
+	}
+}
+
+func (v *ReplayViewer) Update() error {
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		x, y := ebiten.CursorPosition()
+		if x/tileSize < v.Width && y/tileSize < v.Height {
+			v.Selected = (y/tileSize)*v.Width + x/tileSize
+		}
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		v.Step(1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		v.Step(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		v.Step(10)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		v.Step(-10)
+	case inpututil.IsKeyJustPressed(ebiten.KeySpace):
+		v.Playing = !v.Playing
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		if v.Filter++; v.Filter >= len(v.Players) {
+			v.Filter = -1
+		}
+	}
+	if v.Playing {
+		v.Step(1)
+	}
+	return nil
+}
+
+func (v *ReplayViewer) Draw(screen *ebiten.Image) {
+	for i, c := range v.Cells {
+		x, y := float64((i%v.Width)*tileSize), float64((i/v.Width)*tileSize)
+		var col color.Color = color.Black
+		if t := typeByName(c.Type); t != nil {
+			col = t.Color
+		}
+		if c.Owner >= 0 && c.Owner < len(v.colors) {
+			col = v.colors[c.Owner]
+		}
+		ebitenutil.DrawRect(screen, x, y, tileSize, tileSize, col)
+		if v.Rivers[i] {
+			ebitenutil.DrawRect(screen, x+1, y+1, tileSize-2, tileSize-2, RiverColor)
+		}
+		if c.Troops > 0 {
+			ebitenutil.DrawRect(screen, x+2, y+2, 2, 2, color.Black)
+		}
+	}
+
+	// Highlight the selected cell and the cells of the events.
+	for _, ev := range v.filteredEvents() {
+		if ev.Kind == EventTask {
+			ebitenutil.DrawRect(screen, float64(ev.Task.X*tileSize+1), float64(ev.Task.Y*tileSize+1), tileSize-2, tileSize-2, color.White)
+		}
+	}
+	if v.Selected >= 0 {
+		x, y := v.Selected%v.Width, v.Selected/v.Width
+		ebitenutil.DrawRect(screen, float64(x*tileSize-1), float64(y*tileSize-1), tileSize+2, tileSize+2, color.White)
+	}
+
+	ebitenutil.DebugPrintAt(screen, v.info(), panelX, 0)
+}
+
+// filteredEvents returns the events of the current frame that match the filter.
+func (v *ReplayViewer) filteredEvents() []Event {
+	if v.Filter == -1 {
+		return v.Events()
+	}
+	var events []Event
+	for _, ev := range v.Events() {
+		if ev.Player == v.Filter {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// info returns the text for the info panel.
+func (v *ReplayViewer) info() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "REPLAY FRAME %d/%d TICK %d\n", v.Frame, v.Len()-1, v.Tick())
+	if v.Playing {
+		sb.WriteString("PLAYING\n")
+	}
+
+	sb.WriteString("\nPLAYERS\n")
+	gold := v.Gold()
+	for i, name := range v.Players {
+		if i < len(gold) {
+			fmt.Fprintf(&sb, "P%d %s: %.1f gold\n", i, name, gold[i])
+		} else {
+			fmt.Fprintf(&sb, "P%d %s\n", i, name)
+		}
+	}
+
+	if v.Selected >= 0 {
+		c := v.Cells[v.Selected]
+		owner := "nobody"
+		if c.Owner >= 0 && c.Owner < len(v.Players) {
+			owner = v.Players[c.Owner]
+		}
+		var features []string
+		for _, f := range splitFeatures(c.Features) {
+			features = append(features, FeatureName(f))
+		}
+		fmt.Fprintf(&sb, "\nCELL %d,%d %s\nOWNER  %s\nTROOPS %.1f\nBUILT  %s\n", v.Selected%v.Width, v.Selected/v.Width, c.Type, owner, c.Troops, strings.Join(features, ","))
+	}
+
+	filter := "ALL"
+	if v.Filter >= 0 {
+		filter = fmt.Sprintf("P%d", v.Filter)
+	}
+	events := v.filteredEvents()
+	fmt.Fprintf(&sb, "\nEVENTS (%s, %d)\n", filter, len(events))
+	for i, ev := range events {
+		if i == maxReplayEvents {
+			fmt.Fprintf(&sb, "... %d more\n", len(events)-i)
+			break
+		}
+		sb.WriteString(ev.String() + "\n")
+	}
+
+	sb.WriteString("\nKEYS\nLEFT/RIGHT STEP  DOWN/UP 10\nSPACE PLAY  TAB FILTER PLAYER\n")
+	return sb.String()
+}
+
+func (v *ReplayViewer) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return ScreenWidth, ScreenHeight
+}
@@ -0,0 +1,415 @@
+package gamestrategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+)
+
+// SaveVersion is the version of the save game format.
+// Increment it whenever the format changes in an incompatible way.
+const SaveVersion = 3
+
+// Types is a list of all cell types, used to look up types by name.
+var Types = []*Type{
+	&TypeCapital,
+	&TypeWater,
+	&TypeCoast,
+	&TypeMeadow,
+	&TypeForest,
+	&TypeMountain,
+	&TypeDesert,
+}
+
+// typeByName returns the cell type with the given name.
+func typeByName(name string) *Type {
+	for _, t := range Types {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+type saveGame struct {
+	Version int
+	Width   int
+	Height  int
+	Ticks   int
+	Seed    int64 // Seed for the random number generator when resuming
+	Cells   []saveCell
+	Players []savePlayer
+	AIs     []saveAI
+	Human   *saveHuman `json:",omitempty"`
+}
+
+type saveCell struct {
+	Type        string
+	Elevation   float64
+	Moisture    float64
+	Temperature float64
+	River       bool
+	Owner       int // Player ID or -1
+	Features    int64
+	Troops      float64
+}
+
+type savePlayer struct {
+	Name  string
+	Gold  float64
+	Human bool
+	Techs int64
+}
+
+type saveAI struct {
+	Player      int
+	Modifiers   map[string]float64
+	Opinion     map[int]float64 // Player ID -> opinion
+	Treaties    map[int]int64   // Player ID -> treaties
+	PactExpires map[int]int     // Player ID -> tick
+	Memory      []saveMemory    // Cells that the AI has seen
+	Strategy    string          // greedy, idle, mcts
+	MCTS        *MCTSStrategy   `json:",omitempty"`
+}
+
+type saveMemory struct {
+	Index    int
+	LastSeen int
+	Type     string
+	Owner    int // Player ID or -1
+	Features int64
+	Troops   float64
+}
+
+type saveHuman struct {
+	Inbox   []string
+	Pending []saveProposal
+}
+
+type saveProposal struct {
+	From     int
+	Kind     string  // alliance, pact, trade, tribute
+	Duration int     `json:",omitempty"` // Pact duration
+	Amount   float64 `json:",omitempty"` // Tribute demanded
+}
+
+// newSaveProposal converts a pending proposal for saving.
+func newSaveProposal(p Proposal) (saveProposal, error) {
+	sp := saveProposal{From: p.FromID}
+	switch msg := p.Proposal.(type) {
+	case MsgProposeAlliance:
+		sp.Kind = "alliance"
+	case MsgProposePact:
+		sp.Kind = "pact"
+		sp.Duration = msg.Duration
+	case MsgProposeTrade:
+		sp.Kind = "trade"
+	case MsgDemandTribute:
+		sp.Kind = "tribute"
+		sp.Amount = msg.Amount
+	default:
+		return sp, fmt.Errorf("can't save proposal %T", msg)
+	}
+	return sp, nil
+}
+
+// proposal restores the pending proposal to the given player.
+func (sp saveProposal) proposal(to int) (Proposal, error) {
+	p := Proposal{FromID: sp.From}
+	switch sp.Kind {
+	case "alliance":
+		p.Proposal = MsgProposeAlliance{FromID: sp.From, ToID: to}
+	case "pact":
+		p.Proposal = MsgProposePact{FromID: sp.From, ToID: to, Duration: sp.Duration}
+	case "trade":
+		p.Proposal = MsgProposeTrade{FromID: sp.From, ToID: to}
+	case "tribute":
+		p.Proposal = MsgDemandTribute{FromID: sp.From, ToID: to, Amount: sp.Amount}
+	default:
+		return p, fmt.Errorf("unknown proposal %q", sp.Kind)
+	}
+	return p, nil
+}
+
+func playerID(p *Player) int {
+	if p == nil {
+		return -1
+	}
+	return p.ID
+}
+
+// Save writes the complete game state as JSON.
+//
+// NOTE: The state of the random number generator can't be saved, so the grid
+// is reseeded with a new seed that is stored in the save game. This way, the
+// saved and the loaded game continue in exactly the same way.
+func (g *Grid) Save(w io.Writer) error {
+	seed := g.Rand.Int63()
+	g.Rand = rand.New(rand.NewSource(seed))
+
+	sg := saveGame{
+		Version: SaveVersion,
+		Width:   g.Width,
+		Height:  g.Height,
+		Ticks:   g.Ticks,
+		Seed:    seed,
+	}
+	for _, c := range g.Cells {
+		sg.Cells = append(sg.Cells, saveCell{
+			Type:        c.Type.Name,
+			Elevation:   c.Elevation,
+			Moisture:    c.Moisture,
+			Temperature: c.Temperature,
+			River:       c.River,
+			Owner:       playerID(c.ControlledBy),
+			Features:    c.Features,
+			Troops:      c.Troops,
+		})
+	}
+	for _, p := range g.Players {
+		sg.Players = append(sg.Players, savePlayer{
+			Name:  p.Name,
+			Gold:  p.Gold,
+			Human: p.Human,
+			Techs: p.Techs,
+		})
+	}
+	for _, ai := range g.AIs {
+		sa := saveAI{
+			Player:      ai.Player.ID,
+			Modifiers:   ai.DesirabilityModifiers,
+			Opinion:     make(map[int]float64),
+			Treaties:    make(map[int]int64),
+			PactExpires: make(map[int]int),
+		}
+		for p, v := range ai.Opinion {
+			sa.Opinion[p.ID] = v
+		}
+		for p, v := range ai.Treaties {
+			sa.Treaties[p.ID] = v
+		}
+		for p, v := range ai.PactExpires {
+			sa.PactExpires[p.ID] = v
+		}
+		for i, m := range ai.Knowledge.Memory {
+			if !m.Seen {
+				continue
+			}
+			sa.Memory = append(sa.Memory, saveMemory{
+				Index:    i,
+				LastSeen: m.LastSeen,
+				Type:     m.Type.Name,
+				Owner:    playerID(m.ControlledBy),
+				Features: m.Features,
+				Troops:   m.Troops,
+			})
+		}
+		switch s := ai.Strategy.(type) {
+		case GreedyStrategy:
+			sa.Strategy = "greedy"
+		case IdleStrategy:
+			sa.Strategy = "idle"
+		case *MCTSStrategy:
+			sa.Strategy = "mcts"
+			sa.MCTS = s
+		default:
+			return fmt.Errorf("can't save strategy %T", s)
+		}
+		sg.AIs = append(sg.AIs, sa)
+	}
+	if h := g.Human; h != nil {
+		sg.Human = &saveHuman{Inbox: h.Inbox}
+		for _, p := range h.Pending {
+			sp, err := newSaveProposal(p)
+			if err != nil {
+				return err
+			}
+			sg.Human.Pending = append(sg.Human.Pending, sp)
+		}
+	}
+	return json.NewEncoder(w).Encode(sg)
+}
+
+// Load reads a game state written by Save and returns the resumed grid.
+func Load(r io.Reader) (*Grid, error) {
+	var sg saveGame
+	if err := json.NewDecoder(r).Decode(&sg); err != nil {
+		return nil, err
+	}
+	if sg.Version != SaveVersion {
+		return nil, fmt.Errorf("unsupported save game version %d (expected %d)", sg.Version, SaveVersion)
+	}
+	if len(sg.Cells) != sg.Width*sg.Height {
+		return nil, fmt.Errorf("expected %d cells, got %d", sg.Width*sg.Height, len(sg.Cells))
+	}
+
+	g := &Grid{
+		Width:      sg.Width,
+		Height:     sg.Height,
+		Ticks:      sg.Ticks,
+		Rand:       rand.New(rand.NewSource(sg.Seed)),
+		webpExport: newWebPExport(sg.Width, sg.Height),
+		Messenger:  NewMessenger(),
+	}
+
+	// Look up players by ID.
+	player := func(id int) (*Player, error) {
+		if id == -1 {
+			return nil, nil
+		}
+		if id < 0 || id >= len(g.Players) {
+			return nil, fmt.Errorf("unknown player %d", id)
+		}
+		return g.Players[id], nil
+	}
+	for i, sp := range sg.Players {
+		g.Players = append(g.Players, &Player{
+			ID:    i,
+			Name:  sp.Name,
+			Gold:  sp.Gold,
+			Human: sp.Human,
+			Techs: sp.Techs,
+		})
+	}
+
+	g.Cells = make([]Cell, len(sg.Cells))
+	for i, sc := range sg.Cells {
+		c := &g.Cells[i]
+		c.X = i % g.Width
+		c.Y = i / g.Width
+		c.Elevation = sc.Elevation
+		c.Moisture = sc.Moisture
+		c.Temperature = sc.Temperature
+		c.River = sc.River
+		c.Features = sc.Features
+		c.Troops = sc.Troops
+		if c.Type = typeByName(sc.Type); c.Type == nil {
+			return nil, fmt.Errorf("cell %d,%d: unknown type %q", c.X, c.Y, sc.Type)
+		}
+		var err error
+		if c.ControlledBy, err = player(sc.Owner); err != nil {
+			return nil, fmt.Errorf("cell %d,%d: %w", c.X, c.Y, err)
+		}
+	}
+
+	for _, sa := range sg.AIs {
+		p, err := player(sa.Player)
+		if err != nil || p == nil {
+			return nil, fmt.Errorf("AI: unknown player %d", sa.Player)
+		}
+		ai := NewAI(p, g)
+		for k, v := range sa.Modifiers {
+			ai.DesirabilityModifiers[k] = v
+		}
+		for id, v := range sa.Opinion {
+			op, err := player(id)
+			if err != nil || op == nil {
+				return nil, fmt.Errorf("AI %s: opinion of unknown player %d", p.Name, id)
+			}
+			ai.Opinion[op] = v
+		}
+		for id, v := range sa.Treaties {
+			op, err := player(id)
+			if err != nil || op == nil {
+				return nil, fmt.Errorf("AI %s: treaty with unknown player %d", p.Name, id)
+			}
+			ai.Treaties[op] = v
+		}
+		for id, v := range sa.PactExpires {
+			op, err := player(id)
+			if err != nil || op == nil {
+				return nil, fmt.Errorf("AI %s: pact with unknown player %d", p.Name, id)
+			}
+			ai.PactExpires[op] = v
+		}
+		for _, sm := range sa.Memory {
+			if sm.Index < 0 || sm.Index >= len(g.Cells) {
+				return nil, fmt.Errorf("AI %s: memory of unknown cell %d", p.Name, sm.Index)
+			}
+			owner, err := player(sm.Owner)
+			if err != nil {
+				return nil, fmt.Errorf("AI %s: %w", p.Name, err)
+			}
+			m := CellMemory{
+				Seen:         true,
+				LastSeen:     sm.LastSeen,
+				Type:         typeByName(sm.Type),
+				ControlledBy: owner,
+				Features:     sm.Features,
+				Troops:       sm.Troops,
+			}
+			if m.Type == nil {
+				return nil, fmt.Errorf("AI %s: memory of cell %d: unknown type %q", p.Name, sm.Index, sm.Type)
+			}
+			ai.Knowledge.Memory[sm.Index] = m
+		}
+		ai.UpdateKnowledge()
+		switch sa.Strategy {
+		case "greedy":
+			ai.Strategy = GreedyStrategy{}
+		case "idle":
+			ai.Strategy = IdleStrategy{}
+		case "mcts":
+			if sa.MCTS == nil {
+				sa.MCTS = NewMCTSStrategy()
+			}
+			ai.Strategy = sa.MCTS
+		default:
+			return nil, fmt.Errorf("AI %s: unknown strategy %q", p.Name, sa.Strategy)
+		}
+
+		g.AIs = append(g.AIs, ai)
+		if p.Human {
+			g.Human = NewHuman(ai)
+			g.Messenger.Register(p.ID, g.Human)
+		} else {
+			g.Messenger.Register(p.ID, ai)
+		}
+	}
+
+	// Restore the inbox and the proposals waiting for an answer.
+	if sh := sg.Human; sh != nil && g.Human != nil {
+		g.Human.Inbox = sh.Inbox
+		for _, sp := range sh.Pending {
+			if _, err := player(sp.From); err != nil || sp.From == -1 {
+				return nil, fmt.Errorf("proposal from unknown player %d", sp.From)
+			}
+			p, err := sp.proposal(g.Human.Player.ID)
+			if err != nil {
+				return nil, err
+			}
+			g.Human.Pending = append(g.Human.Pending, p)
+		}
+	}
+
+	// NewAI draws random modifiers, so we seed the generator once all AIs
+	// have been restored.
+	g.Rand = rand.New(rand.NewSource(sg.Seed))
+	g.logf("Loaded game at tick %d with %d players", g.Ticks, len(g.Players))
+	return g, nil
+}
+
+// SaveFile writes the game state to the given file.
+func (g *Grid) SaveFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := g.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadFile reads a game state from the given file.
+func LoadFile(name string) (*Grid, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
@@ -0,0 +1,182 @@
+package gamestrategy
+
+import "strings"
+
+// Technologies that can be researched.
+const (
+	TechNone   = 0
+	TechMining = 1 << iota
+	TechIrrigation
+	TechMasonry
+	TechTactics
+	TechForestry
+)
+
+const (
+	IrrigationYield = 1.0  // Additional yield of farms with irrigation
+	TacticsBonus    = 1.25 // Attack strength multiplier with tactics
+	ClearCost       = 3.0  // Multiplier of the cell cost for clearing a forest
+)
+
+// Tech is a technology that can be researched by investing gold.
+type Tech struct {
+	ID       int64   // Bit of the technology
+	Name     string  // Name of the technology
+	Cost     float64 // Gold required to research the technology
+	Requires int64   // Technologies required before this one can be researched
+	Favors   string  // Action that benefits from the technology (drives the AI's interest)
+}
+
+// Techs is the research tree.
+var Techs = []*Tech{
+	{ID: TechMining, Name: "mining", Cost: 40, Favors: ActionBuild},
+	{ID: TechIrrigation, Name: "irrigation", Cost: 30, Favors: ActionBuild},
+	{ID: TechMasonry, Name: "masonry", Cost: 40, Favors: ActionRecruit},
+	{ID: TechTactics, Name: "tactics", Cost: 60, Requires: TechMasonry, Favors: ActionAttack},
+	{ID: TechForestry, Name: "forestry", Cost: 50, Favors: ActionExpand},
+}
+
+// TechByID returns the technology with the given ID.
+func TechByID(id int64) *Tech {
+	for _, t := range Techs {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// techNames returns the names of the given technologies.
+func techNames(techs int64) string {
+	var names []string
+	for _, t := range Techs {
+		if techs&t.ID != 0 {
+			names = append(names, t.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// featureTech returns the technology required to build the given feature.
+func featureTech(f int64) int64 {
+	switch f {
+	case FeatureMine:
+		return TechMining
+	case FeatureFort:
+		return TechMasonry
+	}
+	return TechNone
+}
+
+// HasTech returns true if the player has researched the given technology.
+func (p *Player) HasTech(tech int64) bool {
+	return p.Techs&tech == tech
+}
+
+// CanResearch returns true if the player can research the given technology.
+func (p *Player) CanResearch(t *Tech) bool {
+	return !p.HasTech(t.ID) && p.HasTech(t.Requires)
+}
+
+// CanBuild returns true if the given feature can be built on the cell by its
+// owner.
+func (c *Cell) CanBuild(f int64) bool {
+	if f&c.AllowedFeatures == 0 || f&c.Features != 0 {
+		return false
+	}
+	return c.ControlledBy == nil || c.ControlledBy.HasTech(featureTech(f))
+}
+
+// CanClear returns true if the forest on this cell can be cleared by its owner.
+func (c *Cell) CanClear() bool {
+	return c.Type == &TypeForest && c.ControlledBy != nil && c.ControlledBy.HasTech(TechForestry)
+}
+
+// capital returns the capital of the AI's player (or nil if we lost it).
+func (a *AI) capital() *Cell {
+	for i := range a.Cells {
+		if c := &a.Cells[i]; c.ControlledBy == a.Player && c.Type == &TypeCapital {
+			return c
+		}
+	}
+	return nil
+}
+
+// Research invests gold into the given technology.
+func (a *AI) Research(payload TaskResearch) {
+	t := TechByID(payload.Tech)
+	if t == nil || !a.CanResearch(t) {
+		return
+	}
+	a.logf("AI %s researches %s for %f", a.Name, t.Name, t.Cost)
+	a.Gold -= t.Cost
+	a.Techs |= t.ID
+}
+
+// Clear clears the forest on the given cell, which turns it into a meadow.
+// Any lumber mill is lost in the process.
+func (a *AI) Clear(c *Cell, payload TaskClear) {
+	if !c.CanClear() {
+		return
+	}
+	a.logf("AI %s clears the forest on %d,%d", a.Name, c.X, c.Y)
+	a.Gold -= c.Type.Cost * ClearCost
+	c.Type = &TypeMeadow
+	c.Features &= TypeMeadow.AllowedFeatures
+}
+
+// researchTasks returns the research tasks that the AI might consider.
+// The desirability is the estimated benefit per tick, weighted by how much
+// the AI likes the action that the technology favors.
+func (a *AI) researchTasks(proximityToHostiles []float64) []Task {
+	capital := a.capital()
+	if capital == nil {
+		return nil
+	}
+
+	// Estimate the benefit of each technology based on our territory.
+	var mineable, farms, forests, proximity, troops float64
+	for i := range a.Cells {
+		c := &a.Cells[i]
+		if c.ControlledBy != a.Player {
+			continue
+		}
+		if c.AllowedFeatures&FeatureMine != 0 && c.Features&FeatureMine == 0 {
+			mineable++
+		}
+		if c.Features&FeatureFarm != 0 {
+			farms++
+		}
+		if c.Type == &TypeForest && c.Features&FeatureLumber == 0 {
+			forests++
+		}
+		proximity = max(proximity, proximityToHostiles[i])
+		troops += c.Troops
+	}
+	benefit := map[int64]float64{
+		TechMining:     mineable * resourceYield(FeatureMine),
+		TechIrrigation: farms * IrrigationYield,
+		TechMasonry:    proximity * 2,
+		TechTactics:    proximity * troops * (TacticsBonus - 1),
+		TechForestry:   forests * (TypeForest.Cost - TypeMeadow.Cost),
+	}
+
+	var tasks []Task
+	for _, tech := range Techs {
+		if !a.CanResearch(tech) || a.Gold < tech.Cost || benefit[tech.ID] <= 0 {
+			continue
+		}
+		tasks = append(tasks, Task{
+			Action:       ActionResearch,
+			At:           capital,
+			Desirability: a.DesirabilityModifiers[ActionResearch] * a.DesirabilityModifiers[tech.Favors] * benefit[tech.ID],
+			Payload: TaskResearch{
+				Tech: tech.ID,
+			},
+		})
+	}
+	return tasks
+}
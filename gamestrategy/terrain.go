@@ -0,0 +1,120 @@
+package gamestrategy
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/ojrac/opensimplex-go"
+)
+
+const (
+	SeaLevel      = 0.35 // Cells below this elevation are water
+	MountainLevel = 0.68 // Cells above this elevation are mountains
+	RiverSource   = 0.6  // Minimum elevation of a river source
+	CellsPerRiver = 400  // Number of cells per river source
+	RiverYield    = 1.0  // Additional yield of cells with a river
+	RiverCrossing = 1.5  // Movement cost multiplier for cells with a river
+	RiverDefense  = 1.2  // Defense multiplier for cells with a river
+)
+
+// RiverColor is the color used to draw rivers.
+var RiverColor = color.RGBA{R: 0x40, G: 0x80, B: 0xff, A: 0xff}
+
+// generateTerrain generates the terrain of the grid from an elevation,
+// moisture and temperature layer and traces rivers from the highlands down
+// to the sea.
+func (g *Grid) generateTerrain(seed int64) {
+	elevation := opensimplex.NewNormalized(seed)
+	moisture := opensimplex.NewNormalized(seed + 1)
+	temperature := opensimplex.NewNormalized(seed + 2)
+
+	// fbm returns fractal noise in the range [0, 1] with the given number of octaves.
+	fbm := func(n opensimplex.Noise, x, y, scale float64, octaves int) float64 {
+		var val, amp, sum float64 = 0, 1, 0
+		for i := 0; i < octaves; i++ {
+			val += n.Eval2(x*scale/float64(g.Width), y*scale/float64(g.Height)) * amp
+			sum += amp
+			scale *= 2
+			amp /= 2
+		}
+		return val / sum
+	}
+
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			c := g.Cell(x, y)
+			c.X = x
+			c.Y = y
+			c.Elevation = fbm(elevation, float64(x), float64(y), 2, 4)
+			c.Moisture = fbm(moisture, float64(x), float64(y), 3, 2)
+
+			// It gets warmer towards the center (equator) of the map and
+			// colder with increasing elevation.
+			lat := math.Abs(float64(y)/float64(g.Height)-0.5) * 2
+			c.Temperature = 0.5*(1-lat) + 0.5*fbm(temperature, float64(x), float64(y), 2, 2)
+			c.Temperature -= math.Max(0, c.Elevation-SeaLevel) * 0.5
+		}
+	}
+
+	g.traceRivers()
+
+	for i := range g.Cells {
+		c := &g.Cells[i]
+		c.Type = g.terrainType(c)
+	}
+	g.logf("Grid created with %d cells", len(g.Cells))
+}
+
+// terrainType returns the cell type based on elevation, moisture and temperature.
+func (g *Grid) terrainType(c *Cell) *Type {
+	if c.Elevation < SeaLevel {
+		return &TypeWater
+	}
+	if c.Elevation > MountainLevel {
+		return &TypeMountain
+	}
+	for _, nb := range g.CellNeighbors(c.X, c.Y) {
+		if nb.Elevation < SeaLevel {
+			return &TypeCoast
+		}
+	}
+	moisture := c.Moisture
+	if c.River {
+		moisture += 0.3 // Rivers irrigate the surrounding land.
+	}
+	if moisture < 0.35 && c.Temperature > 0.4 {
+		return &TypeDesert
+	}
+	if moisture > 0.55 {
+		return &TypeForest
+	}
+	return &TypeMeadow
+}
+
+// traceRivers picks random sources in the highlands and follows the steepest
+// descent until the river reaches the sea (or another river).
+// If the river gets stuck in a sink, it ends there.
+func (g *Grid) traceRivers() {
+	var sources []*Cell
+	for i := range g.Cells {
+		if c := &g.Cells[i]; c.Elevation > RiverSource {
+			sources = append(sources, c)
+		}
+	}
+	numRivers := len(g.Cells) / CellsPerRiver
+	for i := 0; i < numRivers && len(sources) > 0; i++ {
+		j := g.Rand.Intn(len(sources))
+		c := sources[j]
+		sources = append(sources[:j], sources[j+1:]...)
+		for c != nil && !c.River && c.Elevation >= SeaLevel {
+			c.River = true
+			var next *Cell
+			for _, nb := range g.CellNeighbors(c.X, c.Y) {
+				if nb.Elevation < c.Elevation && (next == nil || nb.Elevation < next.Elevation) {
+					next = nb
+				}
+			}
+			c = next
+		}
+	}
+}
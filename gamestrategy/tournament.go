@@ -0,0 +1,434 @@
+package gamestrategy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Profile is an AI personality that can compete in a tournament.
+type Profile struct {
+	Name      string             // Name of the profile
+	Modifiers map[string]float64 // Desirability modifiers (missing actions default to 1.0)
+	Strategy  func() Strategy    // Creates the strategy (nil = greedy)
+}
+
+// DefaultProfiles is a set of AI personalities to compare.
+var DefaultProfiles = []Profile{
+	{
+		Name: "balanced",
+	}, {
+		Name: "aggressive",
+		Modifiers: map[string]float64{
+			ActionAttack:  1.5,
+			ActionRecruit: 1.3,
+			ActionMove:    1.3,
+		},
+	}, {
+		Name: "builder",
+		Modifiers: map[string]float64{
+			ActionBuild:  1.5,
+			ActionExpand: 0.8,
+			ActionAttack: 0.8,
+		},
+	}, {
+		Name: "expansionist",
+		Modifiers: map[string]float64{
+			ActionExpand: 1.5,
+			ActionBuild:  0.9,
+		},
+	},
+}
+
+// apply sets the modifiers and strategy of the profile on the given AI.
+func (p *Profile) apply(ai *AI) {
+	for action := range ai.DesirabilityModifiers {
+		ai.DesirabilityModifiers[action] = 1.0
+	}
+	for action, mod := range p.Modifiers {
+		ai.DesirabilityModifiers[action] = mod
+	}
+	if p.Strategy != nil {
+		ai.Strategy = p.Strategy()
+	}
+}
+
+// TournamentConfig configures a tournament.
+type TournamentConfig struct {
+	Width       int   // Width of the grid
+	Height      int   // Height of the grid
+	Games       int   // Number of games to play
+	MaxTicks    int   // Maximum number of ticks per game
+	SampleEvery int   // Number of ticks between samples of territory and gold
+	Seed        int64 // Seed of the first game (each game uses Seed + game index)
+}
+
+// DefaultTournamentConfig returns a configuration for a quick tournament.
+func DefaultTournamentConfig() TournamentConfig {
+	return TournamentConfig{
+		Width:       64,
+		Height:      64,
+		Games:       20,
+		MaxTicks:    1000,
+		SampleEvery: 50,
+		Seed:        1,
+	}
+}
+
+// ProfileStats holds the results of a profile over all games of a tournament.
+type ProfileStats struct {
+	Profile        string
+	Games          int
+	Wins           int
+	SurvivalTicks  []int     // Number of ticks survived in each game
+	FinalTerritory []int     // Number of cells owned at the end of each game
+	FinalGold      []float64 // Gold at the end of each game
+	TerritoryCurve []float64 // Average number of cells owned at each sample
+	GoldCurve      []float64 // Average gold at each sample
+}
+
+// WinRate returns the fraction of games won.
+func (s *ProfileStats) WinRate() float64 {
+	if s.Games == 0 {
+		return 0
+	}
+	return float64(s.Wins) / float64(s.Games)
+}
+
+// AvgSurvival returns the average number of ticks survived.
+func (s *ProfileStats) AvgSurvival() float64 {
+	return avgInts(s.SurvivalTicks)
+}
+
+// AvgTerritory returns the average number of cells owned at the end of a game.
+func (s *ProfileStats) AvgTerritory() float64 {
+	return avgInts(s.FinalTerritory)
+}
+
+// AvgGold returns the average gold at the end of a game.
+func (s *ProfileStats) AvgGold() float64 {
+	if len(s.FinalGold) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, g := range s.FinalGold {
+		sum += g
+	}
+	return sum / float64(len(s.FinalGold))
+}
+
+func avgInts(vals []int) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	var sum int
+	for _, v := range vals {
+		sum += v
+	}
+	return float64(sum) / float64(len(vals))
+}
+
+// z95 is the z-score of a two-sided 95% confidence interval.
+const z95 = 1.96
+
+// Estimate is the sample mean of a metric over all games, with its standard
+// deviation and the standard error of the mean.
+type Estimate struct {
+	N      int     // Number of samples (games)
+	Mean   float64 // Sample mean
+	StdDev float64 // Sample standard deviation
+	StdErr float64 // Standard error of the mean
+}
+
+// newEstimate returns the estimate of the given samples.
+func newEstimate(vals []float64) Estimate {
+	e := Estimate{N: len(vals)}
+	if e.N == 0 {
+		return e
+	}
+	for _, v := range vals {
+		e.Mean += v
+	}
+	e.Mean /= float64(e.N)
+	if e.N < 2 {
+		return e
+	}
+	var sq float64
+	for _, v := range vals {
+		sq += (v - e.Mean) * (v - e.Mean)
+	}
+	e.StdDev = math.Sqrt(sq / float64(e.N-1))
+	e.StdErr = e.StdDev / math.Sqrt(float64(e.N))
+	return e
+}
+
+// CI95 returns the 95% confidence interval of the mean (normal approximation).
+func (e Estimate) CI95() (lo, hi float64) {
+	return e.Mean - z95*e.StdErr, e.Mean + z95*e.StdErr
+}
+
+// Overlaps returns true if the 95% confidence intervals of the two estimates
+// overlap, which means that the difference between them is not significant.
+func (e Estimate) Overlaps(o Estimate) bool {
+	lo, hi := e.CI95()
+	olo, ohi := o.CI95()
+	return lo <= ohi && olo <= hi
+}
+
+// String returns the mean and the half-width of the 95% confidence interval.
+func (e Estimate) String() string {
+	return fmt.Sprintf("%.1f±%.1f", e.Mean, z95*e.StdErr)
+}
+
+// WinRateEstimate returns the estimated win rate (as a fraction of games).
+func (s *ProfileStats) WinRateEstimate() Estimate {
+	wins := make([]float64, s.Games)
+	for i := 0; i < s.Wins && i < s.Games; i++ {
+		wins[i] = 1
+	}
+	return newEstimate(wins)
+}
+
+// SurvivalEstimate returns the estimated number of ticks survived.
+func (s *ProfileStats) SurvivalEstimate() Estimate {
+	return newEstimate(intsToFloats(s.SurvivalTicks))
+}
+
+// TerritoryEstimate returns the estimated number of cells owned at the end
+// of a game.
+func (s *ProfileStats) TerritoryEstimate() Estimate {
+	return newEstimate(intsToFloats(s.FinalTerritory))
+}
+
+// GoldEstimate returns the estimated gold at the end of a game.
+func (s *ProfileStats) GoldEstimate() Estimate {
+	return newEstimate(s.FinalGold)
+}
+
+func intsToFloats(vals []int) []float64 {
+	f := make([]float64, len(vals))
+	for i, v := range vals {
+		f[i] = float64(v)
+	}
+	return f
+}
+
+// TournamentResult holds the results of a tournament.
+type TournamentResult struct {
+	Config TournamentConfig
+	Stats  []*ProfileStats // Stats in the same order as the profiles
+}
+
+// RunTournament plays the configured number of games between the given
+// profiles, one player per profile, and collects statistics.
+// The order of the players is rotated each game to avoid any bias.
+func RunTournament(cfg TournamentConfig, profiles []Profile) *TournamentResult {
+	res := &TournamentResult{Config: cfg}
+	numSamples := 1
+	if cfg.SampleEvery > 0 {
+		numSamples = cfg.MaxTicks/cfg.SampleEvery + 1
+	}
+	for _, p := range profiles {
+		res.Stats = append(res.Stats, &ProfileStats{
+			Profile:        p.Name,
+			TerritoryCurve: make([]float64, numSamples),
+			GoldCurve:      make([]float64, numSamples),
+		})
+	}
+
+	for game := 0; game < cfg.Games; game++ {
+		playGame(cfg, profiles, game, res)
+		log.Printf("Tournament game %d/%d done", game+1, cfg.Games)
+	}
+
+	// Average the curves.
+	for _, s := range res.Stats {
+		for i := range s.TerritoryCurve {
+			s.TerritoryCurve[i] /= float64(cfg.Games)
+			s.GoldCurve[i] /= float64(cfg.Games)
+		}
+	}
+	return res
+}
+
+// playGame plays a single game of the tournament and adds the results.
+func playGame(cfg TournamentConfig, profiles []Profile, game int, res *TournamentResult) {
+	g := NewGridWithSeed(cfg.Width, cfg.Height, cfg.Seed+int64(game))
+	g.Silent = true
+	g.webpExport = nil // We don't need any frames.
+
+	// Rotate the seating order, so no profile always gets the first pick.
+	seat := make([]int, len(profiles)) // Player index -> profile index
+	for i := range profiles {
+		idx := (i + game) % len(profiles)
+		seat[i] = idx
+		g.AddPlayer(NewPlayer(profiles[idx].Name))
+		profiles[idx].apply(g.AIs[i])
+	}
+
+	alive := make([]bool, len(profiles))
+	survival := make([]int, len(profiles))
+	for i := range alive {
+		alive[i] = true
+	}
+	sample := func(idx int) {
+		territory := g.territory()
+		for i, p := range g.Players {
+			s := res.Stats[seat[i]]
+			s.TerritoryCurve[idx] += float64(territory[p])
+			s.GoldCurve[idx] += p.Gold
+		}
+	}
+	sample(0)
+	lastSample := 0
+
+	// Play until only one player is left or we run out of time.
+	numAlive := len(profiles)
+	for tick := 1; tick <= cfg.MaxTicks && numAlive > 1; tick++ {
+		running := g.Tick()
+		territory := g.territory()
+		for i, p := range g.Players {
+			if alive[i] && (territory[p] == 0 || p.Gold < 0) {
+				alive[i] = false
+				survival[i] = tick
+				numAlive--
+			}
+		}
+		if cfg.SampleEvery > 0 && tick%cfg.SampleEvery == 0 {
+			lastSample = tick / cfg.SampleEvery
+			sample(lastSample)
+		}
+		if !running {
+			break
+		}
+	}
+
+	// If the game ended early, the remaining samples are the final state.
+	for idx := lastSample + 1; idx < len(res.Stats[0].TerritoryCurve); idx++ {
+		sample(idx)
+	}
+
+	// Players that are still alive survived the whole game.
+	for i := range alive {
+		if alive[i] {
+			survival[i] = cfg.MaxTicks
+		}
+	}
+
+	// The winner is the last player standing, or the surviving player with
+	// the most territory (and then gold).
+	territory := g.territory()
+	winner := -1
+	for i, p := range g.Players {
+		if !alive[i] && numAlive > 0 {
+			continue
+		}
+		if winner == -1 {
+			winner = i
+			continue
+		}
+		w := g.Players[winner]
+		if territory[p] > territory[w] || (territory[p] == territory[w] && p.Gold > w.Gold) {
+			winner = i
+		}
+	}
+
+	for i, p := range g.Players {
+		s := res.Stats[seat[i]]
+		s.Games++
+		if i == winner {
+			s.Wins++
+		}
+		s.SurvivalTicks = append(s.SurvivalTicks, survival[i])
+		s.FinalTerritory = append(s.FinalTerritory, territory[p])
+		s.FinalGold = append(s.FinalGold, p.Gold)
+	}
+}
+
+// territory returns the number of cells owned by each player.
+func (g *Grid) territory() map[*Player]int {
+	t := make(map[*Player]int, len(g.Players))
+	for _, c := range g.Cells {
+		if c.ControlledBy != nil {
+			t[c.ControlledBy]++
+		}
+	}
+	return t
+}
+
+// Rankings returns the stats sorted by win rate, then average survival time,
+// then average territory.
+func (r *TournamentResult) Rankings() []*ProfileStats {
+	ranked := make([]*ProfileStats, len(r.Stats))
+	copy(ranked, r.Stats)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.WinRate() != b.WinRate() {
+			return a.WinRate() > b.WinRate()
+		}
+		if a.AvgSurvival() != b.AvgSurvival() {
+			return a.AvgSurvival() > b.AvgSurvival()
+		}
+		return a.AvgTerritory() > b.AvgTerritory()
+	})
+	return ranked
+}
+
+// WriteReport writes the rankings as a table.
+// Each metric is given as the mean and the half-width of its 95% confidence
+// interval, followed by the standard deviation. A rank is marked with '='
+// if the win rate interval overlaps with that of the profile ranked above,
+// which means that the ranking of the two is not significant.
+func (r *TournamentResult) WriteReport(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d games on %dx%d, max %d ticks, seed %d\n", r.Config.Games, r.Config.Width, r.Config.Height, r.Config.MaxTicks, r.Config.Seed)
+	fmt.Fprintf(&sb, "%-4s %-16s %22s %22s %22s %26s\n", "RANK", "PROFILE", "WIN RATE % (SD)", "SURVIVAL (SD)", "TERRITORY (SD)", "GOLD (SD)")
+	var prev *Estimate
+	var overlaps bool
+	for i, s := range r.Rankings() {
+		win := s.WinRateEstimate()
+		win.Mean, win.StdDev, win.StdErr = win.Mean*100, win.StdDev*100, win.StdErr*100
+		rank := fmt.Sprint(i + 1)
+		if prev != nil && win.Overlaps(*prev) {
+			rank += "="
+			overlaps = true
+		}
+		prev = &win
+		fmt.Fprintf(&sb, "%-4s %-16s %22s %22s %22s %26s\n", rank, s.Profile, withStdDev(win), withStdDev(s.SurvivalEstimate()), withStdDev(s.TerritoryEstimate()), withStdDev(s.GoldEstimate()))
+	}
+	sb.WriteString("Values are mean±95% confidence interval (standard deviation).\n")
+	if overlaps {
+		sb.WriteString("= The win rate is not significantly different from the rank above.\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// withStdDev formats the estimate followed by its standard deviation.
+func withStdDev(e Estimate) string {
+	return fmt.Sprintf("%s (%.1f)", e, e.StdDev)
+}
+
+// WriteCurvesCSV writes the average territory and gold curves as CSV.
+func (r *TournamentResult) WriteCurvesCSV(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("tick")
+	for _, s := range r.Stats {
+		fmt.Fprintf(&sb, ",%s_territory,%s_gold", s.Profile, s.Profile)
+	}
+	sb.WriteString("\n")
+	if len(r.Stats) > 0 {
+		for i := range r.Stats[0].TerritoryCurve {
+			fmt.Fprintf(&sb, "%d", i*r.Config.SampleEvery)
+			for _, s := range r.Stats {
+				fmt.Fprintf(&sb, ",%.2f,%.2f", s.TerritoryCurve[i], s.GoldCurve[i])
+			}
+			sb.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -2,33 +2,50 @@ package simsettlers
 
 import (
 	"fmt"
-)
+	"log"
 
-// ATTENTION: Everything in this file is just a draft and unused.
+	"github.com/Flokey82/go_gens/vectors"
+)
 
 // The AI:
 // - Perception
-// - Conditions
 // - Status
 // - Planning
 // - Execution
 //
 // Perception:
 // - What is the current state of the world that we can perceive?
+// Buildings and people nearby broadcast the actions they offer, similar to
+// the way The Sims handles it. For example, a house broadcasts the "Eat"
+// action, which is then picked up by the person, if the person lives there,
+// there is food in the larder and the person is hungry.
 //
 // Status:
 // - What is our current state?
-// Note to self: Do we have some fixed states that take priority over
-// other states? For example, if we are starving, we should eat, even
-// if we are tired. Or will we generalize all states?
+// Our base motives (hunger, sleep, ...) decay over time, and their curves
+// (see motives_curves.go) turn them into a utility. The lower the motive, the
+// more urgent it is to do something about it.
 //
 // Planning:
 // - What do we want to do? (What is the most important thing to do?)
+// We score each available action by how much it would satisfy the motive,
+// weighted by the utility of the motive and the distance to the object, and
+// turn the best one into a plan (a chain of tasks).
 //
 // Execution:
-// - How do we do it? (What is the best way to do it?)
+// - How do we do it?
+// We step through the plan until it is done, or until it fails (for example,
+// because someone else ate the last bread while we were on our way).
 //
-// For the first iteration, we just fake perception. Sta
+// If none of our base motives are pressing, we pursue our life goals (jobs,
+// houses, partners, ...), which are handled by pickMotive.
+//
+// NOTE: The utility AI is only used if Map.UtilityAI is set.
+
+const (
+	perceptionRadius = 15.0  // How far (in tiles) we can see objects
+	aiIdleUtility    = 100.0 // Below this score, our base motives can wait
+)
 
 type AI struct {
 	*Person
@@ -56,133 +73,160 @@ func NewAI(p *Person) *AI {
 	ai.BaseMotives[BaseMotiveHealth] = MotiveType2Health.New()
 	ai.BaseMotives[BaseMotiveHunger] = MotiveType2Hunger.New()
 	ai.BaseMotives[BaseMotiveSleep] = MotiveType2Sleep.New()
+	ai.BaseMotives[BaseMotiveSocial] = MotiveType2Social.New()
 
 	ai.Motives = append(ai.Motives, ai.BaseMotives[:]...)
 
 	return ai
 }
 
-// Tick ticks the AI.
-func (ai *AI) Tick(elapsed float64) {
-	// TODO: Update perception and change any related motive values.
-	// For example, if we are threatened, we could increase the
-	// aggression motive or the flight motive.
-	var highestPriority float64
-	var highestPriorityMotive *Motive2
-	for _, m := range ai.Motives {
-		m.Tick(elapsed)
-		if m.Val > highestPriority {
-			highestPriority = m.Val
-			highestPriorityMotive = m
+// Tick ticks the AI and returns true if we are busy satisfying our base
+// motives (and have no time for anything else).
+func (ai *AI) Tick(m *Map, elapsed float64) bool {
+	ai.updateStatus()
+
+	// If we have no plan, we look around and make one.
+	if ai.Plan == nil {
+		ai.Plan = ai.newPlan(m, ai.perceive(m))
+		if ai.Plan == nil {
+			ai.CurrentMotive = nil
+			return false
 		}
+		ai.CurrentMotive = ai.motive(ai.Plan.Action.Motive)
+		log.Printf("%v plans to %s (%v)", ai.Person, ai.Plan.Action.Name, ai.CurrentMotive)
 	}
 
-	// TODO: Instead, we should randomly select a motive
-	// from the top 3 motives.
-	if ai.CurrentMotive != highestPriorityMotive {
-		ai.CurrentMotive = highestPriorityMotive
-
-		// TODO: Determine the best action to satisfy the motive.
-
-		// The Sims has a similar system, where the environment (furniture)
-		// is broadcasting the available actions. For example, a fridge
-		// broadcasts the "Eat" action, which is then picked up by the person,
-		// if the person is in range of the fridge and hungry.
-
-		// But what do we do if we are hungry and don't have food, or can
-		// reach a fridge? We could rob someone. Would that mean that people
-		// would broadcast the "Rob" action? Or would items that don't
-		// belong to us broadcast a "steal" action? Stealing would not
-		// directly satiate the hunger, but if we steal food, we can then
-		// eat it after.
-		// How do we get to that point? We could have items broadcast a
-		// eat action, but items that do not belong to us would have
-		// a precondition that we have to steal them first.
-		// Food -> Eat -> Precond: owned by us
-		// If not owned by us: Buy or steal
-
-		// For this, we loop through all available actions and determine
-		// which is the cheapest and the most effective.
-
-		// Here are the options wrt. action selection:
-		// - Actions are broadcasted by the environment and picked up
-		//   by the person.
-		// - Actions are
-
-		// For example, if we are hungry, we could eat an apple from
-		// our inventory, or we could go to the market and buy some
-		// food. The first option is quicker, but depends on us having
-		// an apple in our inventory. The second option is slower, but
-		// we can always buy food at the market (if we have money).
-
-		// In theory, we could also reward opportunistic behaviour, if it
-		// would satisfy another high priority motive. For example, if we
-		// we are quite sleepy, but also hungry, we might just grab a snack
-		// if we are close to the fridge before going to bed.
-
-		// For now, an action will represent all required steps
-		// to satisfy the motive.
-		// For example, sleep could be:
-		// - Determine the best place to sleep
-		// - Go to the determined place
-		// - Sleep
-		// - Wake up when the motive is satisfied (or when the
-		//   person is woken up by something else)
-
-		// Invalidate the current plan since we have a new motive.
-		ai.Plan = nil
-	} else {
-		// Check if our current action is still valid.
-		// TODO: determine preconditions for plans.
+	// Execute the plan.
+	for i := 0; i < stepsPerDay && !ai.Plan.Tree.IsDone(); i++ {
+		ai.Plan.Tree.Step(1.0)
+	}
+	if ai.Plan.Tree.IsDone() {
 		ai.Plan = nil
+		ai.CurrentMotive = nil
+		return false
 	}
+	return true
+}
+
+// updateStatus decays our motives and updates the motives that reflect
+// our physical state.
+func (ai *AI) updateStatus() {
+	// NOTE: One tick is one day, so we decay by a full day.
+	for _, m := range ai.Motives {
+		m.Tick(1.0)
+	}
+	ai.BaseMotives[BaseMotiveHealth].Val = ai.Health/healthMax*(motiveValueMax-motiveValueMin) + motiveValueMin
+}
+
+// perceive returns all objects we can perceive and interact with.
+func (ai *AI) perceive(m *Map) []*Object {
 	var objects []*Object
+	pos := ai.Position()
+
+	// We can see all buildings nearby, and we know where we live.
+	for _, b := range m.Buildings {
+		ot, ok := buildingObjects[b.Type]
+		if !ok {
+			continue
+		}
+		l := &LocationFixed{Pos: vectors.NewVec2(float64(b.X), float64(b.Y))}
+		if b != ai.Home && pos.DistanceTo(l.Position()) > perceptionRadius {
+			continue
+		}
+		o := ot.New(l)
+		o.Building = b
+		objects = append(objects, o)
+	}
+
+	// We can see all people nearby.
+	for _, p := range m.RealPop {
+		if p == ai.Person || p.Dead || pos.DistanceTo(p.Position()) > perceptionRadius {
+			continue
+		}
+		o := ObjectTypePerson.New(&p.LocationPerson)
+		o.Owner = p
+		objects = append(objects, o)
+	}
+	return objects
+}
+
+// score returns the utility of performing the given action on the given object.
+func (ai *AI) score(m *Map, o *Object, a *Action) float64 {
+	motive := ai.motive(a.Motive)
+	if motive == nil || a.CanDo != nil && !a.CanDo(m, ai.Person, o) {
+		return 0
+	}
 
-	if ai.Plan == nil && ai.CurrentMotive != nil {
-		// Loop through all the objects and find the object that helps
-		// us satisfy the motive the quickest.
-		// Loop through all actions of the object and determine
-		// the best action to satisfy the motive.
-
-		// TODO: For scoring, also take distance into account.
-		var plan *ActionPlan
-		for _, o := range objects {
-			for _, a := range o.Actions {
-				if a.Motive == ai.CurrentMotive.MotiveType2 {
-					if plan == nil {
-						plan = &ActionPlan{
-							Action: a,
-							Object: o,
-						}
-					} else {
-						if a.Amount > plan.Action.Amount {
-							plan.Action = a
-							plan.Object = o
-						}
-					}
+	// We can't satisfy the motive more than it is missing.
+	gain := min(a.Amount, motive.MissingToMax())
+
+	// The further away the object, the less attractive it is (measured in
+	// days it takes us to get there).
+	days := ai.Position().DistanceTo(o.Position()) / (walkingSpeed * stepsPerDay)
+	return motive.Multiplier() * gain / (1 + days)
+}
+
+// newPlan returns a plan for the best action we can perform on the given
+// objects, or nil if none of our motives are pressing.
+func (ai *AI) newPlan(m *Map, objects []*Object) *ActionPlan {
+	// TODO: Reward opportunistic behaviour, if an action would satisfy
+	// several motives at once. For example, if we are quite sleepy, but also
+	// hungry, we might just grab a snack on the way to bed.
+	var plan *ActionPlan
+	bestScore := aiIdleUtility
+	for _, o := range objects {
+		for _, a := range o.Actions {
+			if score := ai.score(m, o, a); score > bestScore {
+				bestScore = score
+				plan = &ActionPlan{
+					Action: a,
+					Object: o,
 				}
 			}
 		}
-		ai.Plan = plan
 	}
+	if plan != nil {
+		plan.Tree = ai.newActionTree(m, plan.Action, plan.Object)
+	}
+	return plan
+}
 
-	if ai.Plan != nil {
-		// Execute the plan.
-		pos := ai.Position()
-		if pos.DistanceTo(ai.Plan.Object.Position()) > 1 {
-			// Set direction towards the object.
-			objectPos := ai.Plan.Object.Position()
-			ai.SetDirection(objectPos.X, objectPos.Y)
-
-			// Move towards the object.
-			ai.Move(1.0) // TODO: Move should take elapsed time into account.
-			return
-		}
+// newActionTree creates a behavior tree for performing the given action on
+// the given object.
+func (ai *AI) newActionTree(m *Map, a *Action, o *Object) *Tree {
+	// - Move to the object.
+	// - Perform the action (if it is still available).
+	pos := o.Position()
+	tRoot := NewTaskSequence(
+		NewTaskMoveToXY(ai.Person, int(pos.X), int(pos.Y)), // Move to the object.
+		NewTaskGeneric(ai.Person, a.Name, func(elapsed float64) TaskStatus {
+			// The world might have changed while we were on our way.
+			if a.CanDo != nil && !a.CanDo(m, ai.Person, o) {
+				return TaskStatusFailed
+			}
+			if a.Perform != nil && !a.Perform(m, ai.Person, o) {
+				return TaskStatusFailed
+			}
+			ai.ChangeMotive(a.Motive, a.Amount)
+			return TaskStatusCompleted
+		}),
+	)
+	t := NewTree(tRoot, func() {
+		log.Printf("%v did %s", ai.Person, a.Name)
+	}, func() {
+		log.Printf("%v failed to %s", ai.Person, a.Name)
+	})
+	return &t
+}
 
-		// Perform the action.
-		// Update the current motive.
-		ai.ChangeMotive(ai.Plan.Action.Motive, ai.Plan.Action.Amount)
+// motive returns our motive of the given type (if any).
+func (ai *AI) motive(motive *MotiveType2) *Motive2 {
+	for _, m := range ai.Motives {
+		if m.MotiveType2 == motive {
+			return m
+		}
 	}
+	return nil
 }
 
 // ChangeBaseMotive changes the given base motive by the given amount.
@@ -192,36 +236,127 @@ func (ai *AI) ChangeBaseMotive(motive int, amount float64) {
 
 // ChangeMotive changes the given motive by the given amount.
 func (ai *AI) ChangeMotive(motive *MotiveType2, amount float64) {
-	for _, m := range ai.Motives {
-		if m.MotiveType2 == motive {
-			m.Change(amount)
-			return
-		}
+	if m := ai.motive(motive); m != nil {
+		m.Change(amount)
 	}
 }
 
 type ActionPlan struct {
 	Action *Action // The action to perform
 	Object *Object // The object to perform the action on
+	Tree   *Tree   // The tasks to perform the action
 }
 
 type Action struct {
-	Name   string
-	Motive *MotiveType2
-	Amount float64
+	Name    string
+	Motive  *MotiveType2
+	Amount  float64                                 // How much the action satisfies the motive
+	CanDo   func(m *Map, p *Person, o *Object) bool // Returns true if the action is available to the person (optional)
+	Perform func(m *Map, p *Person, o *Object) bool // Performs the action and returns true on success (optional)
 }
 
+const prayHealing = 10.0 // Health regained by praying at the temple
+
 var ActionEat = &Action{
 	Name:   "Eat",
 	Motive: MotiveType2Hunger,
-	Amount: -10,
+	Amount: 60,
+	CanDo: func(m *Map, p *Person, o *Object) bool {
+		return o.Building == p.Home && o.Building.Stock[ResourceFood] > 0
+	},
+	Perform: func(m *Map, p *Person, o *Object) bool {
+		n := o.Building.Stock.Take(ResourceFood, 1)
+		p.Eaten += n
+		return n > 0
+	},
+}
+
+var ActionBuyFood = &Action{
+	Name:   "BuyFood",
+	Motive: MotiveType2Hunger,
+	Amount: 50,
+	CanDo: func(m *Map, p *Person, o *Object) bool {
+		return m.Resources[ResourceFood] > 0 && p.budget()[ResourceCoin] >= resourceValue[ResourceFood]
+	},
+	Perform: func(m *Map, p *Person, o *Object) bool {
+		if m.buy(p, ResourceFood, 1) == 0 {
+			return false
+		}
+		n := p.Resources.Take(ResourceFood, 1)
+		p.Eaten += n
+		return n > 0
+	},
+}
+
+var ActionSleep = &Action{
+	Name:   "Sleep",
+	Motive: MotiveType2Sleep,
+	Amount: 100,
+	CanDo: func(m *Map, p *Person, o *Object) bool {
+		return o.Building == p.Home
+	},
+}
+
+var ActionRentBed = &Action{
+	Name:   "RentBed",
+	Motive: MotiveType2Sleep,
+	Amount: 80,
+	CanDo: func(m *Map, p *Person, o *Object) bool {
+		return p.budget()[ResourceCoin] > 0
+	},
+	Perform: func(m *Map, p *Person, o *Object) bool {
+		p.pay(Stockpile{ResourceCoin: 1})
+		o.Building.Stock[ResourceCoin]++
+		return true
+	},
+}
+
+var ActionPray = &Action{
+	Name:   "Pray",
+	Motive: MotiveType2Health,
+	Amount: prayHealing * (motiveValueMax - motiveValueMin) / healthMax,
+	Perform: func(m *Map, p *Person, o *Object) bool {
+		p.Health = min(p.Health+prayHealing, healthMax)
+		return true
+	},
+}
+
+var ActionChat = &Action{
+	Name:   "Chat",
+	Motive: MotiveType2Social,
+	Amount: 40,
+	CanDo: func(m *Map, p *Person, o *Object) bool {
+		return !o.Owner.Dead
+	},
+	Perform: func(m *Map, p *Person, o *Object) bool {
+		// We get to know each other a little better.
+		p.Opinions.IncrementBy(o.Owner, 1)
+		o.Owner.Opinions.IncrementBy(p, 1)
+		return true
+	},
+}
+
+var (
+	ObjectTypeHouse  = &ObjectType{Name: "House", Actions: []*Action{ActionEat, ActionSleep}}
+	ObjectTypeMarket = &ObjectType{Name: "Market", Actions: []*Action{ActionBuyFood}}
+	ObjectTypeTavern = &ObjectType{Name: "Tavern", Actions: []*Action{ActionRentBed}}
+	ObjectTypeTemple = &ObjectType{Name: "Temple", Actions: []*Action{ActionPray}}
+	ObjectTypePerson = &ObjectType{Name: "Person", Actions: []*Action{ActionChat}}
+)
+
+// buildingObjects maps building types to the objects they represent for the AI.
+var buildingObjects = map[string]*ObjectType{
+	BuildingTypeHouse:  ObjectTypeHouse,
+	BuildingTypeMarket: ObjectTypeMarket,
+	BuildingTypeTavern: ObjectTypeTavern,
+	BuildingTypeTemple: ObjectTypeTemple,
 }
 
 type MotiveType2 struct {
 	Name     string
 	Category string
-	Decay    float64 // Base decay per second
-	// Curve    CurveType
+	Decay    float64   // Base decay per day
+	Curve    CurveType // How the utility changes based on the current value
 }
 
 func (m *MotiveType2) New() *Motive2 {
@@ -255,20 +390,41 @@ func (m *Motive2) Change(amount float64) {
 	}
 }
 
+// MissingToMax returns how much the motive is missing to reach the maximum value.
+func (m *Motive2) MissingToMax() float64 {
+	return motiveValueMax - m.Val
+}
+
+// Multiplier returns the current utility multiplier for the motive.
+func (m *Motive2) Multiplier() float64 {
+	return m.Curve.Multiplier(m.Val)
+}
+
+// NOTE: Health doesn't decay, it reflects the health of the person.
 var MotiveType2Health = &MotiveType2{
 	Name:     "Health",
 	Category: CategoryBasic,
-	Decay:    0.1,
+	Decay:    0,
+	Curve:    CurveTypeExponential,
 }
 
 var MotiveType2Hunger = &MotiveType2{
 	Name:     "Hunger",
 	Category: CategoryBasic,
-	Decay:    0.1,
+	Decay:    15,
+	Curve:    CurveTypeSigmoid,
 }
 
 var MotiveType2Sleep = &MotiveType2{
 	Name:     "Sleep",
 	Category: CategoryBasic,
-	Decay:    0.1,
+	Decay:    20,
+	Curve:    CurveTypeSigmoid,
+}
+
+var MotiveType2Social = &MotiveType2{
+	Name:     "Social",
+	Category: CategoryBasic,
+	Decay:    5,
+	Curve:    CurveTypeLinear,
 }
@@ -0,0 +1,71 @@
+package simsettlers
+
+import "testing"
+
+// newTestVillage returns a map with a single settler living in a house at
+// 10,10 and a market at 20,10.
+func newTestVillage() (*Map, *Person) {
+	m := NewMap(32, 32)
+	m.UtilityAI = true
+	m.RealPop = nil
+	m.Buildings = nil
+
+	home := NewBuilding(10, 10, BuildingTypeHouse)
+	market := NewBuilding(20, 10, BuildingTypeMarket)
+	m.Buildings = append(m.Buildings, home, market)
+
+	p := m.newPerson("Hob", "Baker", GenderMale, 30)
+	p.Home = home
+	p.X, p.Y = 10, 10
+	p.Resources[ResourceCoin] = 10
+	m.RealPop = append(m.RealPop, p)
+	return m, p
+}
+
+func TestHungrySettlerBuysFood(t *testing.T) {
+	m, p := newTestVillage()
+	m.Resources[ResourceFood] = 10
+	p.AI = NewAI(p)
+	p.AI.BaseMotives[BaseMotiveHunger].Val = -20
+
+	for i := 0; i < 5 && p.AI.BaseMotives[BaseMotiveHunger].Val < 0; i++ {
+		p.AI.Tick(m, 1.0)
+	}
+
+	if got := p.AI.BaseMotives[BaseMotiveHunger].Val; got < 0 {
+		t.Errorf("hunger is still %.2f, want >= 0", got)
+	}
+	if got := m.Resources[ResourceFood]; got != 9 {
+		t.Errorf("market food is %d, want 9", got)
+	}
+	if d := p.distanceTo(20, 10); d > arrivalDistance {
+		t.Errorf("settler is %.2f tiles away from the market, want < %.2f", d, arrivalDistance)
+	}
+}
+
+func TestHungrySettlerEatsAtHome(t *testing.T) {
+	m, p := newTestVillage()
+	m.Resources[ResourceFood] = 10
+	p.Home.Stock[ResourceFood] = 1
+	p.AI = NewAI(p)
+	p.AI.BaseMotives[BaseMotiveHunger].Val = -50
+
+	p.AI.Tick(m, 1.0)
+
+	// Eating at home is closer and more filling than buying food.
+	if got := p.Home.Stock[ResourceFood]; got != 0 {
+		t.Errorf("household food is %d, want 0", got)
+	}
+	if got := m.Resources[ResourceFood]; got != 10 {
+		t.Errorf("market food is %d, want 10", got)
+	}
+}
+
+func TestSatisfiedSettlerIsIdle(t *testing.T) {
+	m, p := newTestVillage()
+	p.AI = NewAI(p)
+
+	if p.AI.Tick(m, 1.0) || p.AI.Plan != nil {
+		t.Errorf("settler without pressing needs has a plan: %v", p.AI.Plan)
+	}
+}
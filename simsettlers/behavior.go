@@ -0,0 +1,342 @@
+package simsettlers
+
+// This file contains the composite and decorator nodes that turn our task
+// chains into proper behavior trees.
+//
+// Composite nodes (Sequence, Selector, Parallel) remember which child they
+// are currently executing, so a tree can be suspended and resumed (see
+// Tree.Step) without starting over from the root.
+
+// Resetter is implemented by tasks that keep state between steps and need
+// to be reset before they can be run again.
+type Resetter interface {
+	Reset()
+}
+
+// resetTask resets the given task if it keeps any state.
+func resetTask(t Task) {
+	if r, ok := t.(Resetter); ok {
+		r.Reset()
+	}
+}
+
+// TaskSequence executes its children in order until one fails.
+// It succeeds if all children succeed.
+type TaskSequence struct {
+	Children []Task
+	current  int
+	TaskThen
+}
+
+func NewTaskSequence(children ...Task) *TaskSequence {
+	return &TaskSequence{Children: children}
+}
+
+// Do executes the task and returns the status of the task.
+func (t *TaskSequence) Do(elapsed float64) TaskStatus {
+	for t.current < len(t.Children) {
+		switch t.Children[t.current].Do(elapsed) {
+		case TaskStatusCompleted:
+			t.current++
+		case TaskStatusFailed:
+			t.Reset()
+			return TaskStatusFailed
+		default:
+			return TaskStatusInProgress
+		}
+	}
+	t.Reset()
+	return TaskStatusCompleted
+}
+
+// Reset resets the sequence and all of its children.
+func (t *TaskSequence) Reset() {
+	t.current = 0
+	for _, c := range t.Children {
+		resetTask(c)
+	}
+}
+
+// TaskSelector executes its children in order until one succeeds.
+// It fails if all children fail.
+type TaskSelector struct {
+	Children []Task
+	current  int
+	TaskThen
+}
+
+func NewTaskSelector(children ...Task) *TaskSelector {
+	return &TaskSelector{Children: children}
+}
+
+// Do executes the task and returns the status of the task.
+func (t *TaskSelector) Do(elapsed float64) TaskStatus {
+	for t.current < len(t.Children) {
+		switch t.Children[t.current].Do(elapsed) {
+		case TaskStatusCompleted:
+			t.Reset()
+			return TaskStatusCompleted
+		case TaskStatusFailed:
+			t.current++
+		default:
+			return TaskStatusInProgress
+		}
+	}
+	t.Reset()
+	return TaskStatusFailed
+}
+
+// Reset resets the selector and all of its children.
+func (t *TaskSelector) Reset() {
+	t.current = 0
+	for _, c := range t.Children {
+		resetTask(c)
+	}
+}
+
+// ParallelPolicy determines when a parallel task succeeds or fails.
+type ParallelPolicy byte
+
+const (
+	ParallelRequireAll ParallelPolicy = iota // Succeed if all children succeed, fail if any fails.
+	ParallelRequireOne                       // Succeed if any child succeeds, fail if all fail.
+)
+
+// TaskParallel executes all of its children at the same time.
+type TaskParallel struct {
+	Children []Task
+	Policy   ParallelPolicy
+	status   []TaskStatus
+	TaskThen
+}
+
+func NewTaskParallel(policy ParallelPolicy, children ...Task) *TaskParallel {
+	return &TaskParallel{
+		Children: children,
+		Policy:   policy,
+		status:   make([]TaskStatus, len(children)),
+	}
+}
+
+// Do executes the task and returns the status of the task.
+func (t *TaskParallel) Do(elapsed float64) TaskStatus {
+	var completed, failed int
+	for i, c := range t.Children {
+		// Children that are done are not executed again.
+		if t.status[i] != TaskStatusCompleted && t.status[i] != TaskStatusFailed {
+			t.status[i] = c.Do(elapsed)
+		}
+		switch t.status[i] {
+		case TaskStatusCompleted:
+			completed++
+		case TaskStatusFailed:
+			failed++
+		}
+	}
+
+	status := TaskStatusInProgress
+	switch t.Policy {
+	case ParallelRequireAll:
+		if failed > 0 {
+			status = TaskStatusFailed
+		} else if completed == len(t.Children) {
+			status = TaskStatusCompleted
+		}
+	case ParallelRequireOne:
+		if completed > 0 {
+			status = TaskStatusCompleted
+		} else if failed == len(t.Children) {
+			status = TaskStatusFailed
+		}
+	}
+	if status != TaskStatusInProgress {
+		t.Reset()
+	}
+	return status
+}
+
+// Reset resets the parallel task and all of its children.
+func (t *TaskParallel) Reset() {
+	for i, c := range t.Children {
+		t.status[i] = TaskStatusNotStarted
+		resetTask(c)
+	}
+}
+
+// TaskRepeat executes its child the given number of times (or forever if
+// the count is 0). It fails as soon as the child fails.
+type TaskRepeat struct {
+	Child Task
+	Count int
+	done  int
+	TaskThen
+}
+
+func NewTaskRepeat(child Task, count int) *TaskRepeat {
+	return &TaskRepeat{Child: child, Count: count}
+}
+
+// Do executes the task and returns the status of the task.
+func (t *TaskRepeat) Do(elapsed float64) TaskStatus {
+	switch t.Child.Do(elapsed) {
+	case TaskStatusCompleted:
+		t.done++
+		if t.Count > 0 && t.done >= t.Count {
+			t.Reset()
+			return TaskStatusCompleted
+		}
+		resetTask(t.Child)
+	case TaskStatusFailed:
+		t.Reset()
+		return TaskStatusFailed
+	}
+	return TaskStatusInProgress
+}
+
+// Reset resets the repeat counter and the child.
+func (t *TaskRepeat) Reset() {
+	t.done = 0
+	resetTask(t.Child)
+}
+
+// TaskTimeout fails if its child doesn't finish within the given duration.
+type TaskTimeout struct {
+	Child    Task
+	Duration float64
+	elapsed  float64
+	TaskThen
+}
+
+func NewTaskTimeout(child Task, duration float64) *TaskTimeout {
+	return &TaskTimeout{Child: child, Duration: duration}
+}
+
+// Do executes the task and returns the status of the task.
+func (t *TaskTimeout) Do(elapsed float64) TaskStatus {
+	t.elapsed += elapsed
+	status := t.Child.Do(elapsed)
+	if status == TaskStatusInProgress && t.elapsed >= t.Duration {
+		status = TaskStatusFailed
+	}
+	if status != TaskStatusInProgress {
+		t.Reset()
+	}
+	return status
+}
+
+// Reset resets the timer and the child.
+func (t *TaskTimeout) Reset() {
+	t.elapsed = 0
+	resetTask(t.Child)
+}
+
+// TaskInverter turns the success of its child into failure and vice versa.
+type TaskInverter struct {
+	Child Task
+	TaskThen
+}
+
+func NewTaskInverter(child Task) *TaskInverter {
+	return &TaskInverter{Child: child}
+}
+
+// Do executes the task and returns the status of the task.
+func (t *TaskInverter) Do(elapsed float64) TaskStatus {
+	switch status := t.Child.Do(elapsed); status {
+	case TaskStatusCompleted:
+		return TaskStatusFailed
+	case TaskStatusFailed:
+		return TaskStatusCompleted
+	default:
+		return status
+	}
+}
+
+// Reset resets the child.
+func (t *TaskInverter) Reset() {
+	resetTask(t.Child)
+}
+
+// TaskCooldown prevents its child from being executed again until the
+// given duration has passed since it last finished. While cooling down,
+// the task fails, so a selector can fall back to something else.
+// NOTE: The cooldown only passes while the task is being evaluated.
+type TaskCooldown struct {
+	Child     Task
+	Duration  float64
+	remaining float64
+	TaskThen
+}
+
+func NewTaskCooldown(child Task, duration float64) *TaskCooldown {
+	return &TaskCooldown{Child: child, Duration: duration}
+}
+
+// Do executes the task and returns the status of the task.
+func (t *TaskCooldown) Do(elapsed float64) TaskStatus {
+	if t.remaining > 0 {
+		t.remaining -= elapsed
+		return TaskStatusFailed
+	}
+	status := t.Child.Do(elapsed)
+	if status == TaskStatusCompleted || status == TaskStatusFailed {
+		t.remaining = t.Duration
+		resetTask(t.Child)
+	}
+	return status
+}
+
+// NOTE: TaskCooldown deliberately doesn't implement Resetter, so the cooldown
+// persists if the parent is reset.
+
+// TaskCondition succeeds if the condition is true and fails otherwise.
+type TaskCondition struct {
+	Name      string
+	Condition func() bool
+	TaskThen
+}
+
+func NewTaskCondition(name string, condition func() bool) *TaskCondition {
+	return &TaskCondition{Name: name, Condition: condition}
+}
+
+// Do executes the task and returns the status of the task.
+func (t *TaskCondition) Do(elapsed float64) TaskStatus {
+	if t.Condition() {
+		return TaskStatusCompleted
+	}
+	return TaskStatusFailed
+}
+
+// Blackboard is a per-person memory that the tasks of a behavior tree use
+// to share data, like the current target or the loot we found.
+type Blackboard map[string]any
+
+// Set stores the given value under the given key.
+func (b Blackboard) Set(key string, value any) {
+	b[key] = value
+}
+
+// Has returns true if there is a value stored under the given key.
+func (b Blackboard) Has(key string) bool {
+	_, ok := b[key]
+	return ok
+}
+
+// Delete removes the value stored under the given key.
+func (b Blackboard) Delete(key string) {
+	delete(b, key)
+}
+
+// BlackboardValue returns the value of the given type stored under the given key.
+func BlackboardValue[T any](b Blackboard, key string) (T, bool) {
+	v, ok := b[key].(T)
+	return v, ok
+}
+
+// Blackboard keys.
+const (
+	BlackboardTarget   = "target"    // *Person we are interacting with
+	BlackboardEnemy    = "enemy"     // Name of the enemy we are fighting
+	BlackboardKilledBy = "killed_by" // Name of the enemy that killed us
+)
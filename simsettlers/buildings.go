@@ -8,12 +8,61 @@ import (
 )
 
 func (m *Map) tickBuildings() {
-	// Any unoccupied buildings have a chance of decaying.
+	// Any unoccupied buildings have a chance of decaying, which is higher
+	// if it is freezing. Storms damage even buildings that are taken care of.
+	// Buildings maintained by the village don't decay.
+	decayChance := 10
+	if m.Weather.IsFreezing() {
+		decayChance *= 2
+	}
+	var ruins []*Building
 	for _, b := range m.Buildings {
-		if !b.IsOccupied() && b.Condition > 0 {
-			if rand.Intn(100) < 10 {
+		if buildingMaintained[b.Type] {
+			continue
+		}
+		if m.Weather.Type == WeatherStorm && rand.Float64() < stormDamageChance {
+			b.Condition -= min(b.Condition, byte(1+rand.Intn(stormDamage)))
+			log.Printf("The storm damaged the %v", b)
+		}
+		if b.IsOccupied() || b.IsStaffed() {
+			continue
+		}
+		if b.Condition > 0 {
+			if rand.Intn(100) < decayChance {
 				b.Condition--
 			}
+		} else {
+			ruins = append(ruins, b)
+		}
+
+		// Unstaffed farms are slowly reclaimed by the wilderness.
+		if b.Type == BuildingTypeFarm && len(b.Plots) > 0 && rand.Float64() < fieldAbandonChance {
+			m.removePlot(b, b.Plots[len(b.Plots)-1])
+		}
+	}
+
+	// Tear down the ruins.
+	for _, b := range ruins {
+		m.Demolish(b)
+	}
+}
+
+// isConstructing returns true if the person is building the given building.
+func (p *Person) isConstructing(b *Building) bool {
+	for _, c := range p.Constructing {
+		if c == b {
+			return true
+		}
+	}
+	return false
+}
+
+// stopConstructing removes the building from the construction sites of the person.
+func (p *Person) stopConstructing(b *Building) {
+	for i, c := range p.Constructing {
+		if c == b {
+			p.Constructing = append(p.Constructing[:i], p.Constructing[i+1:]...)
+			break
 		}
 	}
 }
@@ -25,6 +74,7 @@ func (m *Map) advanceConstruction() {
 	for _, b := range m.Construction {
 		if b.AdvanceConstruction() {
 			log.Printf("Finished building %v", b)
+			m.recordEvent(EventBuilding, b.Type, b.Owners...)
 			m.Buildings = append(m.Buildings, b)
 
 			// Go through the new owners and assign them to the building.
@@ -40,13 +90,7 @@ func (m *Map) advanceConstruction() {
 				p.SetHome(b)
 
 				// Remove the building from the constructing list.
-				// TODO: Factor this out into a function.
-				for i, c := range p.Constructing {
-					if c == b {
-						p.Constructing = append(p.Constructing[:i], p.Constructing[i+1:]...)
-						break
-					}
-				}
+				p.stopConstructing(b)
 
 				for _, c := range p.Children {
 					// Check if the child still lives with the parents.
@@ -71,14 +115,18 @@ func (m *Map) advanceConstruction() {
 
 // Building represents a building on the map.
 type Building struct {
-	X, Y      int       // position on the map
-	BuiltDay  uint16    // day the building was built
-	BuiltYear int       // year the building was built
-	Remaining uint16    // ticks until construction is complete
-	Condition byte      // condition of the building
-	Type      string    // building type
-	Owners    []*Person // people who own the building
-	Occupants []*Person // people who live in the building
+	X, Y       int         // position on the map
+	BuiltDay   uint16      // day the building was built
+	BuiltYear  int         // year the building was built
+	Remaining  uint16      // ticks until construction is complete
+	Condition  byte        // condition of the building
+	Type       string      // building type
+	Owners     []*Person   // people who own the building
+	Occupants  []*Person   // people who live in the building
+	Workers    []*Person   // people who work in the building
+	Stock      Stockpile   // resources stored in the building (household stockpile for houses)
+	Plots      []int       // additional tiles occupied by the building (fields, wall segments, etc.)
+	Settlement *Settlement // settlement the building belongs to
 }
 
 // NewBuilding creates a new building of the given type at the given position.
@@ -86,8 +134,8 @@ func NewBuilding(x, y int, t string) *Building {
 	return &Building{
 		X:         x,
 		Y:         y,
-		Remaining: uint16(buildingCosts[t]), // The number of ticks remaining until the building is finished.
-		Condition: 100,                      // The condition of the building.
+		Remaining: uint16(buildingBuildTime[t]), // The number of ticks remaining until the building is finished.
+		Condition: 100,                          // The condition of the building.
 		Type:      t,
 	}
 }
@@ -97,6 +145,8 @@ func (m *Map) AddBuilding(x, y int, t string) *Building {
 	b := NewBuilding(x, y, t)
 	b.BuiltDay = m.Day
 	b.BuiltYear = m.Year
+	b.Settlement = m.nearestSettlement(x, y) // Callers that build for a specific settlement override this.
+	m.Zones[x+y*m.Width] = b
 	if b.Remaining == 0 {
 		m.Buildings = append(m.Buildings, b)
 	} else {
@@ -105,9 +155,10 @@ func (m *Map) AddBuilding(x, y int, t string) *Building {
 	return b
 }
 
-// PurchasePrice returns the purchase price of the building.
+// PurchasePrice returns the purchase price of the building in coin.
 func (b *Building) PurchasePrice() int {
-	return int(float64(buildingCosts[BuildingTypeHouse]) * float64(b.Condition) / 100.0)
+	cost := buildingCosts[b.Type]
+	return int(float64(cost.Value()) * float64(b.Condition) / 100.0)
 }
 
 // String returns a string representation of the building.
@@ -133,8 +184,79 @@ func (b *Building) IsOwned() bool {
 }
 
 // Yield returns the resource yield of the given building in a tick.
-func (b *Building) Yield() int {
-	return buildingYield[b.Type]
+// Workplaces only produce if they are staffed, skilled workers
+// produce more than apprentices, and the sick produce less.
+func (b *Building) Yield() Stockpile {
+	yield := buildingYield[b.Type]
+	if b.Job() == JobTypeUnemployed {
+		return yield
+	}
+	var staffing float64
+	for _, w := range b.Workers {
+		staffing += skillFactor(w.Skills[w.Job]) * w.workCapacity()
+	}
+	// Each field of a farm adds to the yield.
+	fields := 1 + len(b.Plots)
+	if b.Type != BuildingTypeFarm {
+		fields = 1
+	}
+	for r := range yield {
+		yield[r] = int(float64(yield[r]*fields) * staffing / float64(b.WorkerCapacity()))
+	}
+	return yield
+}
+
+// WorkerCapacity returns the number of workers the building needs to be fully staffed.
+// Farms need more farmers the more fields they have.
+func (b *Building) WorkerCapacity() int {
+	if b.Type == BuildingTypeFarm {
+		return buildingWorkers[b.Type] + len(b.Plots)/fieldsPerFarmer
+	}
+	return buildingWorkers[b.Type]
+}
+
+// Job returns the job that is performed in the building (if it is a workplace).
+func (b *Building) Job() JobType {
+	for j, t := range jobWorkplace {
+		if t == b.Type {
+			return j
+		}
+	}
+	return JobTypeUnemployed
+}
+
+// HasVacancy returns true if the building is a workplace that needs more workers.
+func (b *Building) HasVacancy() bool {
+	return len(b.Workers) < b.WorkerCapacity()
+}
+
+// IsStaffed returns true if anyone works in the building.
+func (b *Building) IsStaffed() bool {
+	return len(b.Workers) > 0
+}
+
+// AddWorker adds the given person to the workers of the building (if not already present).
+func (b *Building) AddWorker(p *Person) {
+	for _, w := range b.Workers {
+		if w == p {
+			return
+		}
+	}
+	b.Workers = append(b.Workers, p)
+	p.Workplace = b
+}
+
+// RemoveWorker removes the given person from the workers of the building.
+func (b *Building) RemoveWorker(p *Person) {
+	for i, w := range b.Workers {
+		if w == p {
+			b.Workers = append(b.Workers[:i], b.Workers[i+1:]...)
+			break
+		}
+	}
+	if p.Workplace == b {
+		p.Workplace = nil
+	}
 }
 
 // AddOccupant adds the given person to the occupants list of the building (if not already present).
@@ -189,11 +311,81 @@ const (
 	BuildingTypeHouse    = "house"
 	BuildingTypeCemetery = "cemetery"
 	BuildingTypeDungeon  = "dungeon"
+
+	// Workplaces.
+	BuildingTypeSmithy     = "smithy"
+	BuildingTypeMill       = "mill"
+	BuildingTypeLumberCamp = "lumber camp"
+	BuildingTypeMine       = "mine"
+	BuildingTypeTemple     = "temple"
+	BuildingTypeGuardhouse = "guardhouse"
+	BuildingTypeFarm       = "farm"
+	BuildingTypeWorkshop   = "workshop"
+	BuildingTypeTavern     = "tavern"
+
+	// Buildings maintained by the village.
+	BuildingTypeWell       = "well"
+	BuildingTypeWall       = "wall"
+	BuildingTypeStorehouse = "storehouse"
 )
 
-var buildingCosts = map[string]int{
-	BuildingTypeMarket: 10,
-	BuildingTypeHouse:  5,
+// buildingMaintained are the building types that are maintained by the
+// village and don't decay if nobody lives or works there.
+var buildingMaintained = map[string]bool{
+	BuildingTypeMarket:     true,
+	BuildingTypeDungeon:    true,
+	BuildingTypeWell:       true,
+	BuildingTypeWall:       true,
+	BuildingTypeStorehouse: true,
+}
+
+// buildingCosts is the material required to construct a building.
+var buildingCosts = map[string]Stockpile{
+	BuildingTypeMarket:     {ResourceWood: 10, ResourceStone: 5},
+	BuildingTypeHouse:      {ResourceWood: 10, ResourceStone: 2},
+	BuildingTypeSmithy:     {ResourceWood: 6, ResourceStone: 8},
+	BuildingTypeMill:       {ResourceWood: 12, ResourceStone: 6, ResourceTools: 2},
+	BuildingTypeLumberCamp: {ResourceWood: 6, ResourceTools: 2},
+	BuildingTypeMine:       {ResourceWood: 10, ResourceTools: 4},
+	BuildingTypeTemple:     {ResourceWood: 10, ResourceStone: 20},
+	BuildingTypeGuardhouse: {ResourceWood: 6, ResourceStone: 10},
+	BuildingTypeFarm:       {ResourceWood: 6},
+	BuildingTypeWorkshop:   {ResourceWood: 8, ResourceStone: 4},
+	BuildingTypeTavern:     {ResourceWood: 12, ResourceStone: 4},
+	BuildingTypeWell:       {ResourceStone: 6},
+	BuildingTypeWall:       {}, // Paid per segment, see wallSegmentCost.
+	BuildingTypeStorehouse: {ResourceWood: 15, ResourceStone: 5},
+}
+
+// buildingBuildTime is the number of ticks it takes to construct a building.
+var buildingBuildTime = map[string]int{
+	BuildingTypeMarket:     10,
+	BuildingTypeHouse:      5,
+	BuildingTypeSmithy:     8,
+	BuildingTypeMill:       10,
+	BuildingTypeLumberCamp: 4,
+	BuildingTypeMine:       12,
+	BuildingTypeTemple:     15,
+	BuildingTypeGuardhouse: 8,
+	BuildingTypeFarm:       4,
+	BuildingTypeWorkshop:   6,
+	BuildingTypeTavern:     8,
+	BuildingTypeWell:       3,
+	BuildingTypeWall:       20,
+	BuildingTypeStorehouse: 8,
+}
+
+// buildingWorkers is the number of workers a workplace needs to be fully staffed.
+var buildingWorkers = map[string]int{
+	BuildingTypeSmithy:     2,
+	BuildingTypeMill:       2,
+	BuildingTypeLumberCamp: 4,
+	BuildingTypeMine:       5,
+	BuildingTypeTemple:     1,
+	BuildingTypeGuardhouse: 3,
+	BuildingTypeFarm:       1,
+	BuildingTypeWorkshop:   2,
+	BuildingTypeTavern:     1,
 }
 
 var buildingCapacity = map[string]int{
@@ -201,9 +393,27 @@ var buildingCapacity = map[string]int{
 	BuildingTypeHouse:  5,
 }
 
-var buildingYield = map[string]int{
-	BuildingTypeMarket: 10,
-	BuildingTypeHouse:  5,
+// buildingYield is the yield of a building per tick (if fully staffed by masters).
+// Houses have a small garden that feeds the household.
+var buildingYield = map[string]Stockpile{
+	BuildingTypeMarket:     {ResourceCoin: 10},
+	BuildingTypeHouse:      {ResourceFood: 2},
+	BuildingTypeSmithy:     {ResourceTools: 2},
+	BuildingTypeMill:       {ResourceFood: 12},
+	BuildingTypeLumberCamp: {ResourceWood: 8},
+	BuildingTypeMine:       {ResourceStone: 12},
+	BuildingTypeTemple:     {ResourceCoin: 2},
+	BuildingTypeGuardhouse: {ResourceCoin: 3},
+	BuildingTypeFarm:       {ResourceFood: 4}, // Per field.
+	BuildingTypeWorkshop:   {ResourceTools: 1},
+	BuildingTypeTavern:     {ResourceCoin: 6},
+}
+
+// buildingInputs are the resources a workplace consumes per tick to produce its yield.
+var buildingInputs = map[string]Stockpile{
+	BuildingTypeSmithy:   {ResourceWood: 1, ResourceStone: 1},
+	BuildingTypeWorkshop: {ResourceWood: 2},
+	BuildingTypeTavern:   {ResourceFood: 2},
 }
 
 func (m *Map) getHousingCapacity() int {
@@ -231,11 +441,11 @@ func distanceToBuilding(x, y int, b *Building) float64 {
 }
 
 // fitnessScoreMarketProximity returns the fitness score for any point on the map as a value between 0 and 1.
-func (m *Map) fitnessScoreMarketProximity(i int) float64 {
+func (m *Map) fitnessScoreMarketProximity(s *Settlement, i int) float64 {
 	// Add distance to the market. (closer is better)
 	x := i % m.Width
 	y := i / m.Width
-	return 1 - 1.0/(1.0+distanceToBuilding(x, y, m.Root))
+	return 1 - 1.0/(1.0+distanceToBuilding(x, y, s.Root))
 }
 
 func (m *Map) fitnessScoreBuildingProximity(i int, buildings []*Building) float64 {
@@ -365,7 +575,7 @@ func (m *Map) calcFitnessScoreDungeon() []float64 {
 		// TODO:
 		// - Maximize the distance to other dungeons.
 		for _, b := range m.Dungeons {
-			fit *= distanceToBuilding(i%m.Width, i/m.Width, b)
+			fit *= distanceToBuilding(i%m.Width, i/m.Width, b.Building)
 		}
 		// - Avoid corners of the map.
 		// fit += (1 - distToBorder[i]) // * distToCenter[i]
@@ -379,7 +589,7 @@ func (m *Map) calcFitnessScoreDungeon() []float64 {
 	return fitness
 }
 
-func (m *Map) calcFitnessScoreHouse(closerIsBetter bool) []float64 {
+func (m *Map) calcFitnessScoreHouse(s *Settlement, closerIsBetter bool) []float64 {
 	// If closerIsBetter is true, the fitness score will be higher for cells that are closer to other houses.
 	// This way, if a person isn't social, they can choose to live further away from other people.
 
@@ -396,18 +606,23 @@ func (m *Map) calcFitnessScoreHouse(closerIsBetter bool) []float64 {
 			// This cell is not suitable.
 			continue
 		}
+
+		// Can't build on fields, walls, etc.
+		if m.Zones[i] != nil {
+			continue
+		}
 		var fit float64
 
 		// Lower flux is better.
 		// fitness[i] = -m.Flux[i]
 
 		// Similar elevation to the market is better.
-		fit += 1.0 / (1.0 + math.Abs(m.Elevation[i]-m.Elevation[m.Root.X+m.Root.Y*m.Width]))
+		fit += 1.0 / (1.0 + math.Abs(m.Elevation[i]-m.Elevation[s.Root.X+s.Root.Y*m.Width]))
 
 		// Add distance to the market. (closer is better)
 		x := i % m.Width
 		y := i / m.Width
-		if distToBuild := distanceToBuilding(x, y, m.Root); distToBuild < 2.5 {
+		if distToBuild := distanceToBuilding(x, y, s.Root); distToBuild < 2.5 {
 			continue // Too close to the market.
 		} else {
 			fit += 1.0 / (1.0 + distToBuild)
@@ -442,12 +657,12 @@ func (m *Map) calcFitnessScoreHouse(closerIsBetter bool) []float64 {
 				}
 			}
 		}
-		// Add distance to the border of the map.
+		// Add distance to the outskirts of the settlement.
 		// NOTE: Yuk, this is a hack. We should use a proper distance function.
-		x -= m.Width / 2
-		y -= m.Height / 2
+		x -= s.Root.X
+		y -= s.Root.Y
 
-		// Now invert the distance, so that the center of the map has the highest score.
+		// Now invert the distance, so that the center of the settlement has the highest score.
 		distVal := math.Pow((1.0 - 1.0/(1.0+math.Sqrt(float64(x*x+y*y)))), 2)
 		fit += 1 - distVal
 
@@ -456,8 +671,8 @@ func (m *Map) calcFitnessScoreHouse(closerIsBetter bool) []float64 {
 	return fitness
 }
 
-func (m *Map) getHighestHouseFitness(closerIsBetter bool) (int, float64) {
-	fitness := m.calcFitnessScoreHouse(closerIsBetter)
+func (m *Map) getHighestHouseFitness(s *Settlement, closerIsBetter bool) (int, float64) {
+	fitness := m.calcFitnessScoreHouse(s, closerIsBetter)
 	best := 0
 	for i := range fitness {
 		if fitness[i] > fitness[best] {
@@ -28,6 +28,28 @@ func (tod TimeOfDay) String() string {
 	}
 }
 
+// daysInMonth is the number of days in each month of the year.
+var daysInMonth = [12]uint16{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// monthNames contains the names of the months.
+var monthNames = [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+
+// dayToDate converts the day of the year into the day of the month (1-31)
+// and the month (0-11).
+func dayToDate(day uint16) (int, int) {
+	// The calendar counts the days of the year from 1 (the 1st of January)
+	// to 365 (the 31st of December). Day 0 is only ever seen before the
+	// calendar starts ticking and is treated as the 1st of January as well.
+	day = max(day, 1) - 1
+	for month, n := range daysInMonth {
+		if day < n {
+			return int(day) + 1, month
+		}
+		day -= n
+	}
+	return 31, 11
+}
+
 type Calendar struct {
 	TimeOfDay float64
 	Day       uint16
@@ -65,3 +87,40 @@ func (c *Calendar) TickCalendar(elapsed float64) {
 		log.Printf("==========================Time of day changed from %s to %s!!!!!!!!!!!!!", prevTOD, newTOD)
 	}
 }
+
+// Season is a season of the year.
+type Season byte
+
+const (
+	SeasonWinter Season = iota
+	SeasonSpring
+	SeasonSummer
+	SeasonAutumn
+)
+
+func (s Season) String() string {
+	switch s {
+	case SeasonWinter:
+		return "winter"
+	case SeasonSpring:
+		return "spring"
+	case SeasonSummer:
+		return "summer"
+	case SeasonAutumn:
+		return "autumn"
+	default:
+		return "unknown"
+	}
+}
+
+// Season returns the season of the current day. Each season spans three
+// months, starting with winter in December.
+func (c *Calendar) Season() Season {
+	return Season((c.Month() + 1) % 12 / 3)
+}
+
+// Month returns the current month (0-11).
+func (c *Calendar) Month() int {
+	_, month := dayToDate(c.Day)
+	return month
+}
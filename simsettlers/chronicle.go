@@ -0,0 +1,400 @@
+package simsettlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Flokey82/go_gens/genstory"
+)
+
+// EventType is the type of an event in the village chronicle.
+type EventType byte
+
+const (
+	EventBirth      EventType = iota // A child was born.
+	EventDeath                       // Someone died.
+	EventEngagement                  // Two people got engaged.
+	EventMarriage                    // Two people got married.
+	EventDivorce                     // Two people got divorced.
+	EventBuilding                    // A building was finished.
+	EventAdventure                   // Something happened on an adventure.
+	EventBullying                    // Someone bullied someone else.
+	EventWeather                     // A storm, a harvest, etc.
+	EventEpidemic                    // An outbreak of a disease started or ended.
+	EventMigration                   // Someone arrived, left or founded a new settlement.
+	EventCrime                       // Someone was caught committing a crime.
+	EventFeud                        // A feud between two families broke out or ended.
+	numEventTypes
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventBirth:
+		return "birth"
+	case EventDeath:
+		return "death"
+	case EventEngagement:
+		return "engagement"
+	case EventMarriage:
+		return "marriage"
+	case EventDivorce:
+		return "divorce"
+	case EventBuilding:
+		return "building"
+	case EventAdventure:
+		return "adventure"
+	case EventBullying:
+		return "bullying"
+	case EventWeather:
+		return "weather"
+	case EventEpidemic:
+		return "epidemic"
+	case EventMigration:
+		return "migration"
+	case EventCrime:
+		return "crime"
+	case EventFeud:
+		return "feud"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a noteworthy event in the history of the village.
+type Event struct {
+	Type   EventType
+	Day    uint16
+	Year   int
+	People []*Person // The people involved, the protagonist first.
+	Detail string    // Depends on the type (e.g. the cause of death or the type of building).
+}
+
+// String returns a string representation of the event.
+func (e *Event) String() string {
+	str := fmt.Sprintf("day %d year %d: %s of %s", e.Day, e.Year, e.Type, joinNames(e.People))
+	if e.Detail != "" {
+		str += " (" + e.Detail + ")"
+	}
+	return str
+}
+
+// recordEvent adds an event to the chronicle of the village.
+func (m *Map) recordEvent(t EventType, detail string, people ...*Person) {
+	e := &Event{
+		Type:   t,
+		Day:    m.Day,
+		Year:   m.Year,
+		People: people,
+		Detail: detail,
+	}
+	m.Chronicle = append(m.Chronicle, e)
+	log.Printf("Chronicle: %v", e)
+}
+
+// EventsInYear returns all events of the given year in chronological order.
+func (m *Map) EventsInYear(year int) []*Event {
+	var events []*Event
+	for _, e := range m.Chronicle {
+		if e.Year == year {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// populationInYear returns the number of people alive at the end of the given year.
+func (m *Map) populationInYear(year int) int {
+	var n int
+	for _, p := range m.AllPeople() {
+		if p.Immigrant && p.ArrivalYear > year || p.Emigrated && p.DepartureYear <= year {
+			continue
+		}
+		if p.BirthYear <= year && (!p.Dead || p.DeathYear > year) {
+			n++
+		}
+	}
+	return n
+}
+
+// joinNames returns the names of the people as an enumeration
+// (e.g. "Hob Baker, Ana Baker and Wil Smith").
+func joinNames(people []*Person) string {
+	var names []string
+	for _, p := range people {
+		if p != nil {
+			names = append(names, p.Name())
+		}
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// plural returns the number and the word, in plural if the number isn't one
+// (e.g. "1 birth", "3 births").
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// capitalize returns the sentence with the first letter in upper case.
+func capitalize(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// Tokens used in the chronicle templates.
+const (
+	TokenChronicleName   = "[NAME]"   // The protagonist.
+	TokenChronicleOther  = "[OTHER]"  // The other party (e.g. spouse, parents, victim, builders).
+	TokenChronicleDetail = "[DETAIL]" // What happened (e.g. the cause of death).
+	TokenChronicleDate   = "[DATE]"   // When it happened (e.g. "in March").
+	TokenChronicleJoy    = "[JOY]"
+	TokenChronicleGrief  = "[GRIEF]"
+	TokenChronicleFolk   = "[FOLK]"
+)
+
+var chroniclePools = map[string][]string{
+	TokenChronicleJoy: {
+		"to the delight of the whole village",
+		"under a clear sky",
+		"and the bells of the temple rang",
+		"and there was much rejoicing",
+		"and a feast was held in their honor",
+	},
+	TokenChronicleGrief: {
+		"and was deeply mourned",
+		"and was laid to rest in the cemetery",
+		"and the village fell silent",
+		"and left an empty seat at the hearth",
+		"and few tears were shed",
+	},
+	TokenChronicleFolk: {
+		"the villagers",
+		"the neighbors",
+		"the elders",
+		"the gossips at the well",
+		"the whole village",
+	},
+}
+
+// newChronicleConfig returns a text config for the given templates that uses
+// the chronicle tokens and flavor pools.
+func newChronicleConfig(templates ...string) *genstory.TextConfig {
+	return &genstory.TextConfig{
+		TokenPools:       chroniclePools,
+		TokenIsMandatory: map[string]bool{},
+		Tokens: []string{
+			TokenChronicleName,
+			TokenChronicleOther,
+			TokenChronicleDetail,
+			TokenChronicleDate,
+			TokenChronicleJoy,
+			TokenChronicleGrief,
+			TokenChronicleFolk,
+		},
+		Templates:      templates,
+		UseAllProvided: true,
+	}
+}
+
+// chronicleConfigs contains the templates for each type of event.
+var chronicleConfigs = map[EventType]*genstory.TextConfig{
+	EventBirth: newChronicleConfig(
+		"[DATE], [NAME] was born to [OTHER], [JOY].",
+		"[OTHER] welcomed little [NAME] into the world [DATE].",
+		"[DATE], [FOLK] celebrated the birth of [NAME], child of [OTHER].",
+	),
+	EventDeath: newChronicleConfig(
+		"[DATE], [NAME] [DETAIL] [GRIEF].",
+		"[NAME] [DETAIL] [DATE], [GRIEF].",
+		"[DATE], [FOLK] learned that [NAME] [DETAIL].",
+	),
+	EventEngagement: newChronicleConfig(
+		"[DATE], [NAME] and [OTHER] got engaged.",
+		"[NAME] asked for the hand of [OTHER] [DATE].",
+		"[DATE], [FOLK] whispered that [NAME] and [OTHER] were to be wed.",
+	),
+	EventMarriage: newChronicleConfig(
+		"[DATE], [NAME] and [OTHER] were married, [JOY].",
+		"[NAME] wed [OTHER] [DATE], [JOY].",
+		"[DATE], [FOLK] gathered for the wedding of [NAME] and [OTHER].",
+	),
+	EventDivorce: newChronicleConfig(
+		"[DATE], [NAME] and [OTHER] went separate ways.",
+		"The marriage of [NAME] and [OTHER] ended [DATE].",
+		"[DATE], [FOLK] gossiped about the divorce of [NAME] and [OTHER].",
+	),
+	EventBuilding: newChronicleConfig(
+		"[DATE], [OTHER] finished building [NAME].",
+		"[NAME] was completed by [OTHER] [DATE].",
+		"[DATE], [FOLK] admired [NAME] that [OTHER] had built.",
+	),
+	EventAdventure: newChronicleConfig(
+		"[DATE], [NAME] [DETAIL].",
+		"[FOLK] told the tale of how [NAME] [DETAIL] [DATE].",
+		"[DATE], word spread that [NAME] [DETAIL].",
+	),
+	EventBullying: newChronicleConfig(
+		"[DATE], [NAME] picked on [OTHER].",
+		"[NAME] made life miserable for [OTHER] [DATE].",
+		"[DATE], [FOLK] saw [NAME] bully [OTHER].",
+	),
+	EventWeather: newChronicleConfig(
+		"[DATE], [DETAIL].",
+		"[FOLK] would long remember how [DETAIL] [DATE].",
+	),
+	EventEpidemic: newChronicleConfig(
+		"[DATE], [DETAIL].",
+		"Word spread [DATE] that [DETAIL].",
+		"[DATE], [FOLK] learned that [DETAIL].",
+	),
+	EventMigration: newChronicleConfig(
+		"[DATE], [NAME] [DETAIL].",
+		"[FOLK] saw [NAME] on the road [DATE], as they [DETAIL].",
+		"[DATE], word spread that [NAME] [DETAIL].",
+	),
+	EventCrime: newChronicleConfig(
+		"[DATE], [NAME] [DETAIL].",
+		"[FOLK] learned [DATE] that [NAME] [DETAIL].",
+		"[DATE], [FOLK] watched as [NAME] [DETAIL].",
+	),
+	EventFeud: newChronicleConfig(
+		"[DATE], [DETAIL].",
+		"[FOLK] would long remember how [DETAIL] [DATE].",
+		"[DATE], [FOLK] learned that [DETAIL].",
+	),
+}
+
+// Prose returns a sentence describing the event.
+func (e *Event) Prose() string {
+	_, month := dayToDate(e.Day)
+	tokens := []genstory.TokenReplacement{{
+		Token:       TokenChronicleDate,
+		Replacement: "in " + monthNames[month],
+	}}
+	add := func(token, replacement string) {
+		tokens = append(tokens, genstory.TokenReplacement{Token: token, Replacement: replacement})
+	}
+
+	switch e.Type {
+	case EventBirth:
+		add(TokenChronicleName, e.People[0].Name())
+		add(TokenChronicleOther, joinNames(e.People[1:]))
+	case EventWeather, EventEpidemic, EventFeud:
+		add(TokenChronicleDetail, e.Detail)
+	case EventDeath, EventAdventure, EventMigration:
+		add(TokenChronicleName, joinNames(e.People))
+		add(TokenChronicleDetail, e.Detail)
+	case EventCrime:
+		add(TokenChronicleName, e.People[0].Name())
+		add(TokenChronicleDetail, e.Detail)
+	case EventBuilding:
+		add(TokenChronicleName, "a new "+e.Detail)
+		if len(e.People) > 0 {
+			add(TokenChronicleOther, joinNames(e.People))
+		} else {
+			add(TokenChronicleOther, "the village")
+		}
+	default:
+		add(TokenChronicleName, e.People[0].Name())
+		add(TokenChronicleOther, joinNames(e.People[1:]))
+	}
+
+	text, err := chronicleConfigs[e.Type].Generate(tokens)
+	if err != nil {
+		log.Printf("Failed to describe %v: %v", e, err)
+		return capitalize(e.String()) + "."
+	}
+	return capitalize(text.Text)
+}
+
+// YearSummary returns a prose summary of the given year, with one paragraph
+// per type of event. Repeated events (e.g. someone bullying the same victim
+// day after day) are only described once.
+func (m *Map) YearSummary(year int) []string {
+	events := m.EventsInYear(year)
+	var births, deaths int
+	for _, e := range events {
+		switch e.Type {
+		case EventBirth:
+			births++
+		case EventDeath:
+			deaths++
+		}
+	}
+	paragraphs := []string{fmt.Sprintf("At the end of the year %d, the village counted %s, after %s and %s.", year, plural(m.populationInYear(year), "soul"), plural(births, "birth"), plural(deaths, "death"))}
+
+	for t := EventType(0); t < numEventTypes; t++ {
+		var sentences []string
+		var first []*Event
+		repeats := make(map[string]int)
+		for _, e := range events {
+			if e.Type != t {
+				continue
+			}
+			key := joinNames(e.People) + e.Detail
+			if repeats[key]++; repeats[key] == 1 {
+				first = append(first, e)
+			}
+		}
+		for _, e := range first {
+			s := e.Prose()
+			switch n := repeats[joinNames(e.People)+e.Detail]; {
+			case n == 2:
+				s += " It happened once more before the year was over."
+			case n > 2:
+				s += fmt.Sprintf(" It happened %d more times before the year was over.", n-1)
+			}
+			sentences = append(sentences, s)
+		}
+		if len(sentences) > 0 {
+			paragraphs = append(paragraphs, strings.Join(sentences, " "))
+		}
+	}
+	return paragraphs
+}
+
+// ExportChronicle exports the chronicle of the village as one Markdown file
+// per year (year_0001.md, year_0002.md, ...) into the given directory.
+func (m *Map) ExportChronicle(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if len(m.Chronicle) == 0 {
+		return nil
+	}
+	for year := m.Chronicle[0].Year; year <= m.Year; year++ {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("year_%04d.md", year)))
+		if err != nil {
+			return err
+		}
+		err = m.WriteChronicle(f, year)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteChronicle writes the chronicle of the given year in Markdown format.
+func (m *Map) WriteChronicle(w io.Writer, year int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# The Year %d\n", year)
+	for _, p := range m.YearSummary(year) {
+		fmt.Fprintf(bw, "\n%s\n", p)
+	}
+	return bw.Flush()
+}
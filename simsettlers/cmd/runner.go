@@ -1,15 +1,36 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/Flokey82/gameloop"
 	"github.com/Flokey82/genideas/simsettlers"
+	"github.com/hajimehoshi/ebiten"
+)
+
+var (
+	utilityAI = flag.Bool("utility_ai", false, "use the utility AI for the base motives of people")
+	viewer    = flag.Bool("viewer", false, "watch the village in an interactive viewer")
 )
 
 func main() {
+	flag.Parse()
+	if *viewer {
+		g := simsettlers.NewGame(200, 200)
+		g.Map.UtilityAI = *utilityAI
+		ebiten.SetWindowSize(simsettlers.ViewerWidth, simsettlers.ViewerHeight)
+		ebiten.SetWindowTitle("simsettlers")
+		ebiten.SetWindowResizable(true)
+		if err := ebiten.RunGame(g); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	m := simsettlers.NewMap(200, 200)
+	m.UtilityAI = *utilityAI
 	m.Settle()
 
 	loop := gameloop.New(time.Second/60, m.Tick)
@@ -20,10 +41,13 @@ func main() {
 
 	m.ExportPNG("test.png")
 
+	// Log the village storage.
+	fmt.Println("Village storage:", m.Resources.String())
+
 	// Log all houses and their occupants.
 	for _, b := range m.Buildings {
 		if b.Type == simsettlers.BuildingTypeHouse {
-			fmt.Println(b.String())
+			fmt.Println(b.String(), "-", b.Stock.String())
 			for _, p := range b.Occupants {
 				fmt.Printf("\t%v\n", p)
 				if p.Home != b {
@@ -45,6 +69,8 @@ func main() {
 		}
 		if p.Job == simsettlers.JobTypeUnemployed {
 			str += " (unemployed)"
+		} else {
+			str += fmt.Sprintf(" (%s, skill %.2f)", p.Job, p.Skills[p.Job])
 		}
 		fmt.Println(str)
 		// Log opinions.
@@ -58,5 +84,12 @@ func main() {
 		fmt.Printf("Cemetery: %v - %s\n", p, p.Goals.String())
 	}
 
+	// Export the family trees.
+	m.ExportGEDCOM("test.ged")
+	m.ExportDOT("test.dot")
+
+	// Export the chronicle of the village.
+	m.ExportChronicle("chronicle")
+
 	m.Export.ExportWebp("test.webp")
 }
@@ -20,8 +20,9 @@ func (o *ObjectType) New(l Location) *Object {
 
 type Object struct {
 	*ObjectType
-	Owner    *Person // The owner might be unknown?
-	Location         // Location might be a reference to a person, or a fixed location in the world.
+	Owner    *Person   // The owner might be unknown?
+	Building *Building // The building the object represents (if any)
+	Location           // Location might be a reference to a person, or a fixed location in the world.
 }
 
 // UpdateLocation updates the location of the object.
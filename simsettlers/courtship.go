@@ -0,0 +1,390 @@
+package simsettlers
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Personality holds the "big five" personality factors of a person.
+// Each factor ranges from -1 to 1.
+type Personality struct {
+	Openness          float64 // curious and inventive vs. consistent and cautious
+	Conscientiousness float64 // organized and ambitious vs. easy-going and careless
+	Extraversion      float64 // outgoing and energetic vs. solitary and reserved
+	Agreeableness     float64 // friendly and compassionate vs. critical and detached
+	Neuroticism       float64 // sensitive and nervous vs. resilient and confident
+}
+
+// randomPersonality returns a random personality.
+func randomPersonality() Personality {
+	return Personality{
+		Openness:          rand.Float64()*2 - 1,
+		Conscientiousness: rand.Float64()*2 - 1,
+		Extraversion:      rand.Float64()*2 - 1,
+		Agreeableness:     rand.Float64()*2 - 1,
+		Neuroticism:       rand.Float64()*2 - 1,
+	}
+}
+
+// inheritPersonality returns a personality that is a mix of the personalities
+// of the parents and some random variation.
+func inheritPersonality(mother, father *Person) Personality {
+	pers := randomPersonality()
+	for _, parent := range []*Person{mother, father} {
+		if parent == nil {
+			continue
+		}
+		pers.Openness += parent.Personality.Openness
+		pers.Conscientiousness += parent.Personality.Conscientiousness
+		pers.Extraversion += parent.Personality.Extraversion
+		pers.Agreeableness += parent.Personality.Agreeableness
+		pers.Neuroticism += parent.Personality.Neuroticism
+	}
+	// We average over the random personality and both parents, so missing
+	// parents leave a bit more to chance.
+	pers.Openness /= 3
+	pers.Conscientiousness /= 3
+	pers.Extraversion /= 3
+	pers.Agreeableness /= 3
+	pers.Neuroticism /= 3
+	return pers
+}
+
+// Compatibility returns how well two personalities get along (-1 to 1).
+// Similar interests and values help, while agreeable people get along with
+// everyone and neurotic people make life hard for their partners.
+func (a Personality) Compatibility(b Personality) float64 {
+	compat := 1 - math.Abs(a.Openness-b.Openness)/2 - math.Abs(a.Conscientiousness-b.Conscientiousness)/2
+	compat += (a.Agreeableness + b.Agreeableness) / 2
+	compat -= (max(a.Neuroticism, 0) + max(b.Neuroticism, 0)) / 2
+	return min(max(compat/2, -1), 1)
+}
+
+const (
+	courtshipMinAge      = 18    // Minimum age to court someone
+	courtshipAgeDiff     = 0.25  // Maximum age difference (as a fraction of the age)
+	courtshipDateOpinion = 10    // Opinion change per date (scaled by compatibility)
+	proposalOpinion      = 150   // Opinion required before proposing
+	engagementDays       = 30    // Days between the engagement and the wedding
+	marriageChance       = 0.05  // Chance per day that something happens in a marriage
+	divorceOpinion       = 50    // Opinion of the spouse below which a divorce is considered
+	divorceChance        = 0.01  // Chance per day that an unhappy marriage ends in divorce
+	menTakeFemaleName    = true  // If true, the husband takes the name of the wife
+	sameGenderCouples    = false // TODO: Allow same gender couples once we have adoption.
+)
+
+// isSingle returns true if the person is neither married nor engaged.
+func (p *Person) isSingle() bool {
+	return p.Spouse == nil && p.Fiance == nil
+}
+
+// isCloseRelative returns true if the two people are parent and child or siblings.
+func (p *Person) isCloseRelative(c *Person) bool {
+	if p.Mother == c || p.Father == c || c.Mother == p || c.Father == p {
+		return true
+	}
+	return p.Mother != nil && p.Mother == c.Mother || p.Father != nil && p.Father == c.Father
+}
+
+// isFormerSpouse returns true if we have been married to the given person before.
+func (p *Person) isFormerSpouse(c *Person) bool {
+	for _, s := range p.FormerSpouse {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// isEligiblePartner returns true if the person would consider the given
+// person as a partner.
+func (p *Person) isEligiblePartner(c *Person) bool {
+	if c == p || c.Dead || c.Age < courtshipMinAge || !c.isSingle() || !c.Goals.IsSet(GoalAdultPartner) {
+		return false
+	}
+	if c.Gender == p.Gender && !sameGenderCouples {
+		return false
+	}
+	if p.isCloseRelative(c) || p.isFormerSpouse(c) {
+		return false
+	}
+	// Check if we're on the same page regarding children.
+	// TODO: Check other goals as well.
+	if p.Goals.IsSet(GoalAdultChildren) != c.Goals.IsSet(GoalAdultChildren) {
+		return false
+	}
+	age := float64(min(p.Age, c.Age))
+	return math.Abs(float64(p.Age)-float64(c.Age)) < courtshipAgeDiff*age
+}
+
+// wealth returns the value of everything the person owns.
+func (p *Person) wealth() int {
+	w := p.Resources.Value()
+	for _, b := range p.Owns {
+		// NOTE: Buildings we have been evicted from might still be in the list.
+		if len(b.Owners) > 0 {
+			w += b.PurchasePrice() / len(b.Owners)
+		}
+	}
+	return w
+}
+
+// status returns the social standing of the person (0-1) based on their
+// wealth (compared to the average) and their mastery of their trade.
+func (p *Person) status(avgWealth float64) float64 {
+	w := float64(p.wealth())
+	s := w / (w + avgWealth + 1)
+	if p.Job != JobTypeUnemployed {
+		s += p.Skills[p.Job]
+	}
+	return s / 2
+}
+
+// averageWealth returns the average wealth of all adults.
+func (m *Map) averageWealth() float64 {
+	var total, n int
+	for _, p := range m.RealPop {
+		if !p.Dead && p.Age >= courtshipMinAge {
+			total += p.wealth()
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(total) / float64(n)
+}
+
+// partnerScore returns how attractive the given person is as a partner.
+// Depending on the personality, we care more about how much we like them,
+// how well we get along, or their status and wealth.
+func (p *Person) partnerScore(c *Person, avgWealth float64) float64 {
+	like := float64(p.Opinions.Value(c)) / 255
+	compat := p.Personality.Compatibility(c.Personality)
+	status := c.status(avgWealth)
+
+	// Agreeable people follow their heart, ambitious people look for a
+	// good catch, and open people are willing to give others a chance.
+	score := like * (1 + p.Personality.Agreeableness/2)
+	score += compat * (1 - p.Personality.Openness/2)
+	score += status * (1 + p.Personality.Conscientiousness) / 2
+	return score
+}
+
+// newCourtshipPlan returns the plan to fullfill the partner goal, or nil if
+// there is no one to court.
+// We pick the most attractive single we know (or get to know someone new)
+// and go on a date. If we like each other enough, we propose.
+func newCourtshipPlan(p *Person, m *Map) *Tree {
+	if !p.isSingle() || p.Age < courtshipMinAge {
+		return nil
+	}
+
+	var candidates []*Person
+	for _, c := range m.RealPop {
+		if p.isEligiblePartner(c) && c.isEligiblePartner(p) {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Sort by how attractive the candidates are to us.
+	avgWealth := m.averageWealth()
+	sort.Slice(candidates, func(i, j int) bool {
+		return p.partnerScore(candidates[i], avgWealth) > p.partnerScore(candidates[j], avgWealth)
+	})
+
+	// Extraverts are more likely to approach someone new.
+	c := candidates[0]
+	if len(candidates) > 1 && rand.Float64() < 0.25+p.Personality.Extraversion/4 {
+		c = candidates[rand.Intn(len(candidates))]
+	}
+
+	ct := newCourtshipTree(p, c, m, func() {
+		// The date went well, so we might propose (unless someone was
+		// quicker while we were on our way home).
+		if !p.isEligiblePartner(c) || !c.isEligiblePartner(p) || p.Opinions.Value(c) < proposalOpinion {
+			return
+		}
+		// The other person accepts if they like us enough, and the better
+		// a catch we are, the more likely they say yes.
+		if c.Opinions.Value(p) < proposalOpinion || rand.Float64() > c.partnerScore(p, avgWealth)/2 {
+			log.Printf("%v rejected the proposal of %v", c, p)
+			p.Opinions.IncrementBy(c, -courtshipDateOpinion)
+			return
+		}
+		m.engage(p, c)
+	}, func() {
+		// The date went badly.
+	})
+	return &ct
+}
+
+// newCourtshipTree creates a "behavior" tree for going on a date with a target.
+// NOTE: This is not a real behavior tree, but a simple sequence of tasks.
+func newCourtshipTree(p, target *Person, m *Map, onSuccess, onFailure func()) Tree {
+	// - Move to the target.
+	// - Go on a date.
+	// - Move back home.
+	homeX, homeY := int(p.X), int(p.Y)
+
+	tRoot := NewTaskMoveToXY(p, int(target.X), int(target.Y))
+	t := tRoot.Then(NewTaskGeneric(p, "Date", func(elapsed float64) TaskStatus {
+		// The date is off if they found someone else in the meantime.
+		if !target.isEligiblePartner(p) {
+			return TaskStatusFailed
+		}
+		// How the date goes depends on how well we get along, and a bit of luck.
+		compat := p.Personality.Compatibility(target.Personality)
+		p.Opinions.IncrementBy(target, int(courtshipDateOpinion*(compat+rand.Float64())))
+		target.Opinions.IncrementBy(p, int(courtshipDateOpinion*(compat+rand.Float64())))
+		if p.Opinions.Value(target) == 0 || target.Opinions.Value(p) == 0 {
+			return TaskStatusFailed
+		}
+		log.Printf("%v went on a date with %v", p, target)
+		return TaskStatusCompleted
+	}))
+	t.Then(NewTaskMoveToXY(p, homeX, homeY)) // Move back home.
+
+	return NewTree(tRoot, onSuccess, onFailure)
+}
+
+// engage engages the two people. The wedding takes place after engagementDays.
+func (m *Map) engage(a, b *Person) {
+	a.Fiance, b.Fiance = b, a
+	a.Engaged, b.Engaged = engagementDays, engagementDays
+	log.Printf("%v and %v are engaged", a, b)
+	m.recordEvent(EventEngagement, "", a, b)
+}
+
+// breakEngagement breaks off the engagement of the person (if any).
+func (p *Person) breakEngagement() {
+	if p.Fiance == nil {
+		return
+	}
+	p.Fiance.Fiance, p.Fiance.Engaged = nil, 0
+	p.Fiance, p.Engaged = nil, 0
+}
+
+// marry marries the two people and merges their households.
+func (m *Map) marry(a, b *Person) {
+	a.breakEngagement()
+	a.Spouse, b.Spouse = b, a
+
+	// Take the name of the spouse.
+	wife, husband := a, b
+	if a.Gender == GenderMale {
+		wife, husband = b, a
+	}
+	if menTakeFemaleName {
+		husband.LastName = wife.LastName
+	} else {
+		wife.LastName = husband.LastName
+	}
+	log.Printf("Married %v and %v", a, b)
+	m.recordEvent(EventMarriage, "", a, b)
+	m.mergeHouseholds(a, b)
+}
+
+// mergeHouseholds moves the newlyweds into a common home.
+// If both own a home, they move into the one in better condition, and
+// the other one can be sold. If neither owns a home, they stay where they
+// are until they find one (see handleHome).
+func (m *Map) mergeHouseholds(a, b *Person) {
+	if !a.OwnsOwnHome() && !b.OwnsOwnHome() {
+		return
+	}
+	if !a.OwnsOwnHome() || b.OwnsOwnHome() && b.Home.Condition > a.Home.Condition {
+		a, b = b, a
+	}
+	home := a.Home
+	old := b.Home
+	if old == home {
+		home.AddOwner(b)
+		return
+	}
+
+	// Move in with our children.
+	for _, c := range b.Children {
+		if !c.Dead && c.Age < courtshipMinAge && c.Home == old && old != nil {
+			c.SetHome(home)
+		}
+	}
+	b.SetHome(home)
+	home.AddOwner(b)
+
+	// Take the supplies along if nobody is left.
+	if old != nil && !old.IsOccupied() {
+		home.Stock.Add(old.Stock)
+		old.Stock = Stockpile{}
+	}
+}
+
+// divorce ends the marriage of the two people. The one who doesn't own the
+// home (or the one who wants out) moves out and is paid their share of the
+// home, as far as the other one can afford it. Children stay in the home.
+func (m *Map) divorce(a, b *Person) {
+	a.Spouse, b.Spouse = nil, nil
+	a.FormerSpouse = append(a.FormerSpouse, b)
+	b.FormerSpouse = append(b.FormerSpouse, a)
+	log.Printf("%v and %v got divorced", a, b)
+	m.recordEvent(EventDivorce, "", a, b)
+
+	home := a.Home
+	if home == nil || home != b.Home || home.Type != BuildingTypeHouse {
+		return
+	}
+	// a moves out unless b doesn't own the home.
+	if !b.OwnsOwnHome() {
+		a, b = b, a
+	}
+	if a.OwnsOwnHome() {
+		share := min(home.PurchasePrice()/len(home.Owners), b.Resources[ResourceCoin])
+		b.Resources[ResourceCoin] -= share
+		a.Resources[ResourceCoin] += share
+		home.RemoveOwner(a)
+	}
+	home.RemoveOccupant(a)
+	a.Home = nil
+}
+
+// tickCourtships advances engagements and marriages.
+func (m *Map) tickCourtships() {
+	for _, p := range m.RealPop {
+		if p.Dead {
+			continue
+		}
+
+		// Count down to the wedding.
+		if f := p.Fiance; f != nil {
+			if p.Engaged > 0 {
+				p.Engaged--
+			}
+			if p.Engaged == 0 && f.Engaged == 0 {
+				m.marry(p, f)
+			}
+			continue
+		}
+
+		// Every now and then, life happens and changes how the spouses see each other.
+		// We only handle each couple once (through the wife or the husband).
+		s := p.Spouse
+		if s == nil || p.Gender != GenderFemale && s.Gender == GenderFemale || rand.Float64() > marriageChance {
+			continue
+		}
+		compat := p.Personality.Compatibility(s.Personality)
+		p.Opinions.IncrementBy(s, int(courtshipDateOpinion*(compat+rand.Float64()-0.5)))
+		s.Opinions.IncrementBy(p, int(courtshipDateOpinion*(compat+rand.Float64()-0.5)))
+
+		// Unhappy couples might split up. Agreeable people try harder to make it work.
+		if p.Opinions.Value(s) < divorceOpinion && rand.Float64() < divorceChance*(1-p.Personality.Agreeableness) {
+			m.divorce(p, s)
+		} else if s.Opinions.Value(p) < divorceOpinion && rand.Float64() < divorceChance*(1-s.Personality.Agreeableness) {
+			m.divorce(s, p)
+		}
+	}
+}
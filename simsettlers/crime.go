@@ -0,0 +1,533 @@
+package simsettlers
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+)
+
+// CrimeType is the type of a crime.
+type CrimeType byte
+
+const (
+	CrimeTheft   CrimeType = iota // Someone stole coin or food.
+	CrimeAssault                  // Someone beat up someone else.
+	CrimeMurder                   // Someone killed someone else.
+)
+
+// String returns the name of the crime.
+func (c CrimeType) String() string {
+	switch c {
+	case CrimeTheft:
+		return "theft"
+	case CrimeAssault:
+		return "assault"
+	case CrimeMurder:
+		return "murder"
+	default:
+		return "unknown"
+	}
+}
+
+// Crime is a record of a crime and how it was punished (if at all).
+type Crime struct {
+	Type       CrimeType
+	Day        uint16
+	Year       int
+	Offender   *Person
+	Victim     *Person
+	Loot       Stockpile // What was stolen (theft only)
+	Caught     bool      // true if the offender was caught
+	Punishment string    // How the offender was punished (e.g. "fined 20 coin")
+}
+
+// String returns a string representation of the crime.
+func (c *Crime) String() string {
+	str := fmt.Sprintf("day %d year %d: %s of %s by %s", c.Day, c.Year, c.Type, c.Victim, c.Offender)
+	if c.Caught {
+		str += " (" + c.Punishment + ")"
+	} else {
+		str += " (unsolved)"
+	}
+	return str
+}
+
+// Feud is a long-running enmity between two families. Children inherit the
+// grudges of their parents, so a feud can outlive those who started it.
+type Feud struct {
+	Families       [2]string // The family names of the feuding families
+	StartYear      int       // Year the feud broke out
+	LastYear       int       // Year of the last incident
+	EndYear        int       // Year the feud ended (if over)
+	Incidents      int       // Crimes committed in the course of the feud
+	Deaths         int       // People killed in the course of the feud
+	Generations    int       // Generations that took part in the feud
+	FirstBirthYear int       // Birth year of the eldest person who started the feud
+	Over           bool      // true if the feud ended
+}
+
+// String returns a string representation of the feud.
+func (f *Feud) String() string {
+	str := fmt.Sprintf("feud between the %s and %s families since year %d (%d incidents, %d deaths, %d generations)", f.Families[0], f.Families[1], f.StartYear, f.Incidents, f.Deaths, f.Generations)
+	if f.Over {
+		str += fmt.Sprintf(", ended in year %d", f.EndYear)
+	}
+	return str
+}
+
+// involves returns true if the feud is between the families of the two people.
+func (f *Feud) involves(a, b *Person) bool {
+	return f.Families[0] == a.LastName && f.Families[1] == b.LastName || f.Families[0] == b.LastName && f.Families[1] == a.LastName
+}
+
+const (
+	theftChance         = 0.001 // Chance per day that a careless person in need steals something
+	theftGreed          = 0.1   // Share of the theft chance for people who are not in need
+	theftPoverty        = 10    // Coin below which a person is in need
+	theftHunger         = 5     // Household food below which a person is in need
+	theftMaxCoin        = 20    // Maximum coin stolen at once
+	theftMaxFood        = 10    // Maximum food stolen at once
+	theftGrudge         = 40    // Grudge of the victim against a thief who was caught
+	quarrelChance       = 0.005 // Chance per day that a hot-tempered person quarrels with someone they dislike
+	quarrelOpinion      = 60    // Opinion below which people quarrel with their acquaintances
+	quarrelGrudge       = 30    // Maximum grudge held after a quarrel
+	assaultChance       = 0.004 // Chance per day that a hot-tempered person attacks someone they hate
+	assaultHostility    = 120   // Hostility above which people attack each other
+	assaultSeverity     = 0.8   // Maximum severity of the injuries inflicted by an assault
+	assaultGrudge       = 80    // Grudge of the victim against their attacker
+	assaultRelief       = 60    // Grudge the attacker lets off by an assault
+	murderGrudge        = 200   // Grudge of the family of a murder victim against the murderer
+	kinGrudgeShare      = 0.5   // Share of the grudge the family of the victim holds
+	inheritedGrudge     = 0.5   // Share of the grudges of the parents that children adopt when they come of age
+	grudgeDecay         = 5     // Grudge forgotten each month
+	crimeMinAge         = 14    // Minimum age to commit crimes
+	crimeDetection      = 0.15  // Chance that a crime is solved without guards
+	guardDetection      = 0.25  // Chance per guard (master) that a crime is solved
+	crimeMaxDetection   = 0.9   // Maximum chance that a crime is solved
+	fineTheft           = 10    // Fine for theft (per conviction)
+	fineAssault         = 25    // Fine for assault if there is no prison (per conviction)
+	prisonDays          = 30    // Days in prison for assault (per conviction)
+	banishConvictions   = 5     // Convictions after which offenders are banished
+	feudGrudge          = 150   // Grudge above which a feud between the families breaks out
+	feudHostility       = 50    // Hostility between members of feuding families
+	feudPeaceYears      = 12    // Years without incidents after which a feud ends
+	feudGenerationYears = 25    // Years per generation in a feud
+)
+
+// hostility returns how much the person hates the other person, taking
+// feuds between their families into account.
+func (m *Map) hostility(p, o *Person) int {
+	h := p.Grudges.Value(o)
+	if f := m.feudBetween(p, o); f != nil {
+		h += feudHostility
+	}
+	return h
+}
+
+// temper returns how likely the person is to resort to violence (0-1).
+func (p *Person) temper() float64 {
+	return (2 - p.Personality.Agreeableness + p.Personality.Neuroticism) / 4
+}
+
+// kin returns the living members of the family of the person (by family
+// name), excluding the person themselves.
+func (m *Map) kin(p *Person) []*Person {
+	var kin []*Person
+	for _, o := range m.RealPop {
+		if o != p && !o.Dead && o.LastName == p.LastName {
+			kin = append(kin, o)
+		}
+	}
+	return kin
+}
+
+// aggrieve makes the victim (and their family) hold a grudge against the
+// offender. If the grudge runs deep enough, a feud breaks out between the
+// families.
+func (m *Map) aggrieve(victim, offender *Person, grudge int) {
+	victim.Grudges.IncrementBy(offender, grudge)
+	for _, o := range m.kin(victim) {
+		o.Grudges.IncrementBy(offender, int(float64(grudge)*kinGrudgeShare))
+	}
+	if victim.LastName != offender.LastName && victim.Grudges.Value(offender) >= feudGrudge && m.feudBetween(victim, offender) == nil {
+		f := &Feud{
+			Families:       [2]string{victim.LastName, offender.LastName},
+			StartYear:      m.Year,
+			LastYear:       m.Year,
+			Generations:    1,
+			FirstBirthYear: min(victim.BirthYear, offender.BirthYear),
+		}
+		detail := fmt.Sprintf("a feud broke out between the %s and %s families", f.Families[0], f.Families[1])
+
+		// Old feuds are never quite forgotten.
+		for _, old := range m.Feuds {
+			if old.involves(victim, offender) {
+				f.FirstBirthYear = min(f.FirstBirthYear, old.FirstBirthYear)
+				f.Generations = 1 + (max(victim.BirthYear, offender.BirthYear)-f.FirstBirthYear)/feudGenerationYears
+				detail = fmt.Sprintf("the old feud between the %s and %s families flared up again after %s", f.Families[0], f.Families[1], plural(m.Year-old.EndYear, "year"))
+			}
+		}
+		m.Feuds = append(m.Feuds, f)
+		log.Printf("A %v", f)
+		m.recordEvent(EventFeud, detail, victim, offender)
+	}
+}
+
+// feudBetween returns the ongoing feud between the families of the two
+// people (if any).
+func (m *Map) feudBetween(a, b *Person) *Feud {
+	if a.LastName == b.LastName {
+		return nil
+	}
+	for _, f := range m.Feuds {
+		if !f.Over && f.involves(a, b) {
+			return f
+		}
+	}
+	return nil
+}
+
+// inheritGrudges lets the person adopt the grudges of their parents when
+// they come of age.
+func (p *Person) inheritGrudges() {
+	for _, parent := range []*Person{p.Mother, p.Father} {
+		if parent == nil {
+			continue
+		}
+		for o := range parent.Grudges {
+			if o != p && !o.Dead {
+				p.Grudges.IncrementBy(o, int(float64(parent.Grudges.Value(o))*inheritedGrudge))
+			}
+		}
+	}
+}
+
+// prison returns a guardhouse in the settlement to lock up offenders (if any).
+func (m *Map) prison(s *Settlement) *Building {
+	for _, b := range m.Buildings {
+		if b.Type == BuildingTypeGuardhouse && b.Settlement == s && b.Remaining == 0 {
+			return b
+		}
+	}
+	return nil
+}
+
+// guards returns the guards on duty in the settlement.
+func (m *Map) guards(s *Settlement) []*Person {
+	var guards []*Person
+	for _, b := range m.Buildings {
+		if b.Type == BuildingTypeGuardhouse && b.Settlement == s && b.Remaining == 0 {
+			guards = append(guards, b.Workers...)
+		}
+	}
+	return guards
+}
+
+// detectionChance returns the chance that a crime in the settlement is solved.
+func (m *Map) detectionChance(s *Settlement) float64 {
+	chance := crimeDetection
+	for _, g := range m.guards(s) {
+		if g.Imprisoned == 0 && g.Party == nil && g.Missing == nil {
+			chance += guardDetection * skillFactor(g.Skills[JobTypeGuard]) * g.workCapacity()
+		}
+	}
+	return min(chance, crimeMaxDetection)
+}
+
+// isSuspect returns true if the person can commit crimes or fall victim to them today.
+func (p *Person) isSuspect() bool {
+	return !p.Dead && !p.Emigrated && p.Age >= crimeMinAge && p.Party == nil && p.Missing == nil && p.Imprisoned == 0
+}
+
+// steal lets the person steal coin (or food if their household is hungry)
+// from the wealthiest person in their settlement, or someone they hate.
+func (m *Map) steal(p *Person) {
+	s := m.settlementOf(p)
+	var victim *Person
+	var best int
+	for _, o := range m.inhabitants(s) {
+		if o == p || o.Home == p.Home || !o.isSuspect() || p.isCloseRelative(o) {
+			continue
+		}
+		if score := int(float64(o.Resources[ResourceCoin])*rand.Float64()) + p.Grudges.Value(o); victim == nil || score > best {
+			victim, best = o, score
+		}
+	}
+	if victim == nil {
+		return
+	}
+
+	var loot Stockpile
+	if p.household()[ResourceFood] < theftHunger {
+		loot[ResourceFood] = victim.household().Take(ResourceFood, 1+rand.Intn(theftMaxFood))
+		p.household()[ResourceFood] += loot[ResourceFood]
+	}
+	if loot.IsEmpty() {
+		loot[ResourceCoin] = victim.Resources.Take(ResourceCoin, 1+rand.Intn(theftMaxCoin))
+		p.Resources[ResourceCoin] += loot[ResourceCoin]
+	}
+	if loot.IsEmpty() {
+		return
+	}
+	c := m.recordCrime(CrimeTheft, p, victim)
+	c.Loot = loot
+	log.Printf("%v stole %s from %v", p, loot.String(), victim)
+	if m.solve(c) {
+		m.aggrieve(victim, p, theftGrudge)
+	}
+}
+
+// quarrel lets the person quarrel with an acquaintance they dislike. The
+// less they get along, the deeper the grudge they hold against each other.
+func (m *Map) quarrel(p *Person) {
+	var rivals []*Person
+	for _, o := range m.inhabitants(m.settlementOf(p)) {
+		if o != p && o.isSuspect() && p.Opinions.Counter(o) > 0 && p.Opinions.Value(o) < quarrelOpinion {
+			rivals = append(rivals, o)
+		}
+	}
+	if len(rivals) == 0 {
+		return
+	}
+	o := rivals[rand.Intn(len(rivals))]
+	compat := p.Personality.Compatibility(o.Personality)
+	log.Printf("%v quarreled with %v", p, o)
+	p.Opinions.IncrementBy(o, -quarrelGrudge)
+	o.Opinions.IncrementBy(p, -quarrelGrudge)
+	p.Grudges.IncrementBy(o, int(quarrelGrudge*p.temper()*(1-compat/2)))
+	o.Grudges.IncrementBy(p, int(quarrelGrudge*o.temper()*(1-compat/2)))
+}
+
+// assault lets the person attack someone they hate.
+func (m *Map) assault(p, victim *Person) {
+	log.Printf("%v attacked %v", p, victim)
+	p.Grudges.IncrementBy(victim, -assaultRelief)
+	victim.Opinions.IncrementBy(p, -assaultGrudge)
+	if f := m.feudBetween(p, victim); f != nil {
+		f.Incidents++
+		f.LastYear = m.Year
+		f.Generations = max(f.Generations, 1+(p.BirthYear-f.FirstBirthYear)/feudGenerationYears)
+	}
+	if !m.injure(victim, "assault", rand.Float64()*assaultSeverity) {
+		m.solve(m.recordCrime(CrimeAssault, p, victim))
+		m.aggrieve(victim, p, assaultGrudge)
+		return
+	}
+
+	// The victim died of their wounds.
+	if f := m.feudBetween(p, victim); f != nil {
+		f.Deaths++
+	}
+	m.solve(m.recordCrime(CrimeMurder, p, victim))
+	m.aggrieve(victim, p, murderGrudge)
+}
+
+// recordCrime records a crime.
+func (m *Map) recordCrime(t CrimeType, offender, victim *Person) *Crime {
+	c := &Crime{
+		Type:     t,
+		Day:      m.Day,
+		Year:     m.Year,
+		Offender: offender,
+		Victim:   victim,
+	}
+	m.Crimes = append(m.Crimes, c)
+	return c
+}
+
+// solve lets the guards try to catch the offender and brings them to justice.
+// Returns true if the offender was caught.
+func (m *Map) solve(c *Crime) bool {
+	if rand.Float64() >= m.detectionChance(m.settlementOf(c.Offender)) {
+		log.Printf("Unsolved %v", c)
+		return false
+	}
+	c.Caught = true
+	m.punish(c)
+	return true
+}
+
+// punish punishes the offender of the crime depending on the severity of
+// the crime and their previous convictions. Thieves have to pay back what
+// they stole and a fine, violent offenders go to prison (if the settlement
+// has a guardhouse), murderers and repeat offenders are banished.
+func (m *Map) punish(c *Crime) {
+	p := c.Offender
+	p.Convictions++
+	switch {
+	case c.Type == CrimeMurder || p.Convictions >= banishConvictions:
+		c.Punishment = "banished"
+	case c.Type == CrimeAssault && m.prison(m.settlementOf(p)) != nil:
+		p.Imprisoned = uint16(prisonDays * p.Convictions)
+		c.Punishment = fmt.Sprintf("imprisoned for %d days", p.Imprisoned)
+	default:
+		fine := fineTheft * p.Convictions
+		if c.Type == CrimeAssault {
+			fine = fineAssault * p.Convictions
+		}
+		m.fine(p, c.Victim, c.Loot, fine)
+		c.Punishment = fmt.Sprintf("fined %d coin", fine)
+	}
+	log.Printf("Solved %v", c)
+
+	m.recordEvent(EventCrime, c.detail(), p, c.Victim)
+	switch {
+	case c.Punishment == "banished":
+		m.banish(p)
+	case p.Imprisoned > 0:
+		b := m.prison(m.settlementOf(p))
+		p.quitJob()
+		p.breakEngagement()
+		p.CurrentMotive, p.CurrentTree = nil, nil
+		p.X, p.Y = float64(b.X), float64(b.Y)
+	}
+}
+
+// detail returns the detail of the chronicle entry for the (solved) crime.
+func (c *Crime) detail() string {
+	switch c.Type {
+	case CrimeTheft:
+		var loot []string
+		for r, n := range c.Loot {
+			if n > 0 {
+				loot = append(loot, fmt.Sprintf("%d %s", n, ResourceType(r)))
+			}
+		}
+		return fmt.Sprintf("was caught stealing %s from %s and %s", strings.Join(loot, " and "), c.Victim.Name(), c.Punishment)
+	case CrimeAssault:
+		return fmt.Sprintf("was %s for beating up %s", c.Punishment, c.Victim.Name())
+	default:
+		return fmt.Sprintf("was %s for the murder of %s", c.Punishment, c.Victim.Name())
+	}
+}
+
+// fine makes the offender return the loot to the victim and pay the fine to
+// the village. Whatever they can't pay becomes a debt.
+func (m *Map) fine(p, victim *Person, loot Stockpile, fine int) {
+	if victim != nil && !victim.Dead && !victim.Emigrated {
+		for r, n := range loot {
+			if ResourceType(r) == ResourceCoin {
+				continue
+			}
+			victim.household()[r] += p.household().Take(ResourceType(r), n)
+		}
+		if n := p.Resources.Take(ResourceCoin, loot[ResourceCoin]); n < loot[ResourceCoin] {
+			victim.Resources[ResourceCoin] += n
+			p.Debts = append(p.Debts, &Debt{Creditor: victim, Amount: loot[ResourceCoin] - n})
+		} else {
+			victim.Resources[ResourceCoin] += n
+		}
+	}
+	paid := p.Resources.Take(ResourceCoin, fine)
+	m.Resources[ResourceCoin] += paid
+	if paid < fine {
+		p.Debts = append(p.Debts, &Debt{Amount: fine - paid})
+	}
+	m.recordTransfer(p, nil, fmt.Sprintf("coin %d", paid), "fine")
+}
+
+// banish makes the person (and their family) leave the region for good.
+func (m *Map) banish(p *Person) {
+	s := m.settlementOf(p)
+	people := p.migrants()
+	m.leaveRegion(people...)
+	log.Printf("%v was banished from %v", p, s)
+	if len(people) > 1 {
+		m.recordEvent(EventMigration, "went into exile, banished from "+s.Name, people...)
+	}
+}
+
+// tickCrime lets people commit crimes, serves prison sentences, lets
+// grudges fade and feuds end.
+func (m *Map) tickCrime() {
+	// Serve prison sentences.
+	for _, p := range m.RealPop {
+		if p.Imprisoned > 0 {
+			if p.Imprisoned--; p.Imprisoned == 0 {
+				log.Printf("%v was released from prison", p)
+			}
+		}
+	}
+
+	// Let people commit crimes.
+	for _, p := range append([]*Person{}, m.RealPop...) {
+		if !p.isSuspect() {
+			continue
+		}
+
+		// Hot-tempered people attack those they hate the most.
+		if rand.Float64() < assaultChance*p.temper() {
+			var victim *Person
+			best := assaultHostility - 1
+			for _, o := range m.inhabitants(m.settlementOf(p)) {
+				if o == p || !o.isSuspect() {
+					continue
+				}
+				if h := m.hostility(p, o); h > best {
+					victim, best = o, h
+				}
+			}
+			if victim != nil {
+				m.assault(p, victim)
+				continue
+			}
+		}
+
+		// ... or quarrel with those they dislike.
+		if rand.Float64() < quarrelChance*p.temper() {
+			m.quarrel(p)
+		}
+
+		// Careless people in need (or greedy ones) steal.
+		chance := theftChance * (1 - p.Personality.Conscientiousness) / 2
+		if p.Resources[ResourceCoin] >= theftPoverty && (p.household() == nil || p.household()[ResourceFood] >= theftHunger) {
+			chance *= theftGreed
+		}
+		if p.Age >= 18 && rand.Float64() < chance {
+			m.steal(p)
+		}
+	}
+
+	// Grudges fade over time.
+	if day, _ := dayToDate(m.Day); day == 1 {
+		for _, p := range m.RealPop {
+			for o := range p.Grudges {
+				if p.Grudges.IncrementBy(o, -grudgeDecay); p.Grudges.Value(o) == 0 || o.Dead || o.Emigrated {
+					delete(p.Grudges, o)
+				}
+			}
+		}
+	}
+
+	m.tickFeuds()
+}
+
+// tickFeuds ends feuds if one of the families is gone or if there was peace
+// for long enough.
+func (m *Map) tickFeuds() {
+	families := make(map[string]bool)
+	for _, p := range m.RealPop {
+		if !p.Dead {
+			families[p.LastName] = true
+		}
+	}
+	for _, f := range m.Feuds {
+		if f.Over {
+			continue
+		}
+		var detail string
+		switch {
+		case !families[f.Families[0]] || !families[f.Families[1]]:
+			detail = fmt.Sprintf("the feud between the %s and %s families ended after %s, as one of the families was gone", f.Families[0], f.Families[1], plural(m.Year-f.StartYear, "year"))
+		case m.Year-f.LastYear >= feudPeaceYears:
+			detail = fmt.Sprintf("the %s and %s families made peace after %s of feuding", f.Families[0], f.Families[1], plural(m.Year-f.StartYear, "year"))
+		default:
+			continue
+		}
+		f.Over = true
+		f.EndYear = m.Year
+		log.Printf("Ended: %v", f)
+		m.recordEvent(EventFeud, detail)
+	}
+}
@@ -0,0 +1,608 @@
+package simsettlers
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+
+	"github.com/Flokey82/genideas/genstatblock5e"
+	"github.com/Flokey82/go_gens/genlanguage"
+)
+
+// Dungeons are persistent. Each dungeon has a number of levels, which are
+// populated by monsters guarding their hoard. Adventurers form parties and
+// venture into the dungeon, fighting their way down level by level, until
+// they have cleared the dungeon or decide to retreat. Over time, new monsters
+// move into the dungeon, so a cleared dungeon won't stay cleared forever.
+//
+// A party that loses a fight has to flee, and one of them might get killed
+// or captured. Captives can be rescued by family, friends or the guard, if
+// they reach them in time.
+
+const (
+	maxDungeonDepth         = 5    // Maximum number of levels of a dungeon
+	maxMonstersPerLevel     = 3    // Maximum number of monsters per level
+	dungeonRepopulateChance = 0.01 // Chance per day that a monster moves into a dungeon
+	maxPartySize            = 4    // Maximum number of people in a party
+	partyOpinion            = 50   // Opinion of the leader above which friends join a party
+	retreatHealth           = 50   // Health below which a party member wants to go home
+	adventureHealth         = 80   // Health required to set out on an adventure
+	rescueChance            = 0.05 // Chance per day that someone sets out to rescue a captive
+	captiveDays             = 90   // Days a captive survives in the dungeon
+)
+
+// monsterTypes are the monsters that can live in a dungeon, ordered by challenge rating.
+var monsterTypes = []genstatblock5e.Monster{
+	{Name: "bandit", Type: "humanoid", Size: genstatblock5e.Medium, ChallengeRate: 0.125, HitPoints: 11},
+	{Name: "snake", Type: "beast", Size: genstatblock5e.Small, ChallengeRate: 0.125, HitPoints: 5},
+	{Name: "goblin", Type: "humanoid", Size: genstatblock5e.Small, ChallengeRate: 0.25, HitPoints: 7},
+	{Name: "wolf", Type: "beast", Size: genstatblock5e.Medium, ChallengeRate: 0.25, HitPoints: 11},
+	{Name: "orc", Type: "humanoid", Size: genstatblock5e.Medium, ChallengeRate: 0.5, HitPoints: 15},
+	{Name: "spider", Type: "beast", Size: genstatblock5e.Large, ChallengeRate: 1, HitPoints: 26},
+	{Name: "bear", Type: "beast", Size: genstatblock5e.Large, ChallengeRate: 1, HitPoints: 34},
+	{Name: "troll", Type: "giant", Size: genstatblock5e.Large, ChallengeRate: 5, HitPoints: 84},
+	{Name: "giant", Type: "giant", Size: genstatblock5e.Huge, ChallengeRate: 5, HitPoints: 105},
+	{Name: "dragon", Type: "dragon", Size: genstatblock5e.Large, ChallengeRate: 10, HitPoints: 178},
+}
+
+// levelChallengeRate is the maximum challenge rating of monsters per dungeon level.
+var levelChallengeRate = [maxDungeonDepth]float64{0.25, 0.5, 1, 5, 10}
+
+// lootItem is a treasure that can be found in a dungeon.
+type lootItem struct {
+	Name  string
+	Value int // Value in coin
+	Level int // Minimum dungeon level the item can be found on
+}
+
+var lootTable = []lootItem{
+	{"rusty sword", 5, 1},
+	{"silver ring", 20, 1},
+	{"jeweled goblet", 60, 2},
+	{"ancient tome", 80, 2},
+	{"enchanted amulet", 150, 3},
+	{"giant's tooth", 100, 4},
+	{"mithril shirt", 300, 4},
+	{"dragon scale", 500, 5},
+}
+
+// Monster is a monster living on a level of a dungeon.
+type Monster struct {
+	genstatblock5e.Monster
+	Level int // Dungeon level the monster lives on
+}
+
+// newMonster returns a random monster that fits the given dungeon level.
+func newMonster(level int) *Monster {
+	var candidates []genstatblock5e.Monster
+	for _, t := range monsterTypes {
+		if t.ChallengeRate <= levelChallengeRate[level-1] {
+			candidates = append(candidates, t)
+		}
+	}
+	mo := &Monster{
+		Monster: candidates[rand.Intn(len(candidates))],
+		Level:   level,
+	}
+	mo.ArmorClass = genstatblock5e.CalcArmorClass(mo.Size, 10, 0)
+	mo.HitPoints = mo.HitPoints*3/4 + rand.Intn(mo.HitPoints/2+1)
+	return mo
+}
+
+// String returns the name of the monster including the article.
+func (mo *Monster) String() string {
+	return genlanguage.GetArticle(mo.Name) + " " + mo.Name
+}
+
+// threat returns how dangerous the monster is (compare combatPower).
+func (mo *Monster) threat() float64 {
+	return 3 * mo.ChallengeRate
+}
+
+// Captive is a person held captive in a dungeon.
+type Captive struct {
+	*Person
+	Level int    // Dungeon level the captive is held on
+	Days  uint16 // Days the captive has been held
+}
+
+// Dungeon is a dungeon with its monsters, their hoard and their captives.
+type Dungeon struct {
+	*Building
+	Depth    int         // Number of levels
+	Monsters []*Monster  // Monsters living in the dungeon
+	Loot     []Stockpile // Treasure hoarded on each level
+	Captives []*Captive  // People held captive in the dungeon
+	Cleared  bool        // True if all monsters have been defeated
+}
+
+// newDungeon creates a new dungeon of random depth in the given building
+// and populates it with monsters.
+func newDungeon(b *Building) *Dungeon {
+	d := &Dungeon{
+		Building: b,
+		Depth:    1 + rand.Intn(maxDungeonDepth),
+	}
+	d.Loot = make([]Stockpile, d.Depth)
+	for level := 1; level <= d.Depth; level++ {
+		for i := 0; i < 1+rand.Intn(maxMonstersPerLevel); i++ {
+			d.addMonster(level)
+		}
+	}
+	return d
+}
+
+// addMonster adds a new monster (and its hoard) to the given level.
+func (d *Dungeon) addMonster(level int) *Monster {
+	mo := newMonster(level)
+	d.Monsters = append(d.Monsters, mo)
+	d.Loot[level-1][ResourceCoin] += rand.Intn(20 * level * level)
+	d.Loot[level-1][ResourceTools] += rand.Intn(level + 1)
+	d.Cleared = false
+	return mo
+}
+
+// monstersOn returns the monsters on the given level.
+func (d *Dungeon) monstersOn(level int) []*Monster {
+	var monsters []*Monster
+	for _, mo := range d.Monsters {
+		if mo.Level == level {
+			monsters = append(monsters, mo)
+		}
+	}
+	return monsters
+}
+
+// removeMonster removes the given monster from the dungeon.
+func (d *Dungeon) removeMonster(mo *Monster) {
+	for i, m := range d.Monsters {
+		if m == mo {
+			d.Monsters = append(d.Monsters[:i], d.Monsters[i+1:]...)
+			break
+		}
+	}
+	d.Cleared = len(d.Monsters) == 0
+}
+
+// removeCaptive removes the given person from the captives of the dungeon.
+func (d *Dungeon) removeCaptive(p *Person) {
+	for i, c := range d.Captives {
+		if c.Person == p {
+			d.Captives = append(d.Captives[:i], d.Captives[i+1:]...)
+			p.Missing = nil
+			return
+		}
+	}
+}
+
+// tickDungeons lets monsters move into the dungeons and captives perish or
+// be rescued.
+func (m *Map) tickDungeons() {
+	for _, d := range m.Dungeons {
+		// New monsters move in.
+		if rand.Float64() < dungeonRepopulateChance {
+			level := 1 + rand.Intn(d.Depth)
+			if len(d.monstersOn(level)) < maxMonstersPerLevel {
+				wasCleared := d.Cleared
+				mo := d.addMonster(level)
+				if wasCleared {
+					log.Printf("%s moved into the cleared dungeon at %d,%d", mo, d.X, d.Y)
+				}
+			}
+		}
+
+		// Captives perish if no one comes to their rescue.
+		var captives []*Captive
+		for _, c := range d.Captives {
+			if c.Dead {
+				continue
+			}
+			if c.Days++; c.Days > captiveDays {
+				log.Printf("%v perished in the dungeon at %d,%d", c.Person, d.X, d.Y)
+				c.Missing = nil
+				m.handleDeath(c.Person, "perished as a captive in the dungeon")
+				continue
+			}
+			captives = append(captives, c)
+			if m.partyRescuing(c.Person) == nil && rand.Float64() < rescueChance {
+				m.sendRescueParty(d, c.Person)
+			}
+		}
+		d.Captives = captives
+	}
+}
+
+// Party is a group of people venturing into a dungeon.
+type Party struct {
+	Leader   *Person   // The person leading the way
+	Members  []*Person // All members (including the leader)
+	Dungeon  *Dungeon  // The dungeon we are exploring
+	Rescue   *Person   // The captive we came to rescue (if any)
+	Level    int       // The dungeon level we are on
+	Loot     Stockpile // The loot we found so far
+	Trophies []string  // Treasures we found so far
+	Tree     *Tree     // The plan of the party
+}
+
+// canAdventure returns true if the person is able to join a party.
+func (p *Person) canAdventure() bool {
+	return !p.Dead && p.Age >= 18 && p.Age < 65 && p.Party == nil && p.Missing == nil && p.Imprisoned == 0 &&
+		p.Health >= adventureHealth && !p.isInjured() && p.Illness == nil
+}
+
+// combatPower returns how well the person fights (compare Monster.threat).
+func (p *Person) combatPower() float64 {
+	power := 1.0
+	if p.Goals.IsSet(GoalAdultAdventurer) {
+		power += 0.5
+	}
+	if p.Job == JobTypeGuard {
+		power += p.Skills[JobTypeGuard]
+	}
+	if p.Resources[ResourceTools] > 0 {
+		power += 0.25 // We're armed.
+	}
+	power *= p.Health / healthMax
+	return max(power*(1-p.injurySeverity()), 0.1)
+}
+
+// nearestActiveDungeon returns the closest dungeon that still has monsters in it.
+func (m *Map) nearestActiveDungeon(p *Person) *Dungeon {
+	var best *Dungeon
+	var bestDist float64
+	for _, d := range m.Dungeons {
+		if d.Cleared {
+			continue
+		}
+		if dist := p.distanceTo(float64(d.X), float64(d.Y)); best == nil || dist < bestDist {
+			best, bestDist = d, dist
+		}
+	}
+	return best
+}
+
+// partyRescuing returns the party that is on its way to rescue the given person.
+func (m *Map) partyRescuing(p *Person) *Party {
+	for _, pa := range m.Parties {
+		if pa.Rescue == p {
+			return pa
+		}
+	}
+	return nil
+}
+
+// recruit returns up to n people who are willing and able to join a party,
+// sorted by the given score. Only people with a score > 0 are considered.
+func (m *Map) recruit(n int, score func(c *Person) float64) []*Person {
+	var candidates []*Person
+	for _, c := range m.RealPop {
+		if c.canAdventure() && score(c) > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return score(candidates[i]) > score(candidates[j])
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// handleAdventure executes / fullfilles the adventure goal.
+// We gather a party of fellow adventurers and friends, and venture into
+// the closest dungeon that still has monsters in it.
+func handleAdventure(p *Person, m *Map) {
+	if !p.canAdventure() {
+		return
+	}
+	d := m.nearestActiveDungeon(p)
+	if d == nil {
+		return // No monsters left to fight.
+	}
+
+	// Fellow adventurers are keen to join, friends join if they are open
+	// to new experiences.
+	companions := m.recruit(maxPartySize-1, func(c *Person) float64 {
+		if c == p {
+			return 0
+		}
+		score := float64(c.Opinions.Value(p)) / partyOpinion
+		if c.Goals.IsSet(GoalAdultAdventurer) {
+			score += 1
+		} else if score < 1 || c.Personality.Openness < 0 {
+			return 0
+		}
+		return score
+	})
+	m.startParty(p, companions, d, nil)
+}
+
+// sendRescueParty sends family, friends and guards to rescue the captive.
+func (m *Map) sendRescueParty(d *Dungeon, captive *Person) {
+	rescuers := m.recruit(maxPartySize, func(c *Person) float64 {
+		score := float64(c.Opinions.Value(captive)) / partyOpinion
+		if c.Spouse == captive || c.isCloseRelative(captive) {
+			score += 2
+		}
+		if c.Job == JobTypeGuard {
+			score += 1
+		}
+		if score < 1 {
+			return 0
+		}
+		return score
+	})
+	if len(rescuers) == 0 {
+		return
+	}
+	log.Printf("%v sets out to rescue %v", rescuers[0], captive)
+	m.startParty(rescuers[0], rescuers[1:], d, captive)
+}
+
+// startParty forms a party and sends it to the dungeon.
+func (m *Map) startParty(leader *Person, companions []*Person, d *Dungeon, rescue *Person) {
+	pa := &Party{
+		Leader:  leader,
+		Members: append([]*Person{leader}, companions...),
+		Dungeon: d,
+		Rescue:  rescue,
+		Level:   1,
+	}
+	for _, p := range pa.Members {
+		p.Party = pa
+		p.X, p.Y = leader.X, leader.Y
+
+		// We might not come back.
+		p.writeWill()
+	}
+	pa.Tree = m.newDungeonCrawl(pa)
+	m.Parties = append(m.Parties, pa)
+	log.Printf("%v leads a party of %d to the dungeon at %d,%d", leader, len(pa.Members), d.X, d.Y)
+}
+
+// tickParties advances all parties by one day.
+func (m *Map) tickParties() {
+	var parties []*Party
+	for _, pa := range m.Parties {
+		for i := 0; i < stepsPerDay && !pa.Tree.IsDone(); i++ {
+			pa.Tree.Step(1.0)
+
+			// The party sticks together.
+			for _, p := range pa.Members {
+				p.X, p.Y = pa.Leader.X, pa.Leader.Y
+			}
+		}
+		if pa.Tree.IsDone() {
+			pa.disband()
+			continue
+		}
+		parties = append(parties, pa)
+	}
+	m.Parties = parties
+}
+
+// disband sends everyone home.
+func (pa *Party) disband() {
+	for _, p := range pa.Members {
+		p.Party = nil
+	}
+}
+
+// removeMember removes the given person from the party. If the leader
+// leaves, the next member takes the lead.
+func (pa *Party) removeMember(p *Person) {
+	for i, c := range pa.Members {
+		if c == p {
+			pa.Members = append(pa.Members[:i], pa.Members[i+1:]...)
+			break
+		}
+	}
+	p.Party = nil
+	if pa.Leader == p && len(pa.Members) > 0 {
+		pa.Leader = pa.Members[0]
+	}
+}
+
+// power returns the combined combat power of the party.
+func (pa *Party) power() float64 {
+	var power float64
+	for _, p := range pa.Members {
+		if !p.Dead {
+			power += p.combatPower()
+		}
+	}
+	return power
+}
+
+// pressOn returns true if the party wants to explore the next level.
+func (pa *Party) pressOn() bool {
+	if len(pa.Members) == 0 || pa.Level > pa.Dungeon.Depth {
+		return false
+	}
+	if pa.Rescue != nil && pa.Rescue.Missing == nil {
+		return false // We found who we were looking for.
+	}
+	for _, p := range pa.Members {
+		if p.Health < retreatHealth {
+			return false
+		}
+	}
+	return true
+}
+
+// explore fights the next monster on the current level. Once the level is
+// cleared, we collect the loot, free any captives and descend to the next
+// level. Fails if we lost the fight.
+func (m *Map) explore(pa *Party) TaskStatus {
+	d := pa.Dungeon
+	if monsters := d.monstersOn(pa.Level); len(monsters) > 0 {
+		mo := monsters[0]
+		for _, p := range pa.Members {
+			p.Blackboard.Set(BlackboardEnemy, mo.Name)
+		}
+		if !m.fight(pa, mo) {
+			return TaskStatusFailed
+		}
+		return TaskStatusInProgress
+	}
+
+	// The level is cleared, so we take the hoard.
+	pa.Loot.Add(d.Loot[pa.Level-1])
+	d.Loot[pa.Level-1] = Stockpile{}
+	for _, it := range lootTable {
+		if it.Level <= pa.Level && rand.Intn(10) == 0 {
+			pa.Trophies = append(pa.Trophies, it.Name)
+			pa.Loot[ResourceCoin] += it.Value
+			log.Printf("%v found %s %s", pa.Leader, genlanguage.GetArticle(it.Name), it.Name)
+		}
+	}
+
+	// Free the captives on this level.
+	for _, c := range append([]*Captive{}, d.Captives...) {
+		if c.Level == pa.Level {
+			log.Printf("%v rescued %v", pa.Leader, c.Person)
+			m.recordEvent(EventAdventure, "rescued "+c.Name()+" from the dungeon", pa.Members...)
+			d.removeCaptive(c.Person)
+			c.Party = pa
+			pa.Members = append(pa.Members, c.Person)
+		}
+	}
+
+	pa.Level++
+	return TaskStatusCompleted
+}
+
+// fight lets the party fight the monster and returns true if the party won.
+// Even a won fight can leave scars, and a lost one can be deadly.
+func (m *Map) fight(pa *Party, mo *Monster) bool {
+	d := pa.Dungeon
+	power, threat := pa.power(), mo.threat()
+	risk := threat / (power + threat)
+
+	if rand.Float64() > risk {
+		log.Printf("%v's party killed %s on level %d", pa.Leader, mo, mo.Level)
+		d.removeMonster(mo)
+		if d.Cleared {
+			log.Printf("%v's party cleared the dungeon at %d,%d", pa.Leader, d.X, d.Y)
+			m.recordEvent(EventAdventure, "cleared the dungeon of its last monster, "+mo.String(), pa.Members...)
+		}
+		for _, p := range append([]*Person{}, pa.Members...) {
+			if rand.Float64() < risk/2 && m.injure(p, mo.Name, rand.Float64()*risk) {
+				p.Blackboard.Set(BlackboardKilledBy, mo.Name)
+				pa.removeMember(p)
+			}
+		}
+		return true
+	}
+
+	// We lost, so we flee. One of us doesn't get away unharmed.
+	var alive []*Person
+	for _, p := range pa.Members {
+		if !p.Dead {
+			alive = append(alive, p)
+		}
+	}
+	if len(alive) == 0 {
+		return false
+	}
+	p := alive[rand.Intn(len(alive))]
+	switch r := rand.Float64(); {
+	case r < 0.25:
+		log.Printf("%s died on an adventure, killed by %s", p, mo)
+		p.Blackboard.Set(BlackboardKilledBy, mo.Name)
+		pa.removeMember(p)
+		m.handleDeath(p, "was killed by "+mo.String()+" on an adventure")
+	case r < 0.5:
+		log.Printf("%s was captured by %s", p, mo)
+		m.recordEvent(EventAdventure, "was captured by "+mo.String(), p)
+		pa.removeMember(p)
+		p.Missing = d
+		d.Captives = append(d.Captives, &Captive{Person: p, Level: mo.Level})
+	default:
+		if m.injure(p, mo.Name, 0.5+rand.Float64()/2) {
+			p.Blackboard.Set(BlackboardKilledBy, mo.Name)
+			pa.removeMember(p)
+		}
+	}
+	return false
+}
+
+// newDungeonCrawl creates a behavior tree for going on an adventure.
+func (m *Map) newDungeonCrawl(pa *Party) *Tree {
+	// - Move to the dungeon (and give up if it takes too long).
+	// - Explore the dungeon level by level until we want to go home
+	//   (or until we have to flee).
+	// - Move back home.
+	p, d := pa.Leader, pa.Dungeon
+	homeX, homeY := int(p.X), int(p.Y)
+	members := append([]*Person(nil), pa.Members...) // Everyone who set out
+	var arrived bool
+
+	// If we take more than twice as long as expected to reach the dungeon,
+	// we give up and stay home.
+	timeout := 2 * p.distanceTo(float64(d.X), float64(d.Y)) / walkingSpeed
+
+	tRoot := NewTaskSequence(
+		NewTaskTimeout(pa.newTaskMove(d.X, d.Y), timeout), // Move to the dungeon.
+		NewTaskGeneric(p, "Arrive", func(elapsed float64) TaskStatus {
+			arrived = true
+			return TaskStatusCompleted
+		}),
+		NewTaskInverter(NewTaskRepeat(NewTaskSequence(
+			NewTaskCondition("PressOn", pa.pressOn),
+			NewTaskGeneric(p, "Explore", func(elapsed float64) TaskStatus {
+				return m.explore(pa)
+			}),
+		), 0)), // Explore until we retreat.
+		pa.newTaskMove(homeX, homeY), // Move back home.
+	)
+	t := NewTree(tRoot, func() {
+		m.shareLoot(pa)
+	}, func() {
+		if !arrived {
+			log.Printf("%v's party never made it to the dungeon", pa.Leader)
+			return
+		}
+		// Everyone was killed or captured in the dungeon.
+		log.Printf("%v's party was lost in the dungeon at %d,%d", p, d.X, d.Y)
+		m.recordEvent(EventAdventure, "never returned from the dungeon", members...)
+	})
+	return &t
+}
+
+// newTaskMove returns a task that moves the current leader of the party
+// (and with them, the party) to the given location.
+func (pa *Party) newTaskMove(x, y int) Task {
+	return NewTaskGeneric(pa.Leader, "MoveParty", func(elapsed float64) TaskStatus {
+		if len(pa.Members) == 0 {
+			return TaskStatusFailed
+		}
+		return NewTaskMoveToXY(pa.Leader, x, y).Do(elapsed)
+	})
+}
+
+// shareLoot shares the loot evenly among the surviving members of the party.
+func (m *Map) shareLoot(pa *Party) {
+	if len(pa.Members) == 0 {
+		return
+	}
+	for r, n := range pa.Loot {
+		share := n / len(pa.Members)
+		for _, p := range pa.Members {
+			p.Resources[r] += share
+		}
+		pa.Members[0].Resources[r] += n - share*len(pa.Members)
+	}
+	for _, t := range pa.Trophies {
+		p := pa.Members[rand.Intn(len(pa.Members))]
+		p.Trophies = append(p.Trophies, t)
+	}
+	log.Printf("%v's party returned from the dungeon with %s", pa.Members[0], pa.Loot.String())
+	detail := fmt.Sprintf("returned from the dungeon with loot worth %d coin", pa.Loot.Value())
+	for _, t := range pa.Trophies {
+		detail += ", " + genlanguage.GetArticle(t) + " " + t
+	}
+	m.recordEvent(EventAdventure, detail, pa.Members...)
+}
@@ -58,6 +58,9 @@ func (m *webpExport) ExportWebp(name string) error {
 }
 
 func (m *Map) storeWebPFrame() error {
+	if m.Export == nil {
+		return nil // Not recording (e.g. in the viewer).
+	}
 	// Write the current map to the animation.
 	// Create a colored image of the given width and height.
 	img := image.NewRGBA(image.Rect(0, 0, m.Width, m.Height))
@@ -99,6 +102,16 @@ func (m *Map) drawFrame(img *image.RGBA) {
 		}
 	}
 
+	// Draw forests and rocks (the more is left, the darker).
+	for i, t := range m.TileType {
+		switch t {
+		case TileTypeForest:
+			img.Set(i%m.Width, i/m.Width, color.RGBA{0, uint8(200 - 100*m.Deposits[i]/depositForest), 0, 255})
+		case TileTypeRock:
+			img.Set(i%m.Width, i/m.Width, color.RGBA{uint8(200 - 100*m.Deposits[i]/depositRock), 80, 60, 255})
+		}
+	}
+
 	// Draw the flux.
 	for x := 0; x < m.Width; x++ {
 		for y := 0; y < m.Height; y++ {
@@ -111,6 +124,17 @@ func (m *Map) drawFrame(img *image.RGBA) {
 		}
 	}
 
+	// Draw the fields and wall segments.
+	for _, b := range m.Buildings {
+		c := color.RGBA{220, 200, 90, 255}
+		if b.Type == BuildingTypeWall {
+			c = color.RGBA{70, 70, 70, 255}
+		}
+		for _, i := range b.Plots {
+			img.Set(i%m.Width, i/m.Width, c)
+		}
+	}
+
 	// Draw the buildings.
 	for _, b := range m.Buildings {
 		img.Set(b.X, b.Y, color.RGBA{255, 0, 0, 255})
@@ -121,12 +145,18 @@ func (m *Map) drawFrame(img *image.RGBA) {
 		img.Set(b.X, b.Y, color.RGBA{255, 255, 0, 255})
 	}
 
-	// Draw the root building.
-	img.Set(m.Root.X, m.Root.Y, color.RGBA{0, 255, 0, 255})
+	// Draw the root buildings of the settlements.
+	for _, s := range m.Settlements {
+		img.Set(s.Root.X, s.Root.Y, color.RGBA{0, 255, 0, 255})
+	}
 
 	// Draw the dungeon.
 	for _, d := range m.Dungeons {
-		img.Set(d.X, d.Y, color.RGBA{233, 128, 0, 255})
+		if d.Cleared {
+			img.Set(d.X, d.Y, color.RGBA{128, 128, 128, 255})
+		} else {
+			img.Set(d.X, d.Y, color.RGBA{233, 128, 0, 255})
+		}
 	}
 
 	// Draw the people.
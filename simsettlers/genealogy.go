@@ -0,0 +1,247 @@
+package simsettlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// gedcomEpoch is added to all years in the GEDCOM export, since GEDCOM
+// requires years with at least three digits and the first settlers were
+// born before year 0.
+const gedcomEpoch = 1000
+
+var gedcomMonths = [12]string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+// AllPeople returns everyone who ever lived in the village (living and dead),
+// including relatives that are only known through their family ties.
+func (m *Map) AllPeople() []*Person {
+	var people []*Person
+	seen := make(map[*Person]bool)
+	queue := append(append(append([]*Person{}, m.RealPop...), m.Cemetery.Occupants...), m.Emigrants...)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if p == nil || seen[p] {
+			continue
+		}
+		seen[p] = true
+		people = append(people, p)
+		queue = append(queue, p.Mother, p.Father, p.Spouse)
+		queue = append(queue, p.FormerSpouse...)
+		queue = append(queue, p.Children...)
+	}
+	return people
+}
+
+// family is a couple and / or the children they had together.
+type family struct {
+	Husband  *Person
+	Wife     *Person
+	Children []*Person
+	Married  bool // The couple is (or was) married.
+	Divorced bool // The couple got divorced.
+}
+
+// genealogy holds everyone who ever lived in the village and their families.
+type genealogy struct {
+	People   []*Person
+	IDs      map[*Person]int
+	Families []*family
+	familyOf map[[2]*Person]*family
+}
+
+func (m *Map) newGenealogy() *genealogy {
+	g := &genealogy{
+		People:   m.AllPeople(),
+		IDs:      make(map[*Person]int),
+		familyOf: make(map[[2]*Person]*family),
+	}
+	for i, p := range g.People {
+		g.IDs[p] = i + 1
+	}
+	for _, p := range g.People {
+		if p.Spouse != nil {
+			g.family(p, p.Spouse).Married = true
+		}
+		for _, s := range p.FormerSpouse {
+			f := g.family(p, s)
+			f.Married = true
+			// Divorced couples are in each other's list of former spouses,
+			// widows and widowers only in one.
+			if s.isFormerSpouse(p) {
+				f.Divorced = true
+			}
+		}
+		if p.Mother != nil || p.Father != nil {
+			f := g.family(p.Mother, p.Father)
+			f.Children = append(f.Children, p)
+		}
+	}
+	return g
+}
+
+// family returns the family of the given couple (creating it if needed).
+func (g *genealogy) family(a, b *Person) *family {
+	if a != nil && a.Gender == GenderMale || b != nil && b.Gender == GenderFemale {
+		a, b = b, a
+	}
+	key := [2]*Person{a, b}
+	if f, ok := g.familyOf[key]; ok {
+		return f
+	}
+	f := &family{Wife: a, Husband: b}
+	g.familyOf[key] = f
+	g.Families = append(g.Families, f)
+	return f
+}
+
+// familiesOf returns the IDs of the families the person is a spouse or child in.
+func (g *genealogy) familiesOf(p *Person) (spouse []int, child []int) {
+	for i, f := range g.Families {
+		if f.Husband == p || f.Wife == p {
+			spouse = append(spouse, i+1)
+		}
+		for _, c := range f.Children {
+			if c == p {
+				child = append(child, i+1)
+			}
+		}
+	}
+	return spouse, child
+}
+
+// gedcomDate returns the given day and year as GEDCOM date.
+func gedcomDate(day uint16, year int) string {
+	d, month := dayToDate(day)
+	return fmt.Sprintf("%d %s %04d", d, gedcomMonths[month], year+gedcomEpoch)
+}
+
+// ExportGEDCOM exports the genealogy of the village as GEDCOM 5.5.1 file.
+func (m *Map) ExportGEDCOM(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.WriteGEDCOM(f)
+}
+
+// WriteGEDCOM writes the genealogy of the village in GEDCOM 5.5.1 format.
+func (m *Map) WriteGEDCOM(w io.Writer) error {
+	g := m.newGenealogy()
+	bw := bufio.NewWriter(w)
+
+	// Header.
+	fmt.Fprintln(bw, "0 HEAD")
+	fmt.Fprintln(bw, "1 SOUR SIMSETTLERS")
+	fmt.Fprintln(bw, "1 SUBM @U1@")
+	fmt.Fprintln(bw, "1 GEDC")
+	fmt.Fprintln(bw, "2 VERS 5.5.1")
+	fmt.Fprintln(bw, "2 FORM LINEAGE-LINKED")
+	fmt.Fprintln(bw, "1 CHAR UTF-8")
+
+	// Submitter (required by the standard).
+	fmt.Fprintln(bw, "0 @U1@ SUBM")
+	fmt.Fprintln(bw, "1 NAME SimSettlers")
+
+	// Individuals.
+	for _, p := range g.People {
+		fmt.Fprintf(bw, "0 @I%d@ INDI\n", g.IDs[p])
+		fmt.Fprintf(bw, "1 NAME %s /%s/\n", p.FirstName, p.LastName)
+		fmt.Fprintf(bw, "1 SEX %s\n", p.genderString())
+		fmt.Fprintln(bw, "1 BIRT")
+		fmt.Fprintf(bw, "2 DATE %s\n", gedcomDate(p.Birthday, p.BirthYear))
+		if p.Dead {
+			fmt.Fprintln(bw, "1 DEAT")
+			fmt.Fprintf(bw, "2 DATE %s\n", gedcomDate(p.DeathDay, p.DeathYear))
+		}
+		if p.Job != JobTypeUnemployed {
+			fmt.Fprintf(bw, "1 OCCU %s\n", p.Job)
+		}
+		spouse, child := g.familiesOf(p)
+		for _, id := range spouse {
+			fmt.Fprintf(bw, "1 FAMS @F%d@\n", id)
+		}
+		for _, id := range child {
+			fmt.Fprintf(bw, "1 FAMC @F%d@\n", id)
+		}
+	}
+
+	// Families.
+	for i, f := range g.Families {
+		fmt.Fprintf(bw, "0 @F%d@ FAM\n", i+1)
+		if f.Husband != nil {
+			fmt.Fprintf(bw, "1 HUSB @I%d@\n", g.IDs[f.Husband])
+		}
+		if f.Wife != nil {
+			fmt.Fprintf(bw, "1 WIFE @I%d@\n", g.IDs[f.Wife])
+		}
+		if f.Married {
+			fmt.Fprintln(bw, "1 MARR Y")
+		}
+		if f.Divorced {
+			fmt.Fprintln(bw, "1 DIV Y")
+		}
+		for _, c := range f.Children {
+			fmt.Fprintf(bw, "1 CHIL @I%d@\n", g.IDs[c])
+		}
+	}
+	fmt.Fprintln(bw, "0 TRLR")
+	return bw.Flush()
+}
+
+// ExportDOT exports the family tree of the village as Graphviz DOT file.
+func (m *Map) ExportDOT(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.WriteDOT(f)
+}
+
+// WriteDOT writes the family tree of the village in Graphviz DOT format.
+// Every family is a small node that connects the parents with their children.
+func (m *Map) WriteDOT(w io.Writer) error {
+	g := m.newGenealogy()
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph family {")
+	fmt.Fprintln(bw, "\trankdir=TB;")
+	fmt.Fprintln(bw, "\tnode [shape=box, style=filled];")
+	for _, p := range g.People {
+		lifespan := fmt.Sprintf("* %d", p.BirthYear)
+		if p.Dead {
+			lifespan += fmt.Sprintf(" † %d", p.DeathYear)
+		}
+		color := "lightpink"
+		if p.Gender == GenderMale {
+			color = "lightblue"
+		}
+		if p.Dead {
+			color = "lightgrey"
+		}
+		fmt.Fprintf(bw, "\tI%d [label=%q, fillcolor=%s];\n", g.IDs[p], p.FirstName+" "+p.LastName+"\n"+lifespan, color)
+	}
+	for i, f := range g.Families {
+		style := "solid"
+		if f.Divorced {
+			style = "dashed"
+		} else if !f.Married {
+			style = "dotted"
+		}
+		fmt.Fprintf(bw, "\tF%d [shape=point, label=\"\"];\n", i+1)
+		for _, parent := range []*Person{f.Husband, f.Wife} {
+			if parent != nil {
+				fmt.Fprintf(bw, "\tI%d -> F%d [dir=none, style=%s];\n", g.IDs[parent], i+1, style)
+			}
+		}
+		for _, c := range f.Children {
+			fmt.Fprintf(bw, "\tF%d -> I%d;\n", i+1, g.IDs[c])
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
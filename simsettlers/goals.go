@@ -5,8 +5,6 @@ import (
 	"math"
 	"math/rand"
 	"sort"
-
-	"github.com/Flokey82/go_gens/genlanguage"
 )
 
 func (m *Map) tickPersonGoals(p *Person, elapsed float64) {
@@ -46,15 +44,7 @@ func (m *Map) tickPersonGoals(p *Person, elapsed float64) {
 		}
 
 		// Check if we want to find a partner.
-		if p.Goals.IsSet(GoalAdultPartner) {
-			// TODO: Go through the list of people that we know,
-			// and pick the person we consider the best match.
-			// Depending on the personality, we might have different
-			// criteria for what makes a good match. It might be who
-			// we like the most, who we hate the least, who is the
-			// most attractive / high status, who is the most wealthy,
-			// etc.
-		}
+		// NOTE: This is handled by MotiveTypeCourtship (see newCourtshipPlan).
 	} else {
 		// m.tickElderly(p)
 	}
@@ -78,10 +68,11 @@ func (p *Person) assignAdultGoals() {
 	// If both parents have a trait, the chance of the child having it is higher.
 	if rand.Intn(100) < 90 {
 		p.Goals |= GoalAdultPartner
+		p.Motives = append(p.Motives, MotiveTypeCourtship.New())
 	}
 	if rand.Intn(100) < 90 {
 		p.Goals |= GoalAdultHome
-		p.Motives = append(p.Motives, MotiveTypeBuildHouse.New())
+		p.Motives = append(p.Motives, MotiveTypeBuildHouse.New(), MotiveTypeGather.New())
 	}
 	if rand.Intn(100) < 90 {
 		p.Goals |= GoalAdultChildren
@@ -97,6 +88,8 @@ func (p *Person) assignAdultGoals() {
 }
 
 func (p *Person) assignElderlyGoals() {
+	// Time to get our affairs in order.
+	p.writeWill()
 }
 
 type Goal uint32
@@ -380,13 +373,14 @@ func handleBully(p *Person, m *Map) {
 		}
 		bt := newBullyTree(p, victim, func() {
 			// We bullied the victim.
+			m.recordEvent(EventBullying, "", p, victim)
 		}, func() {
 			// Bullying failed.
 			if rand.Intn(100) < 10 {
-				// TODO: This is a crime committed by the victim,
-				// we need to find a way to handle this.
+				// The family of the bully won't forget this.
+				m.aggrieve(p, victim, murderGrudge)
 				log.Printf("%v killed %v", victim, p)
-				m.handleDeath(p)
+				m.handleDeath(p, "was killed by "+victim.Name()+", whom they bullied")
 			} else {
 				// The bully will be forced to respect the victim a little more.
 				log.Printf("%v injured %v", victim, p)
@@ -400,26 +394,32 @@ func handleBully(p *Person, m *Map) {
 	}
 }
 
+// homeRepairCondition is the condition below which owners repair their home.
+const homeRepairCondition = 90
+
 // handleHome executes / fullfilles the home goal.
 func handleHome(p *Person, m *Map) {
-	repairHome := false
-
 	// Check if we own our own home.
 	if p.OwnsOwnHome() {
-		// Check if we need to repair our home.
+		// Check if we need to repair our home (e.g. after a storm).
+		// We buy the wood at the market if we don't have any.
 		// TODO:
 		// - Make the decision to repair or not based on personality
 		// and the condition of the building.
 		// - Any occupant should be able to repair the home if they are
 		// old enough, have enough resources, and are crafty enough.
-		if repairHome && p.Home.Condition < 100 && p.Resources > 0 {
+		repairHome := p.Home.Condition < homeRepairCondition
+		if repairHome && p.Resources[ResourceWood] == 0 {
+			m.buy(p, ResourceWood, 1)
+		}
+		if repairHome && p.Resources[ResourceWood] > 0 {
 
 			// TREE:
 			// - Move to house location.
 			// - Repair house at a certain rate.
 			// - Move back home.
 			p.Home.Condition++
-			p.Resources--
+			p.Resources[ResourceWood]--
 		}
 		return
 	}
@@ -454,10 +454,7 @@ func handleHome(p *Person, m *Map) {
 	// We want to move to a new place if:
 	// - we don't have a home.
 	// - we live with our parents, have a spouse, and/or can afford to build a house.
-	budget := p.Resources
-	if p.Spouse != nil {
-		budget += p.Spouse.Resources
-	}
+	budget := p.budget()
 
 	// TODO: If there is a house in bad condition available,
 	// we should be able to buy it for a lower price!
@@ -465,29 +462,36 @@ func handleHome(p *Person, m *Map) {
 	// Check if there is an existing house that we can move into.
 	// Either, because it is abandoned, or because there are no occupants.
 	// (Inherited from parents, or because the owners died.)
+	s := m.settlementOf(p)
 	for _, b := range m.Buildings {
-		if b.Type != BuildingTypeHouse || b.IsOccupied() {
+		if b.Type != BuildingTypeHouse || b.IsOccupied() || b.Settlement != s {
 			continue
 		}
 		if b.IsOwned() {
 			// Buy it from the owner.
 			// Calculate the purchase price based on the condition of the building.
 			purchasePrice := b.PurchasePrice()
-			if budget < purchasePrice {
-				//log.Printf("Not enough resources to buy a house")
-				continue
+			if budget[ResourceCoin] < purchasePrice {
+				// We can borrow part of the price from the village.
+				loan := purchasePrice - budget[ResourceCoin]
+				if float64(loan) > float64(purchasePrice)*mortgageShare || loan > m.Resources[ResourceCoin] {
+					//log.Printf("Not enough resources to buy a house")
+					continue
+				}
+				m.lend(p, loan)
 			}
 
 			// Split the cost between the owners.
-			cost := purchasePrice / len(b.Owners)
-			for _, o := range b.Owners {
-				o.Resources += cost
+			sellers := append([]*Person{}, b.Owners...)
+			cost := purchasePrice / len(sellers)
+			for _, o := range sellers {
+				o.Resources[ResourceCoin] += cost
+				m.transferBuilding(b, o, p, "sale")
 			}
-			b.Occupants = nil
-			b.Owners = nil
 
-			// Deduct the cost from the resources of the buyer.
-			p.Resources -= cost
+			// Deduct the cost from the resources of the buyer (and spouse).
+			p.pay(Stockpile{ResourceCoin: cost * len(sellers)})
+			b.Occupants = nil
 
 			// Move in.
 			p.SetHome(b)
@@ -509,19 +513,29 @@ func handleHome(p *Person, m *Map) {
 	}
 
 	// Can we afford to build a new house?
-	if budget < buildingCosts[BuildingTypeHouse] {
-		//log.Printf("Not enough resources to build a house")
-		return
+	// We buy missing materials from the village if we have the coin,
+	// otherwise we have to gather them ourselves (see MotiveTypeGather).
+	materials := buildingCosts[BuildingTypeHouse]
+	if !budget.Has(materials) {
+		missing := budget.Missing(materials)
+		if budget[ResourceCoin]-materials[ResourceCoin] < missing.Value() || !m.Resources.Has(missing) {
+			//log.Printf("Not enough resources to build a house")
+			return
+		}
+		for r, n := range missing {
+			m.buy(p, ResourceType(r), n)
+		}
 	}
 
 	// TODO: Find a suitable location for the house.
 	// If we are social, we want to live closer to other people.
-	best, score := m.getHighestHouseFitness(p.Goals.IsSet(GoalChildhoodSocialize))
+	best, score := m.getHighestHouseFitness(s, p.Goals.IsSet(GoalChildhoodSocialize))
 	if score != -1 {
 		log.Printf("Building a house for %v", p)
 
 		// Construct the house.
 		home := m.AddBuilding(best%m.Width, best/m.Width, BuildingTypeHouse)
+		home.Settlement = s
 		home.AddOwner(p)
 		p.Constructing = append(p.Constructing, home)
 
@@ -533,92 +547,60 @@ func handleHome(p *Person, m *Map) {
 			}
 			p.Spouse.Constructing = append(p.Spouse.Constructing, home)
 		}
-		// TODO: Deduct from resources from both partners.
-		p.Resources -= buildingCosts[BuildingTypeHouse]
+		p.pay(materials)
 	} else {
 		log.Printf("No suitable location for a house found")
 	}
 }
 
-// newDungeonCrawl creates a "behavior" tree for going on an adventure.
-// NOTE: This is not a real behavior tree, but a simple sequence of tasks.
-func newDungeonCrawl(p *Person, d *Building, onSuccess, onFailure func()) Tree {
-	// - Move to the dungeon.
-	// - Fight the monster.
-	// - Move back home.
-	homeX, homeY := int(p.X), int(p.Y)
-
-	// Pick a random enemy.
-	enemies := []string{"goblin", "troll", "dragon", "bear", "wolf", "orc", "giant", "spider", "snake", "bandit"}
-	enemy := enemies[rand.Intn(len(enemies))]
-
-	// Pick a random duration for the fight.
-	dur := rand.Float64() * 10
-
-	// TODO: What if we simply fail to reach the dungeon?
-	// In this case, we should probably just go back home.
-	log.Printf("%s is going to the location at %d,%d", p.String(), d.X, d.Y)
-	tRoot := NewTaskMoveToXY(p, d.X, d.Y) // Move to the dungeon.
-	t := tRoot.Then(NewTaskGeneric(p, "FightMonster", func(elapsed float64) TaskStatus {
-		dur -= elapsed
-		if dur <= 0 {
-			if rand.Intn(100) < 10 {
-				log.Printf("%s died on an adventure, killed by %s %s", p.String(), genlanguage.GetArticle(enemy), enemy)
-				return TaskStatusFailed
-			}
-			log.Printf("%s killed %s %s", p.String(), genlanguage.GetArticle(enemy), enemy)
-			return TaskStatusCompleted
-		}
-		log.Printf("%s is fighting %s %s (%.2f/%.2f)", p.String(), genlanguage.GetArticle(enemy), enemy, dur, elapsed)
-		return TaskStatusInProgress
-	})) // Fight the monster.
-	t.Then(NewTaskMoveToXY(p, homeX, homeY)) // Move back home.
-
-	return NewTree(tRoot, onSuccess, onFailure)
+// missingMaterials returns the materials we still need to build a house
+// (if we want one and can't afford to buy them).
+func (p *Person) missingMaterials() Stockpile {
+	if !p.Goals.IsSet(GoalAdultHome) || p.Age < 18 || p.OwnsOwnHome() || p.Constructing != nil {
+		return Stockpile{}
+	}
+	budget := p.budget()
+	missing := budget.Missing(buildingCosts[BuildingTypeHouse])
+	missing[ResourceCoin] = 0
+	return missing
 }
 
-// handleAdventure executes / fullfilles the adventure goal.
-func handleAdventure(p *Person, m *Map) {
-	// Check if there is an adventure available to scratch that itch.
-	// ... or if we are already on an adventure.
-	// We're going on an adventure!
-	// There is a chance that we die on our adventure.
-
-	// Pick a random dungeon (TODO: Handle case if there are no dungeons
-	dcTree := newDungeonCrawl(p, m.Dungeons[rand.Intn(len(m.Dungeons))], func() {
-		// We survived the adventure.
-		loot := rand.Intn(1000)
-		p.Resources += loot
-		log.Printf("%s went on an adventure and found %d resources", p.String(), loot)
-	}, func() {
-		// TODO: What if we just go missing? Could someone save us?
-		// We died on our adventure.
-		// We might be declared missing, someone might find our body,
-		// or we might never be found.
-		// TODO: Inheritence, ownership, legally dead, etc.
-		m.handleDeath(p)
-	})
-	if !dcTree.Do(1.0) {
-		log.Println("Adventure failed")
+// newGatherPlan returns the plan to fullfill the goal of gathering materials
+// for a house, or nil if there is nothing (left) to gather.
+func newGatherPlan(p *Person, m *Map) *Tree {
+	// Harvest the first material we are missing from the closest deposit.
+	for r, n := range p.missingMaterials() {
+		if n <= 0 {
+			continue
+		}
+		i := m.nearestDeposit(int(p.X), int(p.Y), ResourceType(r))
+		if i == -1 {
+			continue
+		}
+		ht := newHarvestTree(p, m, i, func() {
+			// We brought the materials home.
+		}, func() {
+			// Someone else harvested the tile before us.
+			log.Println("Gathering failed")
+		})
+		return &ht
 	}
+	return nil
 }
 
 // handleJob executes / fullfilles the job goal.
 func handleJob(p *Person, m *Map) {
-	// We have a job, so we should work.
-
 	// Check if we don't have a job yet and want one.
-	// TODO: This would require a place to work...
-	// Like, working on another farm, or upgrade the house with a farm plot, etc.
+	// Farmers keep an eye out for a job that suits them better.
+	if p.Job == JobTypeUnemployed || p.Job == JobTypeFarmer && rand.Intn(100) < 1 {
+		m.findJob(p)
+	}
 	if p.Job == JobTypeUnemployed {
-		p.Job = JobTypeFarmer
+		return
 	}
 
-	// If we have a job, we can earn resources.
-	// We might have a job, even though it is not our goal.
-	// Maybe start with 16 years old?
-	if p.Job != JobTypeUnemployed && rand.Intn(100) < 10 {
-		// TODO: Maybe use fractional resources?
-		p.Resources += 1 // 1 is quite a lot for a single day?
-	}
+	// Working improves our skill.
+	// Workers in a workplace get paid wages from the yield of the building
+	// and farmers harvest their plots (see Map.Tick).
+	p.train()
 }
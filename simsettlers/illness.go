@@ -0,0 +1,340 @@
+package simsettlers
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+)
+
+// Disease is a kind of illness.
+type Disease struct {
+	Name        string  // How the disease is referred to (e.g. "the flu")
+	Incubation  int     // Maximum days until the first symptoms show
+	Duration    int     // Maximum days the symptoms last
+	Severity    float64 // Maximum health lost per day
+	Contagion   float64 // Chance per day to infect someone in the same home (0 = not contagious)
+	WorkPenalty float64 // Share of the work output lost while sick
+	Immunity    bool    // True if survivors can't catch the disease ever again (otherwise only during the same epidemic)
+}
+
+var (
+	diseaseChill = &Disease{Name: "a chill", Duration: 7, Severity: 2, WorkPenalty: 0.3}
+	diseaseFlu   = &Disease{Name: "the flu", Incubation: 3, Duration: 10, Severity: 2.5, Contagion: 0.2, WorkPenalty: 0.6}
+	diseasePox   = &Disease{Name: "the red pox", Incubation: 12, Duration: 20, Severity: 6, Contagion: 0.15, WorkPenalty: 0.8, Immunity: true}
+	diseaseFlux  = &Disease{Name: "the bloody flux", Incubation: 5, Duration: 14, Severity: 8, Contagion: 0.1, WorkPenalty: 0.9}
+)
+
+// outbreakDiseases are the contagious diseases that can break out in the village.
+var outbreakDiseases = []*Disease{diseaseFlu, diseasePox, diseaseFlux}
+
+// Illness is a disease a person suffers from.
+type Illness struct {
+	*Disease
+	Incubating uint16 // days until the first symptoms show
+	Remaining  uint16 // days until the person recovers
+	Treated    bool   // true if a healer treated the person today
+}
+
+// String returns a string representation of the illness.
+func (i *Illness) String() string {
+	if i.Incubating > 0 {
+		return fmt.Sprintf("%s (incubating, %d days)", i.Name, i.Incubating)
+	}
+	return fmt.Sprintf("%s (%d days left)", i.Name, i.Remaining)
+}
+
+// HasSymptoms returns true if the incubation period is over.
+func (i *Illness) HasSymptoms() bool {
+	return i.Incubating == 0
+}
+
+// Epidemic is an outbreak of a contagious disease in the village.
+// Only outbreaks that infect at least epidemicCases people are recorded
+// in the chronicle.
+type Epidemic struct {
+	*Disease
+	PatientZero *Person          // the first person infected
+	Cases       int              // number of people infected
+	Deaths      int              // number of people who died of the disease
+	Over        bool             // true if nobody is infected anymore
+	Immune      map[*Person]bool // people who recovered from the disease
+}
+
+const (
+	chillChance       = 0.002 // Chance per day to catch a chill in cold and wet weather
+	chillTemperature  = 5.0   // Temperature below which people can catch a chill
+	outbreakChance    = 0.002 // Chance per day that a contagious disease breaks out
+	socialContagion   = 0.25  // Contagion between friends and neighbors relative to the same home
+	socialOpinion     = 100   // Opinion above which friends meet regularly
+	foeOpinion        = 30    // Opinion below which acquaintances are foes (who run into each other all the same)
+	healerPatients    = 4     // Patients a priest can treat per day
+	treatmentHealing  = 0.5   // Share of the health loss prevented by treatment
+	treatmentFee      = 2     // Coin a patient pays for treatment (if they can afford it)
+	convalescentRatio = 0.5   // Share of the work output of the sick that is lost while treated
+	frailDamage       = 2.5   // Factor of the health loss of small children and the elderly
+	epidemicCases     = 3     // Cases after which an outbreak is considered an epidemic
+)
+
+// infect infects the person with the disease (unless they are already sick
+// or immune) and returns true if they got infected.
+func (m *Map) infect(p *Person, d *Disease) bool {
+	if p.Dead || p.Illness != nil || p.Immunities[d] {
+		return false
+	}
+	e := m.epidemic(d)
+	if e != nil && e.Immune[p] {
+		return false
+	}
+	p.Illness = &Illness{
+		Disease:    d,
+		Incubating: uint16(rand.Intn(d.Incubation + 1)),
+		Remaining:  uint16(1 + rand.Intn(d.Duration)),
+	}
+	if e != nil {
+		if e.Cases++; e.Cases == epidemicCases {
+			m.recordEvent(EventEpidemic, "an epidemic of "+d.Name+" broke out, starting with "+e.PatientZero.Name())
+		}
+	}
+	log.Printf("%v caught %v", p, p.Illness)
+	return true
+}
+
+// epidemic returns the ongoing epidemic of the disease (if any).
+func (m *Map) epidemic(d *Disease) *Epidemic {
+	for _, e := range m.Epidemics {
+		if e.Disease == d && !e.Over {
+			return e
+		}
+	}
+	return nil
+}
+
+// isSick returns true if the person shows symptoms of an illness.
+func (p *Person) isSick() bool {
+	return p.Illness != nil && p.Illness.HasSymptoms()
+}
+
+// workCapacity returns the share of their usual work output the person
+// can produce. The sick can't work as hard (unless they are treated).
+func (p *Person) workCapacity() float64 {
+	if !p.isSick() {
+		return 1
+	}
+	if p.Illness.Treated {
+		return 1 - p.Illness.WorkPenalty*convalescentRatio
+	}
+	return 1 - p.Illness.WorkPenalty
+}
+
+// contacts returns the people the person meets regularly: the people living
+// in the same home, and friends and foes (see socialOpinion and foeOpinion).
+// NOTE: Opinions of strangers are 0 as well, so foes are acquaintances we
+// think poorly of.
+func (p *Person) contacts() (home, social []*Person) {
+	if p.Home != nil && p.Home.Type == BuildingTypeHouse {
+		for _, o := range p.Home.Occupants {
+			if o != p {
+				home = append(home, o)
+			}
+		}
+	}
+	for o := range p.Opinions {
+		v := p.Opinions.Value(o)
+		if (v >= socialOpinion || p.Opinions.Counter(o) > 0 && v <= foeOpinion) && o.Home != p.Home {
+			social = append(social, o)
+		}
+	}
+	return home, social
+}
+
+// outbreak lets a random contagious disease break out. Someone brings it
+// back from a trip (or a traveler passing through).
+func (m *Map) outbreak() {
+	d := outbreakDiseases[rand.Intn(len(outbreakDiseases))]
+	if len(m.RealPop) == 0 || m.epidemic(d) != nil {
+		return
+	}
+	p := m.RealPop[rand.Intn(len(m.RealPop))]
+	if p.Dead || p.Missing != nil || p.Illness != nil || p.Immunities[d] {
+		return
+	}
+	e := &Epidemic{Disease: d, PatientZero: p, Immune: make(map[*Person]bool)}
+	m.Epidemics = append(m.Epidemics, e)
+	m.infect(p, d)
+	log.Printf("An outbreak of %s started with %v", d.Name, p)
+}
+
+// tickIllness lets people catch a chill in cold and wet weather, spreads
+// contagious diseases, lets healers treat the sick, and lets the sick
+// recover (or succumb to their illness).
+func (m *Map) tickIllness() {
+	w := &m.Weather
+	chance := 0.0
+	if w.Temperature < chillTemperature {
+		chance = chillChance
+		if w.Rain > 0 {
+			chance *= 2
+		}
+		if w.IsFreezing() {
+			chance *= 2
+		}
+	}
+	// Diseases break out more often in the cold months when people
+	// huddle together.
+	if rand.Float64() < outbreakChance*(1+chance/chillChance) {
+		m.outbreak()
+	}
+
+	// Spread the contagious diseases. People who are already sick or
+	// infected today only become contagious tomorrow.
+	var contagious []*Person
+	for _, p := range m.RealPop {
+		if !p.Dead && p.Missing == nil && p.isSick() && p.Illness.Contagion > 0 {
+			contagious = append(contagious, p)
+		}
+	}
+	for _, p := range contagious {
+		home, social := p.contacts()
+		for _, o := range home {
+			if rand.Float64() < p.Illness.Contagion {
+				m.infect(o, p.Illness.Disease)
+			}
+		}
+		for _, o := range social {
+			if o.Missing == nil && rand.Float64() < p.Illness.Contagion*socialContagion {
+				m.infect(o, p.Illness.Disease)
+			}
+		}
+	}
+
+	m.treatSick()
+
+	for _, p := range m.RealPop {
+		if p.Dead || p.Missing != nil {
+			continue
+		}
+		if p.Illness == nil {
+			if rand.Float64() < chance*p.chillExposure() {
+				m.infect(p, diseaseChill)
+			}
+			continue
+		}
+		m.advanceIllness(p)
+	}
+
+	// Epidemics are over once nobody is infected anymore.
+	for _, e := range m.Epidemics {
+		if !e.Over && !m.isInfected(e.Disease) {
+			e.Over = true
+			log.Printf("The outbreak of %s is over (%d cases, %d deaths)", e.Name, e.Cases, e.Deaths)
+			if e.Cases >= epidemicCases {
+				m.recordEvent(EventEpidemic, fmt.Sprintf("the epidemic of %s ended after %s and %s", e.Name, plural(e.Cases, "case"), plural(e.Deaths, "death")))
+			}
+		}
+	}
+}
+
+// isInfected returns true if anyone in the village has the disease.
+func (m *Map) isInfected(d *Disease) bool {
+	for _, p := range m.RealPop {
+		if !p.Dead && p.Illness != nil && p.Illness.Disease == d {
+			return true
+		}
+	}
+	return false
+}
+
+// advanceIllness advances the illness of the person by one day.
+func (m *Map) advanceIllness(p *Person) {
+	in := p.Illness
+	if !in.HasSymptoms() {
+		if in.Incubating--; in.Incubating == 0 {
+			log.Printf("%v shows symptoms of %s", p, in.Name)
+		}
+		return
+	}
+	damage := in.Severity * (0.5 + rand.Float64()/2)
+	if p.Age < 5 || p.Age >= 65 {
+		damage *= frailDamage
+	}
+	if in.Treated {
+		damage *= 1 - treatmentHealing
+	}
+	p.Health -= damage
+	if p.Health <= 0 {
+		log.Printf("%v died of %s", p, in.Name)
+		if e := m.epidemic(in.Disease); e != nil {
+			e.Deaths++
+		}
+		m.handleDeath(p, "died of "+in.Name)
+		return
+	}
+	if in.Remaining--; in.Remaining == 0 {
+		log.Printf("%v recovered from %s", p, in.Name)
+		if in.Immunity {
+			if p.Immunities == nil {
+				p.Immunities = make(map[*Disease]bool)
+			}
+			p.Immunities[in.Disease] = true
+		} else if e := m.epidemic(in.Disease); e != nil {
+			e.Immune[p] = true
+		}
+		p.Illness = nil
+	}
+}
+
+// treatSick lets the priests of the temples treat the sick, the most
+// severe cases first. Patients pay a small fee if they can afford it.
+func (m *Map) treatSick() {
+	var patients []*Person
+	for _, p := range m.RealPop {
+		if !p.Dead && p.Missing == nil && p.isSick() {
+			p.Illness.Treated = false
+			patients = append(patients, p)
+		}
+	}
+	if len(patients) == 0 {
+		return
+	}
+	sort.Slice(patients, func(i, j int) bool {
+		return patients[i].Health < patients[j].Health
+	})
+
+	for _, b := range m.Buildings {
+		if b.Type != BuildingTypeTemple {
+			continue
+		}
+		for _, healer := range b.Workers {
+			if healer.isSick() {
+				continue
+			}
+			n := int(float64(healerPatients) * skillFactor(healer.Skills[JobTypePriest]))
+			for ; n > 0 && len(patients) > 0; n-- {
+				p := patients[0]
+				patients = patients[1:]
+				p.Illness.Treated = true
+				fee := min(treatmentFee, p.Resources[ResourceCoin])
+				p.Resources[ResourceCoin] -= fee
+				healer.Resources[ResourceCoin] += fee
+				log.Printf("%v treated %v for %s", healer, p, p.Illness.Name)
+			}
+		}
+	}
+}
+
+// chillExposure returns how likely the person is to catch a chill compared to
+// a healthy adult with a roof over their head.
+func (p *Person) chillExposure() float64 {
+	exposure := 1.0
+	if p.Home == nil {
+		exposure *= 5
+	}
+	if p.Age < 5 || p.Age >= 65 {
+		exposure *= 2
+	}
+	if p.isInjured() {
+		exposure *= 2
+	}
+	return exposure
+}
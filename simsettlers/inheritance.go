@@ -0,0 +1,399 @@
+package simsettlers
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// SuccessionLaw determines who inherits the estate of someone who died.
+type SuccessionLaw byte
+
+const (
+	SuccessionSpouseFirst   SuccessionLaw = iota // The spouse inherits everything, otherwise the estate is split among the next of kin.
+	SuccessionPrimogeniture                      // The eldest child (or their eldest descendant) inherits everything.
+	SuccessionPartible                           // The spouse inherits half, the children split the rest.
+	SuccessionWill                               // The heirs named in the will inherit, otherwise spouse first.
+)
+
+// String returns the name of the succession law.
+func (s SuccessionLaw) String() string {
+	switch s {
+	case SuccessionSpouseFirst:
+		return "spouse first"
+	case SuccessionPrimogeniture:
+		return "primogeniture"
+	case SuccessionPartible:
+		return "partible inheritance"
+	case SuccessionWill:
+		return "will"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	willFriendOpinion = 200 // Opinion above which friends are named in our will
+	debtInstallment   = 5   // Coin paid back per day
+	mortgageShare     = 0.5 // Share of the purchase price of a house that can be borrowed
+)
+
+// Transfer is a record of property changing hands.
+type Transfer struct {
+	Day    uint16
+	Year   int
+	From   *Person // nil if the village is the previous owner
+	To     *Person // nil if the village is the new owner
+	What   string  // What was transferred (e.g. "coin 50" or "house at (3, 4 cond 100)")
+	Reason string  // Why the property was transferred (e.g. "inheritance")
+}
+
+// String returns a string representation of the transfer.
+func (t *Transfer) String() string {
+	from, to := "the village", "the village"
+	if t.From != nil {
+		from = t.From.String()
+	}
+	if t.To != nil {
+		to = t.To.String()
+	}
+	return fmt.Sprintf("day %d year %d: %s from %s to %s (%s)", t.Day, t.Year, t.What, from, to, t.Reason)
+}
+
+// recordTransfer records a transfer of property.
+func (m *Map) recordTransfer(from, to *Person, what, reason string) {
+	t := &Transfer{
+		Day:    m.Day,
+		Year:   m.Year,
+		From:   from,
+		To:     to,
+		What:   what,
+		Reason: reason,
+	}
+	m.Transfers = append(m.Transfers, t)
+	log.Printf("Transfer: %v", t)
+}
+
+// Debt is an amount of coin a person owes.
+type Debt struct {
+	Creditor *Person // nil if the debt is owed to the village
+	Amount   int
+}
+
+// lend lends the given amount of coin from the village to the person.
+func (m *Map) lend(p *Person, amount int) {
+	m.Resources[ResourceCoin] -= amount
+	p.Resources[ResourceCoin] += amount
+	p.Debts = append(p.Debts, &Debt{Amount: amount})
+	m.recordTransfer(nil, p, fmt.Sprintf("coin %d", amount), "loan")
+}
+
+// repay pays back as much of the debts of the person as possible (up to
+// the given amount) and returns the amount paid.
+func (m *Map) repay(p *Person, amount int) int {
+	var paid int
+	var debts []*Debt
+	for _, d := range p.Debts {
+		n := min(d.Amount, amount-paid, p.Resources[ResourceCoin])
+		if n > 0 {
+			p.Resources[ResourceCoin] -= n
+			if d.Creditor != nil {
+				d.Creditor.Resources[ResourceCoin] += n
+			} else {
+				m.Resources[ResourceCoin] += n
+			}
+			d.Amount -= n
+			paid += n
+		}
+		if d.Amount > 0 {
+			debts = append(debts, d)
+		}
+	}
+	p.Debts = debts
+	return paid
+}
+
+// totalDebt returns the amount of coin the person owes.
+func (p *Person) totalDebt() int {
+	var total int
+	for _, d := range p.Debts {
+		total += d.Amount
+	}
+	return total
+}
+
+// collectDebts lets everyone pay back their debts in installments.
+func (m *Map) collectDebts() {
+	for _, p := range m.RealPop {
+		if !p.Dead && len(p.Debts) > 0 {
+			m.repay(p, debtInstallment)
+		}
+	}
+}
+
+// transferBuilding transfers the share of the building owned by one person
+// to another (or to the village, if the new owner is nil).
+func (m *Map) transferBuilding(b *Building, from, to *Person, reason string) {
+	b.RemoveOwner(from)
+	if to != nil {
+		b.AddOwner(to)
+	}
+	m.recordTransfer(from, to, b.String(), reason)
+}
+
+// writeWill names our heirs. We leave our estate to our spouse and children,
+// and to our best friends.
+func (p *Person) writeWill() {
+	p.Will = nil
+	if p.Spouse != nil && !p.Spouse.Dead {
+		p.Will = append(p.Will, p.Spouse)
+	}
+	for _, c := range p.Children {
+		if !c.Dead {
+			p.Will = append(p.Will, c)
+		}
+	}
+	var friends []*Person
+	for f := range p.Opinions {
+		if !f.Dead && p.Opinions.Value(f) >= willFriendOpinion && f != p.Spouse && !p.isCloseRelative(f) {
+			friends = append(friends, f)
+		}
+	}
+	sort.Slice(friends, func(i, j int) bool {
+		return p.Opinions.Value(friends[i]) > p.Opinions.Value(friends[j])
+	})
+	p.Will = append(p.Will, friends...)
+	log.Printf("%v wrote a will naming %d heirs", p, len(p.Will))
+}
+
+// heirShare is an heir and their share of the estate.
+type heirShare struct {
+	*Person
+	Share float64
+}
+
+// heirs returns the heirs of the person and their share of the estate
+// according to the given succession law. The first heir is the main heir.
+func (p *Person) heirs(law SuccessionLaw) []heirShare {
+	switch law {
+	case SuccessionWill:
+		var heirs []heirShare
+		for _, h := range p.Will {
+			if !h.Dead {
+				heirs = append(heirs, heirShare{h, 1})
+			}
+		}
+		if len(heirs) > 0 {
+			return normalizeShares(heirs)
+		}
+	case SuccessionPrimogeniture:
+		if h := p.eldestHeir(); h != nil {
+			return []heirShare{{h, 1}}
+		}
+		if p.Spouse != nil && !p.Spouse.Dead {
+			return []heirShare{{p.Spouse, 1}}
+		}
+		return normalizeShares(p.nextOfKin())
+	case SuccessionPartible:
+		heirs := p.descendants()
+		if p.Spouse != nil && !p.Spouse.Dead {
+			if len(heirs) == 0 {
+				return []heirShare{{p.Spouse, 1}}
+			}
+			heirs = normalizeShares(heirs)
+			for i := range heirs {
+				heirs[i].Share /= 2
+			}
+			return append([]heirShare{{p.Spouse, 0.5}}, heirs...)
+		}
+		if len(heirs) > 0 {
+			return normalizeShares(heirs)
+		}
+		return normalizeShares(p.nextOfKin())
+	}
+
+	// Spouse first, then the descendants, then the next of kin.
+	if p.Spouse != nil && !p.Spouse.Dead {
+		return []heirShare{{p.Spouse, 1}}
+	}
+	if heirs := p.descendants(); len(heirs) > 0 {
+		return normalizeShares(heirs)
+	}
+	return normalizeShares(p.nextOfKin())
+}
+
+// normalizeShares scales the shares so they add up to 1.
+func normalizeShares(heirs []heirShare) []heirShare {
+	var total float64
+	for _, h := range heirs {
+		total += h.Share
+	}
+	for i := range heirs {
+		heirs[i].Share /= total
+	}
+	return heirs
+}
+
+// eldestHeir returns the eldest living child, or if the eldest child is
+// dead, their eldest heir (and so on).
+func (p *Person) eldestHeir() *Person {
+	children := append([]*Person{}, p.Children...)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].BirthYear < children[j].BirthYear
+	})
+	for _, c := range children {
+		if !c.Dead {
+			return c
+		}
+		if h := c.eldestHeir(); h != nil {
+			return h
+		}
+	}
+	return nil
+}
+
+// descendants returns the living descendants and their share of the estate.
+// Children of dead children inherit the share of their parent (per stirpes).
+func (p *Person) descendants() []heirShare {
+	var lines [][]heirShare
+	for _, c := range p.Children {
+		if !c.Dead {
+			lines = append(lines, []heirShare{{c, 1}})
+		} else if d := c.descendants(); len(d) > 0 {
+			lines = append(lines, d)
+		}
+	}
+	var heirs []heirShare
+	for _, line := range lines {
+		for _, h := range normalizeShares(line) {
+			heirs = append(heirs, heirShare{h.Person, h.Share / float64(len(lines))})
+		}
+	}
+	return heirs
+}
+
+// nextOfKin returns the closest living blood relatives (parents, siblings,
+// grandparents, nieces and nephews, cousins, ...), who share the estate equally.
+func (p *Person) nextOfKin() []heirShare {
+	seen := map[*Person]bool{p: true}
+	current := []*Person{p}
+	for len(current) > 0 {
+		var next []*Person
+		var heirs []heirShare
+		for _, c := range current {
+			for _, r := range append([]*Person{c.Mother, c.Father}, c.Children...) {
+				if r == nil || seen[r] {
+					continue
+				}
+				seen[r] = true
+				next = append(next, r)
+				if !r.Dead {
+					heirs = append(heirs, heirShare{r, 1})
+				}
+			}
+		}
+		if len(heirs) > 0 {
+			return heirs
+		}
+		current = next
+	}
+	return nil
+}
+
+// settleEstate pays the debts of the deceased and distributes the estate
+// among the heirs according to the succession law of the village.
+// If there are no heirs, the estate goes to the village.
+func (m *Map) settleEstate(p *Person) {
+	// Debts are paid first, by selling buildings if needed.
+	m.repay(p, p.totalDebt())
+	for _, b := range append([]*Building{}, p.Owns...) {
+		if len(p.Debts) == 0 {
+			break
+		}
+		share := min(b.PurchasePrice()/max(len(b.Owners), 1), m.Resources[ResourceCoin])
+		p.Resources[ResourceCoin] += share
+		m.Resources[ResourceCoin] -= share
+		m.transferBuilding(b, p, nil, "debt")
+		m.repay(p, p.totalDebt())
+	}
+	if debt := p.totalDebt(); debt > 0 {
+		log.Printf("%v died with %d coin of unpaid debt", p, debt)
+		p.Debts = nil
+	}
+
+	heirs := p.heirs(m.Succession)
+	reason := "inheritance (" + m.Succession.String() + ")"
+	if len(heirs) == 0 {
+		// The village inherits everything.
+		if !p.Resources.IsEmpty() {
+			m.Resources.Add(p.Resources)
+			m.recordTransfer(p, nil, p.Resources.String(), "escheat")
+		}
+		p.Resources = Stockpile{}
+		for _, b := range append([]*Building{}, p.Owns...) {
+			if b.Remaining == 0 {
+				m.transferBuilding(b, p, nil, "escheat")
+			}
+		}
+
+		// The village takes over our construction sites and sells the
+		// finished buildings.
+		for _, b := range p.Constructing {
+			m.transferBuilding(b, p, nil, "escheat")
+		}
+		p.Constructing = nil
+		return
+	}
+
+	// Resources are split according to the shares, the remainder goes to
+	// the main heir.
+	heir := heirs[0].Person
+	for _, h := range heirs {
+		var inherited Stockpile
+		for r, n := range p.Resources {
+			inherited[r] = int(float64(n) * h.Share)
+		}
+		if h.Person == heir {
+			continue
+		}
+		h.Resources.Add(inherited)
+		p.Resources.Remove(inherited)
+		if !inherited.IsEmpty() {
+			m.recordTransfer(p, h.Person, inherited.String(), reason)
+		}
+	}
+	if !p.Resources.IsEmpty() {
+		heir.Resources.Add(p.Resources)
+		m.recordTransfer(p, heir, p.Resources.String(), reason)
+	}
+	p.Resources = Stockpile{}
+	heir.Trophies = append(heir.Trophies, p.Trophies...)
+
+	// Buildings are co-owned by all heirs.
+	// NOTE: Co-owners have equal shares in a building.
+	for _, b := range append([]*Building{}, p.Owns...) {
+		if b.Remaining > 0 {
+			continue // Construction sites go to the main heir (see below).
+		}
+		b.RemoveOccupant(p)
+		b.RemoveOwner(p)
+		for _, h := range heirs {
+			b.AddOwner(h.Person)
+			m.recordTransfer(p, h.Person, b.String(), reason)
+		}
+	}
+
+	// The main heir takes over our construction sites.
+	for _, b := range p.Constructing {
+		m.transferBuilding(b, p, heir, reason)
+		if !heir.isConstructing(b) {
+			heir.Constructing = append(heir.Constructing, b)
+		}
+	}
+	p.Constructing = nil
+
+	// Move a homeless heir to the home of the deceased.
+	if p.Home != nil && heir.Home == nil {
+		heir.SetHome(p.Home)
+	}
+}
@@ -0,0 +1,120 @@
+package simsettlers
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+
+	"github.com/Flokey82/go_gens/genlanguage"
+)
+
+// Injury is a wound a person suffered (e.g. while fighting a monster).
+// Severe injuries leave a scar once they are healed.
+type Injury struct {
+	Name      string  // e.g. "broken left arm"
+	Cause     string  // what inflicted the injury
+	Severity  float64 // 0-1, how bad the injury is
+	Remaining uint16  // days until the injury is healed
+	Scar      bool    // true if the injury leaves a scar
+	Year      int     // year the injury was suffered
+}
+
+// IsHealed returns true if the injury has healed.
+func (i *Injury) IsHealed() bool {
+	return i.Remaining == 0
+}
+
+// String returns a string representation of the injury.
+func (i *Injury) String() string {
+	if i.IsHealed() {
+		if i.Scar {
+			return fmt.Sprintf("scar from a %s (%s, %d)", i.Name, i.Cause, i.Year)
+		}
+		return fmt.Sprintf("healed %s (%s, %d)", i.Name, i.Cause, i.Year)
+	}
+	return fmt.Sprintf("%s (%s, %d days left)", i.Name, i.Cause, i.Remaining)
+}
+
+const (
+	injuryDamage       = 60.0 // Health lost by an injury of severity 1
+	injuryHealDays     = 60   // Days to heal an injury of severity 1
+	injuryScarSeverity = 0.5  // Severity above which injuries leave a scar
+)
+
+var (
+	injuryBodyParts = []string{"left arm", "right arm", "left leg", "right leg", "head", "chest", "left hand", "right hand", "face"}
+	injuryKinds     = []string{"bruised", "cut", "gashed", "broken", "mangled"} // By increasing severity.
+)
+
+// injure inflicts an injury of the given severity (0-1) on the person and
+// returns true if the person died of it.
+func (m *Map) injure(p *Person, cause string, severity float64) bool {
+	severity = min(max(severity, 0), 1)
+	kind := injuryKinds[min(int(severity*float64(len(injuryKinds))), len(injuryKinds)-1)]
+	in := &Injury{
+		Name:      kind + " " + injuryBodyParts[rand.Intn(len(injuryBodyParts))],
+		Cause:     cause,
+		Severity:  severity,
+		Remaining: uint16(1 + severity*injuryHealDays),
+		Scar:      severity >= injuryScarSeverity,
+		Year:      m.Year,
+	}
+	p.Injuries = append(p.Injuries, in)
+	p.Health -= severity * injuryDamage
+	log.Printf("%v suffered a %s (%s)", p, in.Name, cause)
+	if p.Health <= 0 {
+		log.Printf("%v died of their wounds", p)
+		m.handleDeath(p, "died of the wounds inflicted by "+genlanguage.GetArticle(cause)+" "+cause)
+		return true
+	}
+	return false
+}
+
+// isInjured returns true if the person has injuries that are not healed yet.
+func (p *Person) isInjured() bool {
+	for _, in := range p.Injuries {
+		if !in.IsHealed() {
+			return true
+		}
+	}
+	return false
+}
+
+// injurySeverity returns the combined severity of all unhealed injuries.
+func (p *Person) injurySeverity() float64 {
+	var severity float64
+	for _, in := range p.Injuries {
+		if !in.IsHealed() {
+			severity += in.Severity
+		}
+	}
+	return severity
+}
+
+// Scars returns all injuries that left a scar.
+func (p *Person) Scars() []*Injury {
+	var scars []*Injury
+	for _, in := range p.Injuries {
+		if in.IsHealed() && in.Scar {
+			scars = append(scars, in)
+		}
+	}
+	return scars
+}
+
+// tickInjuries lets the injuries of the population heal.
+func (m *Map) tickInjuries() {
+	for _, p := range m.RealPop {
+		if p.Dead {
+			continue
+		}
+		for _, in := range p.Injuries {
+			if in.IsHealed() {
+				continue
+			}
+			if in.Remaining--; in.Remaining == 0 && in.Scar {
+				log.Printf("%v's %s healed, leaving a scar", p, in.Name)
+			}
+		}
+	}
+}
@@ -1,8 +1,322 @@
 package simsettlers
 
+import (
+	"log"
+	"math/rand"
+)
+
 type JobType byte
 
 const (
 	JobTypeUnemployed JobType = iota
 	JobTypeFarmer
+	JobTypeSmith
+	JobTypeMiller
+	JobTypeWoodcutter
+	JobTypeMiner
+	JobTypePriest
+	JobTypeGuard
+	JobTypeCraftsman
+	JobTypeInnkeeper
+	JobTypeMax
 )
+
+// String returns the name of the job.
+func (j JobType) String() string {
+	switch j {
+	case JobTypeUnemployed:
+		return "unemployed"
+	case JobTypeFarmer:
+		return "farmer"
+	case JobTypeSmith:
+		return "smith"
+	case JobTypeMiller:
+		return "miller"
+	case JobTypeWoodcutter:
+		return "woodcutter"
+	case JobTypeMiner:
+		return "miner"
+	case JobTypePriest:
+		return "priest"
+	case JobTypeGuard:
+		return "guard"
+	case JobTypeCraftsman:
+		return "craftsman"
+	case JobTypeInnkeeper:
+		return "innkeeper"
+	default:
+		return "unknown"
+	}
+}
+
+// Workplace returns the building type that the job is tied to.
+// Farmers without a farm work a plot next to their home.
+func (j JobType) Workplace() string {
+	return jobWorkplace[j]
+}
+
+var jobWorkplace = map[JobType]string{
+	JobTypeFarmer:     BuildingTypeFarm,
+	JobTypeSmith:      BuildingTypeSmithy,
+	JobTypeMiller:     BuildingTypeMill,
+	JobTypeWoodcutter: BuildingTypeLumberCamp,
+	JobTypeMiner:      BuildingTypeMine,
+	JobTypePriest:     BuildingTypeTemple,
+	JobTypeGuard:      BuildingTypeGuardhouse,
+	JobTypeCraftsman:  BuildingTypeWorkshop,
+	JobTypeInnkeeper:  BuildingTypeTavern,
+}
+
+// jobPopulation is the number of villagers needed to sustain one worker of
+// the given trade. A small village doesn't need a whole order of priests.
+var jobPopulation = map[JobType]int{
+	JobTypeFarmer:     3,
+	JobTypeSmith:      15,
+	JobTypeMiller:     15,
+	JobTypeWoodcutter: 8,
+	JobTypeMiner:      8,
+	JobTypePriest:     20,
+	JobTypeGuard:      10,
+	JobTypeCraftsman:  12,
+	JobTypeInnkeeper:  25,
+}
+
+const (
+	skillMax       = 1.0   // Maximum skill level (master)
+	skillGain      = 0.001 // Skill gained per shift
+	skillTradeGain = 0.2   // Initial skill if a parent practices the trade
+	wageShare      = 0.5   // Share of the value of the workplace yield that is paid as wages
+)
+
+// skillFactor returns the productivity multiplier for the given skill level.
+// An apprentice (skill 0) works at half the speed of a master (skill 1).
+func skillFactor(skill float64) float64 {
+	return 0.5 + 0.5*skill
+}
+
+// familyTrade returns true if either parent practices the given trade.
+func (p *Person) familyTrade(j JobType) bool {
+	return p.Mother != nil && p.Mother.Job == j || p.Father != nil && p.Father.Job == j
+}
+
+// jobAffinity returns how much the person would like to work in the given job.
+// This is based on the skill, the family trade and the personality of the person.
+func (p *Person) jobAffinity(j JobType) float64 {
+	aff := 1 + 2*p.Skills[j]
+	if p.familyTrade(j) {
+		aff += 1 // We grew up with it.
+	}
+
+	// TODO: Once we have a proper personality, use it here.
+	switch j {
+	case JobTypeGuard:
+		// Bullies and adventurers like to throw their weight around.
+		if p.Goals.IsSet(GoalChildhoodBully) {
+			aff += 1
+		}
+		if p.Goals.IsSet(GoalAdultAdventurer) {
+			aff += 0.5
+		}
+	case JobTypeMiner:
+		if p.Goals.IsSet(GoalAdultAdventurer) {
+			aff += 0.5
+		}
+	case JobTypePriest:
+		// Social people enjoy caring for the community.
+		if p.Goals.IsSet(GoalChildhoodSocialize) {
+			aff += 0.5
+		}
+	case JobTypeInnkeeper:
+		// ... or for their guests.
+		if p.Goals.IsSet(GoalChildhoodSocialize) {
+			aff += 0.5
+		}
+	case JobTypeWoodcutter:
+		// Loners enjoy working in the woods.
+		if !p.Goals.IsSet(GoalChildhoodSocialize) {
+			aff += 0.5
+		}
+	}
+	return aff
+}
+
+// preferredJob returns the job the person would like to have the most
+// (regardless of whether there is a vacancy or not).
+func (p *Person) preferredJob() JobType {
+	best := JobTypeFarmer
+	bestAff := p.jobAffinity(best)
+	for j := JobTypeFarmer + 1; j < JobTypeMax; j++ {
+		if aff := p.jobAffinity(j); aff > bestAff {
+			best, bestAff = j, aff
+		}
+	}
+	return best
+}
+
+// findJob picks the job with the highest affinity that has a vacancy in the
+// settlement of the person. Farming is always possible as a fallback.
+func (m *Map) findJob(p *Person) {
+	best := JobTypeFarmer
+	bestAff := p.jobAffinity(best) + rand.Float64()
+	var bestWorkplace *Building
+	s := m.settlementOf(p)
+	for _, b := range m.Buildings {
+		j := b.Job()
+		if j == JobTypeUnemployed || !b.HasVacancy() || b.Settlement != s {
+			continue
+		}
+		// Add some randomness so not everyone ends up in the same job.
+		if aff := p.jobAffinity(j) + rand.Float64(); aff > bestAff {
+			best, bestAff, bestWorkplace = j, aff, b
+		}
+	}
+	if best == p.Job && bestWorkplace == nil {
+		return
+	}
+	p.quitJob()
+	p.Job = best
+	if bestWorkplace != nil {
+		bestWorkplace.AddWorker(p)
+	}
+	log.Printf("%v is now working as %s", p, best)
+}
+
+// quitJob removes the person from their workplace and makes them unemployed.
+func (p *Person) quitJob() {
+	if p.Workplace != nil {
+		p.Workplace.RemoveWorker(p)
+	}
+	p.Job = JobTypeUnemployed
+}
+
+// train improves the skill of the person in their current job.
+func (p *Person) train() {
+	p.Skills[p.Job] = min(p.Skills[p.Job]+skillGain, skillMax)
+}
+
+// inheritTrade gives a child a head start in the trades of their parents.
+func (p *Person) inheritTrade() {
+	for _, parent := range []*Person{p.Mother, p.Father} {
+		if parent != nil && parent.Job != JobTypeUnemployed {
+			p.Skills[parent.Job] = max(p.Skills[parent.Job], skillTradeGain)
+		}
+	}
+}
+
+// payWages pays the workers of the building their share of the value of the
+// given yield in coin from the village storage, weighted by their skill.
+func (m *Map) payWages(b *Building, yield Stockpile) {
+	wages := min(int(float64(yield.Value())*wageShare), m.Resources[ResourceCoin])
+	if wages <= 0 || len(b.Workers) == 0 {
+		return
+	}
+	var total float64
+	for _, w := range b.Workers {
+		total += skillFactor(w.Skills[w.Job])
+	}
+	for _, w := range b.Workers {
+		wage := int(float64(wages) * skillFactor(w.Skills[w.Job]) / total)
+		w.Resources[ResourceCoin] += wage
+		m.Resources[ResourceCoin] -= wage
+	}
+}
+
+const (
+	farmYield   = 4  // Food harvested by a master farmer per day
+	foodReserve = 30 // Food a household keeps before selling the surplus
+)
+
+// tickFarmers lets all farmers without a farm harvest their plots to feed
+// their household. Any surplus is sold to the village.
+func (m *Map) tickFarmers() {
+	for _, p := range m.RealPop {
+		if p.Dead || p.Job != JobTypeFarmer || p.Workplace != nil {
+			continue
+		}
+		stock := p.household()
+		stock[ResourceFood] += randRound(farmYield * skillFactor(p.Skills[JobTypeFarmer]) * p.workCapacity() * m.cropYieldFactor())
+		if surplus := stock[ResourceFood] - foodReserve; surplus > 0 {
+			price := min(surplus*resourceValue[ResourceFood], m.Resources[ResourceCoin])
+			stock.Take(ResourceFood, price/resourceValue[ResourceFood])
+			m.Resources[ResourceFood] += price / resourceValue[ResourceFood]
+			m.Resources[ResourceCoin] -= price
+			p.Resources[ResourceCoin] += price
+		}
+	}
+}
+
+// constructWorkplaces builds a new workplace in each settlement if people
+// are looking for a job that has no vacancies left, the settlement can
+// sustain another worker of the trade and the village can afford the building.
+func (m *Map) constructWorkplaces() {
+	for _, s := range m.Settlements {
+		m.constructWorkplace(s)
+	}
+}
+
+// constructWorkplace builds a new workplace in the settlement if needed
+// (see constructWorkplaces).
+func (m *Map) constructWorkplace(s *Settlement) {
+	// Only build one workplace at a time.
+	for _, b := range m.Construction {
+		if b.Job() != JobTypeUnemployed && b.Settlement == s {
+			return
+		}
+	}
+
+	// Count how many people would like to work in each job and how many
+	// are looking for work (farmers are always happy to get a proper job).
+	var demand [JobTypeMax]int
+	var seekers int
+	people := m.inhabitants(s)
+	for _, p := range people {
+		if p.Dead || p.Age < 18 || p.Age >= 65 || !p.Goals.IsSet(GoalAdultJob) {
+			continue
+		}
+		if p.Job == JobTypeUnemployed || p.Job == JobTypeFarmer {
+			seekers++
+		}
+		if j := p.preferredJob(); j != p.Job {
+			demand[j]++
+		}
+	}
+
+	// Subtract the vacancies we already have.
+	var slots [JobTypeMax]int
+	var vacancies int
+	for _, b := range m.Buildings {
+		if j := b.Job(); j != JobTypeUnemployed && b.Settlement == s {
+			demand[j] -= b.WorkerCapacity() - len(b.Workers)
+			slots[j] += b.WorkerCapacity()
+			vacancies += b.WorkerCapacity() - len(b.Workers)
+		}
+	}
+
+	// Pick the job with the highest unmet demand that the settlement can
+	// sustain and the village can afford.
+	// If nobody has a preference, we pick the trade the village lacks the most.
+	best := JobTypeUnemployed
+	var bestShortfall int
+	for j := JobTypeFarmer; j < JobTypeMax; j++ {
+		shortfall := (len(people)+jobPopulation[j]-1)/jobPopulation[j] - slots[j]
+		if shortfall <= 0 || demand[j] <= 0 && seekers <= vacancies || !m.Resources.Has(buildingCosts[j.Workplace()]) {
+			continue
+		}
+		if best == JobTypeUnemployed || demand[j] > demand[best] || demand[j] == demand[best] && shortfall > bestShortfall {
+			best, bestShortfall = j, shortfall
+		}
+	}
+	if best == JobTypeUnemployed {
+		return
+	}
+
+	t := best.Workplace()
+	i, score := m.getHighestBuildingFitness(s, t)
+	if score == -1 {
+		log.Printf("No suitable location for a %s found in %s", t, s.Name)
+		return
+	}
+	log.Printf("Building a %s in %s for %d prospective %ss", t, s.Name, max(demand[best], 0), best)
+	m.AddBuilding(i%m.Width, i/m.Width, t).Settlement = s
+	m.Resources.Remove(buildingCosts[t])
+}
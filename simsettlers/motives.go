@@ -34,8 +34,12 @@ func (m *Map) pickMotive(p *Person, elapsed float64) {
 
 	// No unsatisfied motives, we are done.
 	if len(remMotives) == 0 {
-		// If the current motive is satisfied, we can remove it.
+		// If the current motive is satisfied, we can remove it (and its plan).
+		if p.CurrentMotive != nil {
+			p.CurrentMotive.Tree = nil
+		}
 		p.CurrentMotive = nil
+		p.CurrentTree = nil
 
 		// Set position to home (if any).
 		// This is a hack for now. We can be anywhere, since we can have multi-day
@@ -45,8 +49,8 @@ func (m *Map) pickMotive(p *Person, elapsed float64) {
 			p.Y = float64(p.Home.Y)
 		} else {
 			// Set position to the root building.
-			p.X = float64(m.Root.X)
-			p.Y = float64(m.Root.Y)
+			p.X = float64(m.rootOf(p).X)
+			p.Y = float64(m.rootOf(p).Y)
 		}
 		return
 	}
@@ -65,13 +69,11 @@ func (m *Map) pickMotive(p *Person, elapsed float64) {
 	// we continue with the same plan.
 	var chosen *Motive
 	if p.CurrentMotive == remMotives[0] {
-		// TODO: Continue with the same plan.
 		chosen = p.CurrentMotive
 		log.Printf("Continue with the same plan: %v (%v)", chosen, p)
 		if p.CurrentTree == nil {
-			log.Printf("ERROR: Current tree is nil: %v", p)
+			// The previous plan is done, so we need a new one.
 			p.CurrentTree = chosen.Type.GetTree(p, m)
-			log.Printf("ERROR: Current tree is STILL nil: %v", p)
 		}
 	} else {
 		// Pick a new motive from the top 3 motives.
@@ -82,29 +84,48 @@ func (m *Map) pickMotive(p *Person, elapsed float64) {
 		} else {
 			chosen = remMotives[0]
 		}
+		// Suspend the plan of the previous motive, so we can resume it later.
+		if p.CurrentMotive != nil {
+			p.CurrentMotive.Tree = p.CurrentTree
+		}
 		p.CurrentMotive = chosen
-		log.Printf("Pick a new motive: %v (%v)", chosen, p)
-		p.CurrentTree = chosen.Type.GetTree(p, m)
-
-		// Set position to home (if any).
-		// This is a hack for now. We can be anywhere, since we can have multi-day
-		// tasks etc.
-		if p.Home != nil {
-			p.X = float64(p.Home.X)
-			p.Y = float64(p.Home.Y)
+		if chosen.Tree != nil {
+			// Resume where we left off.
+			log.Printf("Resume motive: %v (%v)", chosen, p)
+			p.CurrentTree = chosen.Tree
+			chosen.Tree = nil
 		} else {
-			// Set position to the root building.
-			p.X = float64(m.Root.X)
-			p.Y = float64(m.Root.Y)
+			log.Printf("Pick a new motive: %v (%v)", chosen, p)
+
+			// Set position to home (if any).
+			// This is a hack for now. We can be anywhere, since we can have multi-day
+			// tasks etc.
+			if p.Home != nil {
+				p.X = float64(p.Home.X)
+				p.Y = float64(p.Home.Y)
+			} else {
+				// Set position to the root building.
+				p.X = float64(m.rootOf(p).X)
+				p.Y = float64(m.rootOf(p).Y)
+			}
+			p.CurrentTree = chosen.Type.GetTree(p, m)
 		}
 	}
 
 	// Satisfy this motive through the current tree.
 	if p.CurrentTree != nil {
-		// If the tree is done, we are done... satisfy the motive.
-		if p.CurrentTree.Step(elapsed) {
+		// Every day we work on the plan satisfies the motive a little.
+		ok := true
+		for i := 0; i < stepsPerDay && !p.CurrentTree.IsDone(); i++ {
+			ok = p.CurrentTree.Step(1.0)
+		}
+		if ok {
 			chosen.Change(200)
 		}
+		// Once the plan is done (or failed), we need a new one.
+		if p.CurrentTree.IsDone() {
+			p.CurrentTree = nil
+		}
 	} else {
 		// HACK: If we have nothing to do, we just satisfy the motive.
 		chosen.Type.Satisfy(p, m)
@@ -123,6 +144,7 @@ const (
 	// BaseMotiveThirst
 	BaseMotiveHunger
 	BaseMotiveSleep // Maybe replace with "Energy"?
+	BaseMotiveSocial
 	// BaseMotiveFun
 	// BaseMotiveHygiene
 	// BaseMotiveBladder
@@ -170,11 +192,10 @@ const (
 )
 
 // Motive is a motive instance for a person.
-// TODO: We should store the current tree (plan) for the motive,
-// so we can continue where we left off if a motive is interrupted.
 type Motive struct {
 	Type *MotiveType
 	Val  float64 // Current value of the motive
+	Tree *Tree   // Suspended plan, so we can continue where we left off if the motive was interrupted
 }
 
 // String returns a string representation of the motive.
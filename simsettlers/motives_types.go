@@ -17,27 +17,16 @@ var MotiveTypeAdventure = &MotiveType{
 		log.Println("Person is very bored!")
 	},
 	IsSatisfied: func(p *Person, m *Map) bool {
-		return false
+		// We can't go on an adventure if we are hurt or there is nothing left to fight.
+		return !p.canAdventure() || m.nearestActiveDungeon(p) == nil
 	},
 	Satisfy: func(p *Person, m *Map) bool {
 		handleAdventure(p, m)
 		return true
 	},
-	GetTree: func(p *Person, m *Map) *Tree { // Pick a random dungeon (TODO: Handle case if there are no dungeons
-		dcTree := newDungeonCrawl(p, m.Dungeons[rand.Intn(len(m.Dungeons))], func() {
-			// We survived the adventure.
-			loot := rand.Intn(1000)
-			p.Resources += loot
-			log.Printf("%s went on an adventure and found %d resources", p.String(), loot)
-		}, func() {
-			// TODO: What if we just go missing? Could someone save us?
-			// We died on our adventure.
-			// We might be declared missing, someone might find our body,
-			// or we might never be found.
-			// TODO: Inheritence, ownership, legally dead, etc.
-			m.handleDeath(p)
-		})
-		return &dcTree
+	GetTree: func(p *Person, m *Map) *Tree {
+		// NOTE: The party is advanced by the map (see tickParties).
+		return nil
 	},
 }
 
@@ -104,13 +93,14 @@ var MotiveTypeBully = &MotiveType{
 			}
 			bt := newBullyTree(p, victim, func() {
 				// We bullied the victim.
+				m.recordEvent(EventBullying, "", p, victim)
 			}, func() {
 				// Bullying failed.
 				if rand.Intn(100) < 10 {
-					// TODO: This is a crime committed by the victim,
-					// we need to find a way to handle this.
+					// The family of the bully won't forget this.
+					m.aggrieve(p, victim, murderGrudge)
 					log.Printf("%v killed %v", victim, p)
-					m.handleDeath(p)
+					m.handleDeath(p, "was killed by "+victim.Name()+", whom they bullied")
 				} else {
 					// The bully will be forced to respect the victim a little more.
 					log.Printf("%v injured %v", victim, p)
@@ -133,7 +123,8 @@ var MotiveTypeBuildHouse = &MotiveType{
 		log.Println("Person is very bored!")
 	},
 	IsSatisfied: func(p *Person, m *Map) bool {
-		return p.OwnsOwnHome()
+		// Owners still need to repair their home if it is damaged (e.g. by a storm).
+		return p.OwnsOwnHome() && p.Home.Condition >= homeRepairCondition
 	},
 	Satisfy: func(p *Person, m *Map) bool {
 		handleHome(p, m)
@@ -238,3 +229,46 @@ var MotiveTypeJob = &MotiveType{
 		return nil
 	},
 }
+
+var MotiveTypeGather = &MotiveType{
+	Name:  "Gather",
+	Goal:  GoalAdultHome,
+	Curve: CurveTypeLinear,
+	Decay: 2.0,
+	OnMax: func() {},
+	OnMin: func() {
+		log.Println("Person is very bored!")
+	},
+	IsSatisfied: func(p *Person, m *Map) bool {
+		missing := p.missingMaterials()
+		return missing.IsEmpty()
+	},
+	Satisfy: func(p *Person, m *Map) bool {
+		// NOTE: We only get here if there is no deposit to gather from.
+		return true
+	},
+	GetTree: func(p *Person, m *Map) *Tree {
+		return newGatherPlan(p, m)
+	},
+}
+
+var MotiveTypeCourtship = &MotiveType{
+	Name:  "Courtship",
+	Goal:  GoalAdultPartner,
+	Curve: CurveTypeLinear,
+	Decay: 5.0,
+	OnMax: func() {},
+	OnMin: func() {
+		log.Println("Person is very lonely!")
+	},
+	IsSatisfied: func(p *Person, m *Map) bool {
+		return !p.isSingle() || p.Age < courtshipMinAge
+	},
+	Satisfy: func(p *Person, m *Map) bool {
+		// NOTE: We only get here if there is no one to court.
+		return true
+	},
+	GetTree: func(p *Person, m *Map) *Tree {
+		return newCourtshipPlan(p, m)
+	},
+}
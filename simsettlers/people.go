@@ -3,9 +3,7 @@ package simsettlers
 import (
 	"fmt"
 	"log"
-	"math"
 	"math/rand"
-	"sort"
 
 	"github.com/Flokey82/go_gens/gameconstants"
 )
@@ -13,7 +11,11 @@ import (
 func (m *Map) addNRandomPeople(n int) {
 	for i := 0; i < n; i++ {
 		p := m.newPerson("", m.lastGen.String(), byte(rand.Intn(2)), uint16(rand.Intn(20)+18))
-		p.Resources = rand.Intn(10)
+		p.Resources = Stockpile{
+			ResourceFood: rand.Intn(20),
+			ResourceWood: rand.Intn(5),
+			ResourceCoin: rand.Intn(30),
+		}
 
 		// TODO: Fix assignment of goals.
 		p.assignChildhoodGoals()
@@ -34,56 +36,87 @@ func (m *Map) newPerson(firstName, lastName string, gender byte, age uint16) *Pe
 		}
 	}
 	return &Person{
-		Health:    healthMax,
-		FirstName: firstName,
-		LastName:  lastName,
-		Birthday:  m.Day,
-		Age:       age,
-		Gender:    gender,
-		Opinions:  make(Opinions),
+		Health:      healthMax,
+		FirstName:   firstName,
+		LastName:    lastName,
+		Birthday:    m.Day,
+		BirthYear:   m.Year - int(age),
+		Age:         age,
+		Gender:      gender,
+		Opinions:    make(Opinions),
+		Grudges:     make(Opinions),
+		Personality: randomPersonality(),
+		Blackboard:  make(Blackboard),
 	}
 }
 
 const healthMax = 100.0
 
 // Person represents a person in the village.
-// TODO:
-// - Add a personality.
 type Person struct {
 	FirstName      string
 	LastName       string
-	Age            uint16  // age of the person in years (pretty generous with the uint16)
-	Gender         byte    //
-	Birthday       uint16  // day of the year the person was born
-	Pregnant       uint16  // days the person will still be pregnant
-	Health         float64 // current health of the person
-	Dead           bool    // true if the person is dead
-	LocationPerson         // location and speed of the person
+	Age            uint16            // age of the person in years (pretty generous with the uint16)
+	Gender         byte              //
+	Birthday       uint16            // day of the year the person was born
+	BirthYear      int               // year the person was born
+	DeathDay       uint16            // day of the year the person died
+	DeathYear      int               // year the person died
+	CauseOfDeath   string            // how the person died (e.g. "starved to death")
+	Pregnant       uint16            // days the person will still be pregnant
+	Health         float64           // current health of the person
+	Injuries       []*Injury         // injuries (and scars) we suffered
+	Illness        *Illness          // illness we currently suffer from (if any)
+	Immunities     map[*Disease]bool // diseases we can't catch (again)
+	Dead           bool              // true if the person is dead
+	Immigrant      bool              // true if the person moved here from outside of the region
+	ArrivalDay     uint16            // day of the year the person moved to their settlement (if they moved)
+	ArrivalYear    int               // year the person moved to their settlement (if they moved)
+	Emigrated      bool              // true if the person left the region
+	DepartureYear  int               // year the person left the region (emigrants only)
+	LocationPerson                   // location and speed of the person
+	Personality    Personality
 
 	// Actions, jobs, tasks
-	// TODO: Move currentTree into the motive, so a plan can be resumed if we switch motives
-	// temporarily.
-	Motives       []*Motive // List of motives that the person has.
-	CurrentMotive *Motive   // The current motive that we are trying to satisfy.
-	CurrentTree   *Tree     // The current task tree that we are executing.
-	Goals         Goal      // personal goals
-	Job           JobType   // current job
+	Motives       []*Motive           // List of motives that the person has.
+	CurrentMotive *Motive             // The current motive that we are trying to satisfy.
+	CurrentTree   *Tree               // The current task tree that we are executing.
+	Blackboard    Blackboard          // Memory shared by the tasks of our behavior trees.
+	AI            *AI                 // Utility AI (only used if Map.UtilityAI is set).
+	Party         *Party              // party we are adventuring with (if any)
+	Missing       *Dungeon            // dungeon we are held captive in (if any)
+	Goals         Goal                // personal goals
+	Job           JobType             // current job
+	Workplace     *Building           // building we work in (if any)
+	Skills        [JobTypeMax]float64 // skill level per job (0-1)
 
 	// Real estate and wealth
+	Settlement   *Settlement // settlement we live in
 	Home         *Building   // home of the person
 	Constructing []*Building // buildings under construction
 	Owns         []*Building // buildings owned
-	Resources    int         // wealth in resources
+	Resources    Stockpile   // personal belongings
+	Eaten        int         // food eaten today outside of the daily meal (utility AI only)
+	Trophies     []string    // treasures and trophies from our adventures
+	Debts        []*Debt     // coin we owe
+	Will         []*Person   // heirs named in our will
 
 	// Family
 	Mother       *Person
 	Father       *Person
 	Spouse       *Person
 	FormerSpouse []*Person
+	Fiance       *Person // person we are engaged to
+	Engaged      uint16  // days until the wedding
 	Children     []*Person
 
 	// Opinions
 	Opinions Opinions // opinions of other people
+	Grudges  Opinions // grudges against other people
+
+	// Crime and justice
+	Convictions int    // number of times we were convicted of a crime
+	Imprisoned  uint16 // days we still have to spend in prison
 }
 
 // OwnsOwnHome returns true if the person owns their own home.
@@ -109,31 +142,6 @@ func (p *Person) LivesWithParents() bool {
 	return p.Mother != nil && p.Mother.Home == p.Home || p.Father != nil && p.Father.Home == p.Home
 }
 
-func (p *Person) heir() *Person {
-	// If we have a living spouse, they inherit.
-	if p.Spouse != nil && !p.Spouse.Dead {
-		return p.Spouse
-	}
-
-	// If we have a living child, the first one inherits.
-	for _, c := range p.Children {
-		if !c.Dead {
-			return c
-		}
-	}
-
-	// If we have a living parent, they inherit.
-	if p.Father != nil {
-		return p.Father
-	}
-	if p.Mother != nil {
-		return p.Mother
-	}
-
-	// TODO: Grandchildren, siblings, etc?
-	return nil
-}
-
 func (p *Person) SetHome(b *Building) {
 	// Remove person from the occupants list of the previous home.
 	if p.Home != nil {
@@ -141,11 +149,19 @@ func (p *Person) SetHome(b *Building) {
 	}
 	p.Home = b
 	b.AddOccupant(p)
+	if b.Settlement != nil {
+		p.Settlement = b.Settlement
+	}
+}
+
+// Name returns the full name of the person.
+func (p *Person) Name() string {
+	return p.FirstName + " " + p.LastName
 }
 
 // String returns the string representation of the person.
 func (p *Person) String() string {
-	str := fmt.Sprintf("%s %s (%d %s - %d)", p.FirstName, p.LastName, p.Age, p.genderString(), p.Resources)
+	str := fmt.Sprintf("%s %s (%d %s - %d)", p.FirstName, p.LastName, p.Age, p.genderString(), p.Resources.Value())
 	if p.Dead {
 		str += " (dead)"
 	}
@@ -170,51 +186,24 @@ const (
 	GenderMale
 )
 
-func (m *Map) handleDeath(p *Person) {
+// handleDeath handles the death of the person. The cause of death describes
+// what happened (e.g. "starved to death").
+func (m *Map) handleDeath(p *Person, cause string) {
 	m.Population--
 	log.Printf("Died: %v", p)
 	p.Dead = true
-
-	// TODO:
-	// - Identify who will inherit all buildings, resources, etc.
-	// - Find all buildings that we own and transfer ownership to the spouse or children.
-	// - What if we are constructing a building? Transfer ownership to the spouse or children.
-	// - Allow multiple heirs.
-
-	heir := p.heir()
-	if heir != nil {
-		// Move resources to the heir.
-		heir.Resources += p.Resources
-
-		// Move buildings to the heir.
-		for _, b := range p.Owns {
-			// Remove from the occupants list of the building.
-			b.RemoveOccupant(p)
-
-			// Remove from the owners list of the building.
-			b.RemoveOwner(p)
-
-			// Add to the occupants list of the building.
-			b.AddOwner(heir)
-		}
-
-		// Move constructing buildings to the heir.
-		for _, b := range p.Constructing {
-			// Remove the deceased from the constructing list of the building.
-			b.RemoveOwner(p)
-
-			// Add heir to the owners list of the building.
-			b.AddOwner(heir)
-
-			// Add the building to the constructing list of the heir.
-			heir.Constructing = append(heir.Constructing, b)
-		}
-
-		// Move a homeless heir to the home of the deceased.
-		if p.Home != nil && heir.Home == nil {
-			heir.SetHome(p.Home)
-		}
+	p.DeathDay = m.Day
+	p.DeathYear = m.Year
+	p.CauseOfDeath = cause
+	m.recordEvent(EventDeath, cause, p)
+	if p.Party != nil {
+		p.Party.removeMember(p)
 	}
+	p.quitJob()
+	p.breakEngagement()
+
+	// Pay our debts and leave the rest to our heirs.
+	m.settleEstate(p)
 
 	if p.Home != nil {
 		// Remove from the occupants list of the home.
@@ -252,14 +241,17 @@ func (m *Map) agePop() {
 				p.assignChildhoodGoals()
 			} else if p.Age == 18 {
 				p.assignAdultGoals()
+				p.inheritTrade()
+				p.inheritGrudges()
 			} else if p.Age == 65 {
 				p.assignElderlyGoals()
+				p.quitJob() // Retire.
 			}
 		}
 
 		// Check if anyone dies.
 		if gameconstants.DiesAtAgeWithinNDays(int(p.Age), 1) {
-			m.handleDeath(p)
+			m.handleDeath(p, fmt.Sprintf("died at the age of %d", p.Age))
 		} else {
 			remPop = append(remPop, p)
 		}
@@ -268,68 +260,6 @@ func (m *Map) agePop() {
 	m.RealPop = remPop
 }
 
-func (m *Map) matchSingles() {
-	const ageDiffFactor = 0.25
-	const menTakeFemaleName = true
-	var men, women []*Person
-	for _, p := range m.RealPop {
-		if p.Dead || p.isMarried() || p.Age < 18 {
-			continue
-		}
-		// Check if we even want a partner.
-		if !p.Goals.IsSet(GoalAdultPartner) {
-			continue
-		}
-		if p.Gender == GenderMale {
-			men = append(men, p)
-		} else if p.Gender == GenderFemale {
-			women = append(women, p)
-		}
-	}
-
-	// Sort by age.
-	sort.Slice(men, func(i, j int) bool {
-		return men[i].Age < men[j].Age
-	})
-	sort.Slice(women, func(i, j int) bool {
-		return women[i].Age < women[j].Age
-	})
-
-	// Match the singles with a max age difference of 25%.
-	// TODO:
-	// - Personalities matter.
-	// - Matching should not just happen, there should be a probability and some randomness.
-	// - There should be a chance that a person stays single (by choice, or because they just can't find the right person).
-	for _, wp := range women {
-		// Ladies' choice.
-		for _, mp := range men {
-			if mp.isMarried() {
-				continue
-			}
-			// Check if we're on the same page regarding children.
-			// TODO: Check other goals as well.
-			if wp.Goals.IsSet(GoalAdultChildren) != mp.Goals.IsSet(GoalAdultChildren) {
-				continue
-			}
-
-			if ageDiff := math.Abs(float64(wp.Age - mp.Age)); ageDiff < ageDiffFactor*float64(wp.Age) {
-				wp.Spouse = mp
-				mp.Spouse = wp
-				if menTakeFemaleName {
-					mp.LastName = wp.LastName
-				} else {
-					wp.LastName = mp.LastName
-				}
-				log.Printf("Matched %v and %v", wp, mp)
-				break
-			}
-		}
-	}
-
-	// TODO: Instead, we should go through both men and women and find their respective best match
-	// based on their goals, opinions, etc.
-}
-
 func (m *Map) advancePregnancies() {
 	// Advance all pregnancies.
 	for _, p := range m.RealPop {
@@ -345,8 +275,11 @@ func (m *Map) advancePregnancies() {
 				child.Y = p.Y
 				child.Mother = p
 				child.Father = p.Spouse
+				child.Settlement = p.Settlement
+				child.Personality = inheritPersonality(child.Mother, child.Father)
 
 				log.Printf("Born: %v", child)
+				m.recordEvent(EventBirth, "", child, child.Mother, child.Father)
 
 				// Assign the child to the home.
 				if p.Home != nil {
@@ -387,10 +320,21 @@ func (m *Map) advancePregnancies() {
 func (m *Map) tickPeople(elapsed float64) {
 	// TODO: Tick AI less often.
 	for _, p := range m.RealPop {
-		if p.Dead {
+		// We are busy adventuring (or held captive or in prison).
+		if p.Dead || p.Party != nil || p.Missing != nil || p.Imprisoned > 0 {
 			continue
 		}
 
+		// Our base motives come first, life goals have to wait.
+		if m.UtilityAI {
+			if p.AI == nil {
+				p.AI = NewAI(p)
+			}
+			if p.AI.Tick(m, elapsed) {
+				continue
+			}
+		}
+
 		// Pick the motive to satisfy.
 		// NOTE: This is the new, continuous way of doing things.
 		m.pickMotive(p, elapsed)
@@ -0,0 +1,399 @@
+package simsettlers
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+)
+
+type ResourceType byte
+
+const (
+	ResourceFood ResourceType = iota
+	ResourceWood
+	ResourceStone
+	ResourceTools
+	ResourceCoin
+	ResourceMax
+)
+
+// String returns the name of the resource.
+func (r ResourceType) String() string {
+	switch r {
+	case ResourceFood:
+		return "food"
+	case ResourceWood:
+		return "wood"
+	case ResourceStone:
+		return "stone"
+	case ResourceTools:
+		return "tools"
+	case ResourceCoin:
+		return "coin"
+	default:
+		return "unknown"
+	}
+}
+
+// resourceValue is the price of one unit of each resource in coin.
+var resourceValue = Stockpile{
+	ResourceFood:  1,
+	ResourceWood:  2,
+	ResourceStone: 3,
+	ResourceTools: 8,
+	ResourceCoin:  1,
+}
+
+const (
+	foodPerDay    = 1     // Food a person eats per day
+	foodSpoilage  = 0.005 // Share of the food that spoils per day
+	hungerDamage  = 2.0   // Health lost per day without food
+	hungerRecover = 1.0   // Health regained per day with food
+)
+
+// Stockpile holds an amount of each resource type.
+type Stockpile [ResourceMax]int
+
+// Add adds the given resources to the stockpile.
+func (s *Stockpile) Add(o Stockpile) {
+	for r := range s {
+		s[r] += o[r]
+	}
+}
+
+// Has returns true if the stockpile contains at least the given resources.
+func (s *Stockpile) Has(o Stockpile) bool {
+	for r := range s {
+		if s[r] < o[r] {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove removes the given resources from the stockpile if all of them are
+// available and returns true on success.
+func (s *Stockpile) Remove(o Stockpile) bool {
+	if !s.Has(o) {
+		return false
+	}
+	for r := range s {
+		s[r] -= o[r]
+	}
+	return true
+}
+
+// Take removes up to n units of the given resource and returns the amount taken.
+func (s *Stockpile) Take(r ResourceType, n int) int {
+	n = max(min(n, s[r]), 0)
+	s[r] -= n
+	return n
+}
+
+// Missing returns the resources that are missing to cover the given resources.
+func (s *Stockpile) Missing(o Stockpile) Stockpile {
+	var missing Stockpile
+	for r := range s {
+		missing[r] = max(o[r]-s[r], 0)
+	}
+	return missing
+}
+
+// Value returns the value of the stockpile in coin.
+func (s *Stockpile) Value() int {
+	var val int
+	for r := range s {
+		val += s[r] * resourceValue[r]
+	}
+	return val
+}
+
+// IsEmpty returns true if the stockpile holds nothing.
+func (s *Stockpile) IsEmpty() bool {
+	return *s == Stockpile{}
+}
+
+// String returns a string representation of the stockpile.
+func (s *Stockpile) String() string {
+	var parts []string
+	for r := range s {
+		if s[r] != 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", ResourceType(r), s[r]))
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// spoil removes the share of food that spoils in a day.
+// Fractions are rounded randomly, so small stockpiles spoil as well.
+func (s *Stockpile) spoil(rate float64) {
+	s.Take(ResourceFood, randRound(float64(s[ResourceFood])*rate))
+}
+
+// randRound rounds the given value up or down randomly, weighted by the
+// fraction, so small amounts add up correctly over time.
+func randRound(x float64) int {
+	n := int(x)
+	if rand.Float64() < x-float64(n) {
+		n++
+	}
+	return n
+}
+
+// pay removes the given resources from the person and (if needed) from the
+// spouse, since couples pool their resources.
+func (p *Person) pay(cost Stockpile) {
+	for r := range cost {
+		n := cost[r] - p.Resources.Take(ResourceType(r), cost[r])
+		if n > 0 && p.Spouse != nil {
+			p.Spouse.Resources.Take(ResourceType(r), n)
+		}
+	}
+}
+
+// budget returns the pooled resources of the person and their spouse.
+func (p *Person) budget() Stockpile {
+	budget := p.Resources
+	if p.Spouse != nil {
+		budget.Add(p.Spouse.Resources)
+	}
+	return budget
+}
+
+// household returns the stockpile of the household the person belongs to.
+// Homeless people have to carry everything with them.
+func (p *Person) household() *Stockpile {
+	if p.Home != nil && p.Home.Type == BuildingTypeHouse {
+		return &p.Home.Stock
+	}
+	return &p.Resources
+}
+
+// buy buys up to n units of the given resource from the village storage,
+// as far as the person can afford it, and returns the amount bought.
+func (m *Map) buy(p *Person, r ResourceType, n int) int {
+	n = min(n, m.Resources[r], p.budget()[ResourceCoin]/resourceValue[r])
+	if n <= 0 {
+		return 0
+	}
+	price := n * resourceValue[r]
+	p.pay(Stockpile{ResourceCoin: price})
+	m.Resources[ResourceCoin] += price
+	m.Resources[r] -= n
+	p.Resources[r] += n
+	return n
+}
+
+// feed lets the person eat from the household stockpile, their own
+// resources or buy food at the market. If there is no food, the person
+// goes hungry and loses health. Whatever the person already ate during the
+// day (see ActionEat) counts towards their daily need.
+func (m *Map) feed(p *Person) {
+	need := max(foodPerDay+m.coldFood()-p.Eaten, 0)
+	p.Eaten = 0
+	need -= p.household().Take(ResourceFood, need)
+	need -= p.Resources.Take(ResourceFood, need)
+	if need > 0 && m.buy(p, ResourceFood, need) > 0 {
+		need -= p.Resources.Take(ResourceFood, need)
+	}
+	if need > 0 && (p.Age < 18 || p.Age >= 65) {
+		// Children and the elderly are fed by the village if their family can't.
+		need -= m.Resources.Take(ResourceFood, need)
+	}
+	if need > 0 {
+		p.Health -= hungerDamage
+		log.Printf("%v is starving (health %.0f)", p, p.Health)
+		if p.Health <= 0 {
+			log.Printf("%v starved to death", p)
+			m.handleDeath(p, "starved to death")
+		}
+		return
+	}
+	p.Health = min(p.Health+hungerRecover, healthMax)
+}
+
+// consumeResources feeds the population and lets food spoil.
+// Storehouses keep the village storage from spoiling as fast.
+func (m *Map) consumeResources() {
+	// NOTE: Captives are fed by their captors (or not).
+	for _, p := range m.RealPop {
+		if !p.Dead && p.Missing == nil {
+			m.feed(p)
+		}
+	}
+
+	m.Resources.spoil(foodSpoilage / float64(1+m.countBuildings(BuildingTypeStorehouse)))
+	for _, b := range m.Buildings {
+		b.Stock.spoil(foodSpoilage)
+	}
+	for _, p := range m.RealPop {
+		p.Resources.spoil(foodSpoilage)
+	}
+}
+
+// produce returns the resources that the building produced in this tick.
+// Workshops take their inputs from the village storage, and lumber camps
+// and mines harvest the closest deposits. Gardens without water access
+// only yield half, and gardens and farms depend on the season and the crops.
+func (m *Map) produce(b *Building) Stockpile {
+	yield := b.Yield()
+	if yield.IsEmpty() {
+		return yield
+	}
+	if b.Type == BuildingTypeHouse && !m.hasWaterAccess(b.X, b.Y) {
+		yield[ResourceFood] /= 2
+	}
+	if b.Type == BuildingTypeHouse || b.Type == BuildingTypeFarm {
+		yield[ResourceFood] = randRound(float64(yield[ResourceFood]) * m.cropYieldFactor())
+	}
+	if !m.Resources.Remove(buildingInputs[b.Type]) {
+		return Stockpile{}
+	}
+	for _, r := range []ResourceType{ResourceWood, ResourceStone} {
+		if yield[r] > 0 {
+			yield[r] = m.harvest(m.nearestDeposit(b.X, b.Y, r), yield[r])
+		}
+	}
+	return yield
+}
+
+const (
+	TileTypeNone = iota
+	TileTypeWater
+	TileTypeForest
+	TileTypeRock
+)
+
+const (
+	depositForest = 50   // Wood in a fully grown forest tile
+	depositRock   = 200  // Stone in a rock tile
+	forestRegrow  = 0.01 // Chance per day that a forest tile regrows one unit of wood
+)
+
+// tileResource returns the resource that can be harvested from the given tile type.
+func tileResource(t int) (ResourceType, bool) {
+	switch t {
+	case TileTypeForest:
+		return ResourceWood, true
+	case TileTypeRock:
+		return ResourceStone, true
+	}
+	return 0, false
+}
+
+// genTiles assigns tile types and deposits based on steepness and flux.
+func (m *Map) genTiles() {
+	steepness := m.calcSteepness()
+	normalize(steepness)
+
+	// Forests form clusters, so we smooth some random noise.
+	forest := make([]float64, len(m.Elevation))
+	for i := range forest {
+		forest[i] = rand.Float64()
+	}
+	for n := 0; n < 3; n++ {
+		next := make([]float64, len(forest))
+		for i := range forest {
+			nbs := m.Neighbors(i%m.Width, i/m.Width)
+			next[i] = forest[i]
+			for _, j := range nbs {
+				next[i] += forest[j]
+			}
+			next[i] /= float64(len(nbs) + 1)
+		}
+		forest = next
+	}
+	normalize(forest)
+
+	for i := range m.TileType {
+		switch {
+		case m.Flux[i] > fluxRiverThreshold:
+			m.TileType[i] = TileTypeWater
+		case steepness[i] > 0.4:
+			m.TileType[i] = TileTypeRock
+			m.Deposits[i] = depositRock
+		case forest[i] > 0.55:
+			m.TileType[i] = TileTypeForest
+			m.Deposits[i] = depositForest
+		}
+	}
+}
+
+// regrowForests lets harvested forest tiles slowly grow back.
+func (m *Map) regrowForests() {
+	for i, t := range m.TileType {
+		if t == TileTypeForest && m.Deposits[i] < depositForest && rand.Float64() < forestRegrow {
+			m.Deposits[i]++
+		}
+	}
+}
+
+// nearestDeposit returns the index of the closest tile that holds the given
+// resource (or -1 if there is none).
+func (m *Map) nearestDeposit(x, y int, r ResourceType) int {
+	best := -1
+	var bestDist int
+	for i, t := range m.TileType {
+		if tr, ok := tileResource(t); !ok || tr != r || m.Deposits[i] <= 0 {
+			continue
+		}
+		dx, dy := i%m.Width-x, i/m.Width-y
+		if dist := dx*dx + dy*dy; best == -1 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// harvest removes up to n units from the deposit of the given tile and
+// returns the amount harvested.
+func (m *Map) harvest(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	n = min(n, m.Deposits[i])
+	m.Deposits[i] -= n
+	return n
+}
+
+const (
+	harvestAmount   = 5   // Amount of resources a person can carry
+	harvestDuration = 1.0 // Time it takes to harvest a load
+)
+
+// newHarvestTree creates a behavior tree for harvesting resources from a tile.
+func newHarvestTree(p *Person, m *Map, i int, onSuccess, onFailure func()) Tree {
+	// - Move to the tile.
+	// - Harvest the resources.
+	// - Move back home.
+	// - Store the resources.
+	homeX, homeY := int(p.X), int(p.Y)
+	r, _ := tileResource(m.TileType[i])
+	dur := harvestDuration
+	var carried int
+
+	tRoot := NewTaskSequence(
+		NewTaskMoveToXY(p, i%m.Width, i/m.Width), // Move to the tile.
+		NewTaskGeneric(p, "Harvest", func(elapsed float64) TaskStatus {
+			dur -= elapsed
+			if dur > 0 {
+				return TaskStatusInProgress
+			}
+			if carried = m.harvest(i, harvestAmount); carried == 0 {
+				return TaskStatusFailed // Someone else was faster.
+			}
+			log.Printf("%v harvested %d %s", p, carried, r)
+			return TaskStatusCompleted
+		}),
+		NewTaskMoveToXY(p, homeX, homeY), // Move back home.
+		NewTaskGeneric(p, "Store", func(elapsed float64) TaskStatus {
+			p.Resources[r] += carried
+			return TaskStatusCompleted
+		}),
+	)
+	return NewTree(tRoot, onSuccess, onFailure)
+}
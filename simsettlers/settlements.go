@@ -0,0 +1,409 @@
+package simsettlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+)
+
+// Settlement is a village on the map. The first settlement is founded by
+// the settlers (see Settle), daughter settlements are founded by people who
+// can't find a home or a job once their village is overcrowded.
+//
+// NOTE: All settlements share the village storage (Map.Resources) for now,
+// as if they were trading freely with each other.
+type Settlement struct {
+	Name        string
+	Root        *Building   // The market, which the settlement is built around.
+	Parent      *Settlement // The settlement the founders came from (nil for the first settlement).
+	FoundedDay  uint16
+	FoundedYear int
+	Founders    []*Person // The people who founded the settlement.
+	Immigrants  int       // Number of people who moved here from outside of the region.
+	Emigrants   int       // Number of people who left the region from here.
+}
+
+// String returns a string representation of the settlement.
+func (s *Settlement) String() string {
+	return fmt.Sprintf("%s at (%d, %d)", s.Name, s.Root.X, s.Root.Y)
+}
+
+const (
+	migrationChance       = 0.005 // Chance per day that someone without a home or job considers moving away
+	immigrationChance     = 0.003 // Chance per day that newcomers arrive if there is a home or job for them
+	coupleChance          = 0.5   // Chance that newcomers arrive as a married couple
+	emigrationShare       = 0.3   // Share of migrants who leave the region if there is nowhere else to go
+	foundingMigrants      = 4     // Migrants needed to found a new settlement
+	foundingPopulation    = 30    // Population a settlement needs before it founds a daughter settlement
+	maxSettlements        = 4     // Maximum number of settlements on the map
+	minSettlementDistance = 30.0  // Minimum distance between two settlements
+	maxSettlementDistance = 80.0  // Maximum distance between a daughter settlement and its parent
+	newcomerMaxCoin       = 60    // Maximum coin newcomers bring along
+	newcomerMaxFood       = 20    // Maximum food newcomers bring along
+	migrationGraceYears   = 2     // Years after the founding of a settlement before people consider moving away
+	settleInDays          = 365   // Days after moving before people consider moving away again
+	maxVacancyDraw        = 3     // Maximum number of vacant homes that attract newcomers
+	settlementEdgeMargin  = 10    // Minimum distance between a settlement and the edge of the map
+)
+
+// newSettlement founds a new settlement around a new market at the given tile.
+func (m *Map) newSettlement(i int, parent *Settlement) *Settlement {
+	s := &Settlement{
+		Name:        m.placeGen.String(),
+		Parent:      parent,
+		FoundedDay:  m.Day,
+		FoundedYear: m.Year,
+	}
+	s.Root = m.AddBuilding(i%m.Width, i/m.Width, BuildingTypeMarket)
+	s.Root.Settlement = s
+	m.Settlements = append(m.Settlements, s)
+	log.Printf("Founded %v", s)
+	return s
+}
+
+// nearestSettlement returns the settlement closest to the given position
+// (or nil if there are no settlements yet).
+func (m *Map) nearestSettlement(x, y int) *Settlement {
+	var best *Settlement
+	bestDist := math.Inf(1)
+	for _, s := range m.Settlements {
+		if d := distanceToBuilding(x, y, s.Root); d < bestDist {
+			best, bestDist = s, d
+		}
+	}
+	return best
+}
+
+// settlementOf returns the settlement the person lives in.
+// People who have not been assigned to a settlement live in the first one.
+func (m *Map) settlementOf(p *Person) *Settlement {
+	if p.Settlement != nil || len(m.Settlements) == 0 {
+		return p.Settlement
+	}
+	return m.Settlements[0]
+}
+
+// rootOf returns the root building of the settlement the person lives in.
+func (m *Map) rootOf(p *Person) *Building {
+	if s := m.settlementOf(p); s != nil {
+		return s.Root
+	}
+	return m.Root
+}
+
+// isRoot returns true if the building is the root building of a settlement.
+func (m *Map) isRoot(b *Building) bool {
+	for _, s := range m.Settlements {
+		if s.Root == b {
+			return true
+		}
+	}
+	return b == m.Root
+}
+
+// inhabitants returns the living people of the settlement.
+func (m *Map) inhabitants(s *Settlement) []*Person {
+	var people []*Person
+	for _, p := range m.RealPop {
+		if !p.Dead && m.settlementOf(p) == s {
+			people = append(people, p)
+		}
+	}
+	return people
+}
+
+// countBuildingsIn returns the number of completed buildings of the given
+// type in the settlement.
+func (m *Map) countBuildingsIn(s *Settlement, t string) int {
+	var n int
+	for _, b := range m.Buildings {
+		if b.Type == t && b.Settlement == s {
+			n++
+		}
+	}
+	return n
+}
+
+// vacancies returns the number of vacant houses and jobs in the settlement.
+func (m *Map) vacancies(s *Settlement) (homes, jobs int) {
+	for _, b := range m.Buildings {
+		if b.Settlement != s {
+			continue
+		}
+		if b.Type == BuildingTypeHouse && !b.IsOccupied() {
+			homes++
+		}
+		if b.Job() != JobTypeUnemployed && b.HasVacancy() {
+			jobs += b.WorkerCapacity() - len(b.Workers)
+		}
+	}
+	return homes, jobs
+}
+
+// isMigrant returns true if the person can't find a home or a job where
+// they live and might move away. People who just arrived get some time to
+// settle in.
+// NOTE: Married couples living with their parents are waiting for a home.
+func (m *Map) isMigrant(p *Person) bool {
+	if p.Dead || p.Age < 18 || p.Age >= 65 || p.Party != nil || p.Missing != nil || p.Imprisoned > 0 {
+		return false
+	}
+	if (m.Year-p.ArrivalYear)*daysInYear+int(m.Day)-int(p.ArrivalDay) < settleInDays {
+		return false // People who never moved arrived on day 0 of year 0.
+	}
+	for _, o := range p.migrants() {
+		if len(o.Constructing) > 0 {
+			return false // We are building a home (or our spouse is).
+		}
+	}
+	if p.Home == nil || p.Spouse != nil && p.LivesWithParents() {
+		return true
+	}
+	return p.Job == JobTypeUnemployed && p.Goals.IsSet(GoalAdultJob)
+}
+
+// migrants returns the people moving along with the person: their spouse
+// and the children who still live with them.
+func (p *Person) migrants() []*Person {
+	people := []*Person{p}
+	if p.Spouse != nil && !p.Spouse.Dead && p.Spouse.Party == nil && p.Spouse.Missing == nil {
+		people = append(people, p.Spouse)
+	}
+	for _, c := range p.Children {
+		if !c.Dead && c.Age < courtshipMinAge && c.Home == p.Home && c.Party == nil && c.Missing == nil {
+			people = append(people, c)
+		}
+	}
+	return people
+}
+
+// leaveHome lets the person quit their job and move out of their home,
+// which they sell to the village if they own it. Construction sites are
+// left to the village (or the co-owners that stay behind).
+func (m *Map) leaveHome(p *Person) {
+	p.quitJob()
+	p.breakEngagement()
+	p.CurrentMotive, p.CurrentTree = nil, nil
+	for _, b := range p.Constructing {
+		m.transferBuilding(b, p, nil, "abandoned")
+	}
+	p.Constructing = nil
+	for _, b := range append([]*Building{}, p.Owns...) {
+		price := min(b.PurchasePrice()/max(len(b.Owners), 1), m.Resources[ResourceCoin])
+		p.Resources[ResourceCoin] += price
+		m.Resources[ResourceCoin] -= price
+		m.transferBuilding(b, p, nil, "sale")
+	}
+	if p.Home != nil {
+		// Take our share of the household supplies along if nobody is left.
+		p.Home.RemoveOccupant(p)
+		if !p.Home.IsOccupied() && p.Home.Type == BuildingTypeHouse {
+			p.Resources.Add(p.Home.Stock)
+			p.Home.Stock = Stockpile{}
+		}
+		p.Home = nil
+	}
+}
+
+// moveTo moves the person (and their family) to the given settlement.
+func (m *Map) moveTo(p *Person, s *Settlement) {
+	from := m.settlementOf(p)
+	people := p.migrants()
+	for _, o := range people {
+		m.leaveHome(o)
+		m.arrive(o, s)
+	}
+	log.Printf("%v moved from %v to %v", p, from, s)
+	m.recordEvent(EventMigration, "moved from "+from.Name+" to "+s.Name, people...)
+}
+
+// arrive makes the person an inhabitant of the settlement.
+func (m *Map) arrive(p *Person, s *Settlement) {
+	p.Settlement = s
+	p.ArrivalDay, p.ArrivalYear = m.Day, m.Year
+	p.X, p.Y = float64(s.Root.X), float64(s.Root.Y)
+}
+
+// emigrate lets the person (and their family) leave the region for good.
+func (m *Map) emigrate(p *Person) {
+	s := m.settlementOf(p)
+	people := p.migrants()
+	m.leaveRegion(people...)
+	log.Printf("%v left %v in search of a better life", p, s)
+	m.recordEvent(EventMigration, "left "+s.Name+" in search of a better life", people...)
+}
+
+// leaveRegion removes the people from the population for good.
+func (m *Map) leaveRegion(people ...*Person) {
+	left := make(map[*Person]bool)
+	for _, o := range people {
+		s := m.settlementOf(o)
+		m.leaveHome(o)
+		o.Emigrated = true
+		o.DepartureYear = m.Year
+		m.Emigrants = append(m.Emigrants, o)
+		m.Population--
+		s.Emigrants++
+		left[o] = true
+	}
+	var remPop []*Person
+	for _, o := range m.RealPop {
+		if !left[o] {
+			remPop = append(remPop, o)
+		}
+	}
+	m.RealPop = remPop
+}
+
+// immigrate lets a newcomer (or a married couple) from outside of the region
+// settle in the given settlement.
+func (m *Map) immigrate(s *Settlement) {
+	lastName := m.lastGen.String()
+	gender := byte(rand.Intn(2))
+	p := m.newPerson("", lastName, gender, uint16(rand.Intn(20)+18))
+	people := []*Person{p}
+	if rand.Float64() < coupleChance {
+		spouse := m.newPerson("", lastName, 1-gender, uint16(rand.Intn(20)+18))
+		p.Spouse, spouse.Spouse = spouse, p
+		people = append(people, spouse)
+	}
+	for _, o := range people {
+		o.Resources = Stockpile{
+			ResourceFood: rand.Intn(newcomerMaxFood),
+			ResourceCoin: rand.Intn(newcomerMaxCoin),
+		}
+		o.assignChildhoodGoals()
+		o.assignAdultGoals()
+		o.Immigrant = true
+		m.arrive(o, s)
+		m.RealPop = append(m.RealPop, o)
+		m.Population++
+		s.Immigrants++
+	}
+
+	// Move into an empty house that nobody owns (if any).
+	for _, b := range m.Buildings {
+		if b.Type == BuildingTypeHouse && b.Settlement == s && !b.IsOccupied() && !b.IsOwned() {
+			for _, o := range people {
+				o.SetHome(b)
+				b.AddOwner(o)
+			}
+			m.recordTransfer(nil, p, b.String(), "settlement")
+			break
+		}
+	}
+	log.Printf("%v arrived in %v", p, s)
+	m.recordEvent(EventMigration, "arrived in "+s.Name+" from afar", people...)
+}
+
+// bestSettlementSite returns the tile best suited for a new settlement
+// (or -1 if there is none). Settlements need to keep some distance from each
+// other, and daughter settlements are founded close enough to their parent
+// to stay in touch.
+func (m *Map) bestSettlementSite(parent *Settlement) int {
+	fs := m.calcFitnessScore()
+	best := -1
+	for i := range fs {
+		if m.Zones[i] != nil || math.IsInf(fs[i], -1) {
+			continue
+		}
+		x, y := i%m.Width, i/m.Width
+		if x < settlementEdgeMargin || y < settlementEdgeMargin || x >= m.Width-settlementEdgeMargin || y >= m.Height-settlementEdgeMargin {
+			continue
+		}
+		if s := m.nearestSettlement(x, y); s != nil && distanceToBuilding(x, y, s.Root) < minSettlementDistance {
+			continue
+		}
+		if parent != nil && distanceToBuilding(x, y, parent.Root) > maxSettlementDistance {
+			continue
+		}
+		if best == -1 || fs[i] > fs[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// foundSettlement lets the migrants found a daughter settlement of the given
+// settlement and returns true on success.
+func (m *Map) foundSettlement(parent *Settlement, migrants []*Person) bool {
+	i := m.bestSettlementSite(parent)
+	if i == -1 {
+		return false
+	}
+	s := m.newSettlement(i, parent)
+	var people []*Person
+	for _, p := range migrants {
+		if p.Settlement == s {
+			continue // Moved along with their family.
+		}
+		for _, o := range p.migrants() {
+			m.leaveHome(o)
+			m.arrive(o, s)
+			people = append(people, o)
+		}
+	}
+	s.Founders = people
+	m.recordEvent(EventMigration, "left "+parent.Name+" to found "+s.Name, people...)
+	return true
+}
+
+// tickMigration lets people who can't find a home or a job move to another
+// settlement (or leave the region), lets overcrowded settlements found
+// daughter settlements and lets newcomers settle where there is room for them.
+func (m *Map) tickMigration() {
+	for _, s := range append([]*Settlement{}, m.Settlements...) {
+		// The settlers of a new settlement are still busy building their homes.
+		people := m.inhabitants(s)
+		var migrants []*Person
+		for _, p := range people {
+			if m.Year-s.FoundedYear >= migrationGraceYears && m.isMigrant(p) {
+				migrants = append(migrants, p)
+			}
+		}
+
+		// Overcrowded settlements send out settlers.
+		if len(people) >= foundingPopulation && len(migrants) >= foundingMigrants &&
+			len(m.Settlements) < maxSettlements && rand.Float64() < migrationChance*float64(len(migrants)) {
+			if m.foundSettlement(s, migrants) {
+				continue
+			}
+		}
+
+		for _, p := range migrants {
+			if m.settlementOf(p) != s || p.Emigrated || rand.Float64() > migrationChance {
+				continue // Moved along with their family (or staying for now).
+			}
+			// Move to a settlement that has a home or a job for us.
+			var dest *Settlement
+			for _, o := range m.Settlements {
+				if o == s {
+					continue
+				}
+				homes, jobs := m.vacancies(o)
+				if p.Home == nil && homes > 0 || p.Job == JobTypeUnemployed && jobs > 0 {
+					dest = o
+					break
+				}
+			}
+			if dest != nil {
+				m.moveTo(p, dest)
+			} else if rand.Float64() < emigrationShare {
+				m.emigrate(p)
+			}
+		}
+
+		// Newcomers arrive if there is an empty home for them (and nobody
+		// here is looking for one), even more so if there is work.
+		if homes, jobs := m.vacancies(s); homes > 0 && len(migrants) == 0 {
+			chance := immigrationChance * float64(min(homes, maxVacancyDraw))
+			if jobs > 0 {
+				chance *= 2
+			}
+			if rand.Float64() < chance {
+				m.immigrate(s)
+			}
+		}
+	}
+}
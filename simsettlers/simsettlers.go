@@ -29,31 +29,52 @@ type Map struct {
 	Elevation    []float64
 	Flux         []float64
 	TileType     []int
-	Dungeons     []*Building // The dungeons.
-	Root         *Building   // The root building, which the settlers will build around.
-	Cemetery     *Building   // The cemetery.
+	Deposits     []int         // Resources that can be harvested from each tile.
+	Zones        []*Building   // Building occupying each tile (including plots).
+	Dungeons     []*Dungeon    // The dungeons.
+	Parties      []*Party      // Parties venturing into the dungeons.
+	Succession   SuccessionLaw // Who inherits the estate of the deceased.
+	Transfers    []*Transfer   // Record of all property that changed hands.
+	Chronicle    []*Event      // Noteworthy events in the history of the village.
+	Weather      Weather       // The weather of the current day.
+	Crops        Crops         // The crops on the fields of the village.
+	Epidemics    []*Epidemic   // Outbreaks of contagious diseases.
+	Crimes       []*Crime      // Record of all crimes (solved or not).
+	Feuds        []*Feud       // Feuds between families.
+	Settlements  []*Settlement // The settlements on the map, the first one founded by the settlers.
+	Root         *Building     // The root building of the first settlement.
+	Cemetery     *Building     // The cemetery.
 	Buildings    []*Building
 	Construction []*Building
-	Resources    int
+	Resources    Stockpile // Village storage.
 	Population   int
 	RealPop      []*Person
+	Emigrants    []*Person       // People who left the region.
 	firstGen     [2]fmt.Stringer // First name generators (male/female).
 	lastGen      fmt.Stringer    // Last name generators.
+	placeGen     fmt.Stringer    // Settlement name generator.
 	Export       *webpExport
+	UtilityAI    bool // Use the utility AI (see ai.go) for the base motives of people.
 }
 
 // first name prefixes for fantasyname generator.
 const firstNamePrefix = "!(bil|bal|ban|hil|ham|hal|hol|hob|wil|me|or|ol|od|gor|for|fos|tol|ar|fin|ere|leo|vi|bi|bren|thor)"
 
+// settlement name pattern for fantasyname generator.
+const settlementNamePattern = "!BV(ton|ford|by|wick|ham|stead|dale|burg|well|moor)"
+
 // NewMap creates a new map with the given height and width.
 func NewMap(height, width int) *Map {
 	m := &Map{
+		Calendar:   Calendar{Day: settleDay},
 		Height:     height,
 		Width:      width,
 		Elevation:  make([]float64, height*width),
 		Flux:       make([]float64, height*width),
 		TileType:   make([]int, height*width),
-		Resources:  100,
+		Deposits:   make([]int, height*width),
+		Zones:      make([]*Building, height*width),
+		Resources:  Stockpile{ResourceFood: 600, ResourceWood: 50, ResourceStone: 20, ResourceTools: 10, ResourceCoin: 100},
 		Population: 15,
 		Cemetery:   NewBuilding(0, 0, BuildingTypeCemetery),
 		Export:     newWebPExport(width, height),
@@ -82,6 +103,13 @@ func NewMap(height, width int) *Map {
 	}
 	m.lastGen = genLast
 
+	// Settlement names.
+	genPlace, err := fantasyname.Compile(settlementNamePattern, fantasyname.Collapse(true), fantasyname.RandFn(rand.Intn))
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.placeGen = genPlace
+
 	m.addNRandomPeople(m.Population)
 
 	// Normalize the elevation.
@@ -90,6 +118,9 @@ func NewMap(height, width int) *Map {
 	// Calculate the flux.
 	m.calcFlux()
 
+	// Place forests and rocks.
+	m.genTiles()
+
 	return m
 }
 
@@ -321,26 +352,32 @@ func (m *Map) Neighbors(x, y int) []int {
 
 // Settle picks a suitable location for the settlers to settle and builds the first building.
 func (m *Map) Settle() {
-	// Calculate the fitness score for each point.
-	fs := m.calcFitnessScore()
-
-	// Find the best point.
-	best := 0
-	for i := range fs {
-		if fs[i] > fs[best] {
-			best = i
+	// Found the first settlement at the best spot. On small maps (or if
+	// there is no land far enough from the edge) we settle for the fittest
+	// tile anywhere.
+	best := m.bestSettlementSite(nil)
+	if best == -1 {
+		fs := m.calcFitnessScore()
+		best = 0
+		for i := range fs {
+			if fs[i] > fs[best] {
+				best = i
+			}
 		}
 	}
-
-	// Build the first building.
-	m.Root = m.AddBuilding(best%m.Width, best/m.Width, BuildingTypeMarket)
+	s := m.newSettlement(best, nil)
+	m.Root = s.Root
+	for _, p := range m.RealPop {
+		p.Settlement = s
+		s.Founders = append(s.Founders, p)
+	}
 
 	// Add the dungeon.
 	// Find the best spot for the dungeon.
 	const numDungeons = 4
 	for i := 0; i < numDungeons; i++ {
-		fs = m.calcFitnessScoreDungeon()
-		best = 0
+		fs := m.calcFitnessScoreDungeon()
+		best := 0
 		normalize(fs)
 		for i := range fs {
 			if fs[i] > fs[best] {
@@ -349,7 +386,7 @@ func (m *Map) Settle() {
 		}
 		x := best % m.Width
 		y := best / m.Width
-		m.Dungeons = append(m.Dungeons, m.AddBuilding(x, y, BuildingTypeDungeon))
+		m.Dungeons = append(m.Dungeons, newDungeon(m.AddBuilding(x, y, BuildingTypeDungeon)))
 	}
 }
 
@@ -358,19 +395,36 @@ func (m *Map) Tick(elapsed float64) {
 	// Advance the time of day.
 	m.TickCalendar(elapsed)
 
+	// Generate the weather and let the crops grow.
+	m.tickWeather()
+	m.tickCrops()
+
 	// Age the population.
 	m.agePop()
 
-	// Get all yields for this tick.
+	// Get all yields for this tick and add them to the resources.
+	// Gardens feed their household, everything else goes to the village,
+	// which pays the wages of the workers.
 	// TODO: Only calculate yields for buildings that are
 	// inhabited.
-	var yields int
 	for _, b := range m.Buildings {
-		yields += b.Yield()
+		y := m.produce(b)
+		if b.Type == BuildingTypeHouse {
+			b.Stock.Add(y)
+			continue
+		}
+		m.Resources.Add(y)
+		m.payWages(b, y)
 	}
 
-	// Add the yields to the resources.
-	m.Resources += yields
+	// Farmers harvest their plots.
+	m.tickFarmers()
+
+	// Eat and let food spoil.
+	m.consumeResources()
+
+	// Let the forests grow back.
+	m.regrowForests()
 
 	// Advance unoccupied building decay.
 	m.tickBuildings()
@@ -378,15 +432,41 @@ func (m *Map) Tick(elapsed float64) {
 	// Advance building construction.
 	m.advanceConstruction()
 
+	// Build workplaces for people looking for a job.
+	m.constructWorkplaces()
+
+	// Build wells, storehouses and walls if needed.
+	m.constructCivicBuildings()
+
+	// Expand farms that are fully staffed.
+	m.expandFarms()
+
 	// Construct more houses if needed.
 	m.tickPeople(elapsed)
 	// m.constructMoreHouses()
 
-	// Match singles.
-	m.matchSingles()
+	// Advance the parties in the dungeons and let the dungeons repopulate.
+	m.tickParties()
+	m.tickDungeons()
+
+	// Let injuries heal and the sick recover.
+	m.tickInjuries()
+	m.tickIllness()
+
+	// Pay back debts.
+	m.collectDebts()
+
+	// Advance engagements and marriages.
+	m.tickCourtships()
 
 	// Advance pregnancies.
 	m.advancePregnancies()
 
+	// Let people move between settlements, leave or arrive.
+	m.tickMigration()
+
+	// Let people commit crimes and bring them to justice.
+	m.tickCrime()
+
 	m.storeWebPFrame()
 }
@@ -16,12 +16,20 @@ const (
 	TaskStatusFailed
 )
 
+// stepsPerDay is the number of steps a plan (tree) advances per tick (day).
+const stepsPerDay = 24
+
 // Tree is a chain of tasks that can be executed by a person.
+// Each task in the chain can be a composite or decorator node (see behavior.go),
+// which turns the chain into a proper behavior tree.
 type Tree struct {
-	Root Task
+	Root   Task
+	Status TaskStatus // Status of the last step
 
 	OnSuccess func()
 	OnFailure func()
+
+	current Task // Task we are currently executing (nil if not started)
 }
 
 func NewTree(root Task, onSuccess, onFailure func()) Tree {
@@ -36,42 +44,58 @@ func NewTree(root Task, onSuccess, onFailure func()) Tree {
 // The tree will be executed from start to finish.
 // DO NOT USE THIS FUNCTION, it is a left-over from the previous implementation.
 func (t *Tree) Do(elapsed float64) bool {
-	task := t.Root
-	for task != nil {
-		status := task.Do(elapsed)
-		if status == TaskStatusCompleted {
-			task = task.Next()
-		} else if status == TaskStatusFailed {
-			t.OnFailure()
-			return false
+	for t.Step(elapsed) {
+		if t.Status == TaskStatusCompleted {
+			return true
 		}
 	}
-	t.OnSuccess()
-	return true
+	return false
 }
 
 // Step executes the next step in the tree using a variable time step.
-// The tree will be evaluated from the root, so if a task step fails or
-// is invalid (e.g. the person is not at the right location), the tree
-// will be restarted from the root.
+// The tree continues where it left off in the previous step, so it can
+// be suspended (by simply not stepping it) and resumed at any time.
+// Returns false if the tree failed.
 func (t *Tree) Step(elapsed float64) bool {
+	if t.current == nil {
+		t.current = t.Root
+	}
 	// Do until we either get InProgress or Failed.
-	task := t.Root
-	for task != nil {
-		status := task.Do(elapsed)
-		if status == TaskStatusCompleted {
-			task = task.Next()
-		} else if status == TaskStatusFailed {
+	for t.current != nil {
+		switch t.current.Do(elapsed) {
+		case TaskStatusCompleted:
+			t.current = t.current.Next()
+		case TaskStatusFailed:
+			t.Reset()
+			t.Status = TaskStatusFailed
 			t.OnFailure()
 			return false
-		} else {
+		default:
+			t.Status = TaskStatusInProgress
 			return true
 		}
 	}
+	t.Reset()
+	t.Status = TaskStatusCompleted
 	t.OnSuccess()
 	return true
 }
 
+// IsDone returns true if the tree has completed or failed.
+func (t *Tree) IsDone() bool {
+	return t.Status == TaskStatusCompleted || t.Status == TaskStatusFailed
+}
+
+// Reset resets the tree (and all tasks in the chain) so it starts over
+// from the root in the next step.
+func (t *Tree) Reset() {
+	for task := t.Root; task != nil; task = task.Next() {
+		resetTask(task)
+	}
+	t.current = nil
+	t.Status = TaskStatusNotStarted
+}
+
 // Task is a task that can be executed by a person.
 // A task can be chained together with other tasks.
 type Task interface {
@@ -0,0 +1,452 @@
+package simsettlers
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/hajimehoshi/ebiten/vector"
+)
+
+const (
+	ViewerWidth  = 960
+	ViewerHeight = 640
+	viewerTile   = 8   // Size of a tile in pixels (at zoom level 1)
+	panelWidth   = 280 // Width of the inspection panel in pixels
+	pickRadius   = 1.0 // Distance in tiles within which a click selects a person
+)
+
+// viewerSpeeds are the available simulation speeds in ticks (days) per frame.
+var viewerSpeeds = []int{0, 1, 2, 5, 20}
+
+// buildingColors are the colors of the building types in the viewer.
+var buildingColors = map[string]color.RGBA{
+	BuildingTypeMarket:     {0, 255, 0, 255},
+	BuildingTypeHouse:      {200, 60, 40, 255},
+	BuildingTypeCemetery:   {90, 90, 90, 255},
+	BuildingTypeDungeon:    {233, 128, 0, 255},
+	BuildingTypeSmithy:     {60, 60, 60, 255},
+	BuildingTypeMill:       {240, 240, 200, 255},
+	BuildingTypeLumberCamp: {120, 80, 30, 255},
+	BuildingTypeMine:       {100, 70, 60, 255},
+	BuildingTypeTemple:     {255, 255, 255, 255},
+	BuildingTypeGuardhouse: {140, 140, 180, 255},
+	BuildingTypeFarm:       {220, 200, 90, 255},
+	BuildingTypeWorkshop:   {170, 110, 60, 255},
+	BuildingTypeTavern:     {230, 150, 40, 255},
+	BuildingTypeWell:       {60, 120, 255, 255},
+	BuildingTypeWall:       {70, 70, 70, 255},
+	BuildingTypeStorehouse: {150, 100, 50, 255},
+}
+
+// Game is an interactive viewer for the village, which can be run using
+// ebiten.RunGame. Left click a person or building to inspect them, use the
+// mouse wheel (or E / C) to zoom, WASD (or the right mouse button) to pan,
+// and space / 1-4 to pause or change the speed of the simulation.
+type Game struct {
+	Map        *Map
+	Selected   *Person   // person to inspect (if any)
+	Building   *Building // building to inspect (if any)
+	speed      int       // index into viewerSpeeds
+	width      int
+	height     int
+	camX       float64 // world position (in pixels) at the center of the screen
+	camY       float64
+	camScale   float64
+	camScaleTo float64
+	mousePanX  int
+	mousePanY  int
+	terrain    *ebiten.Image
+	frame      *image.RGBA
+}
+
+// NewGame settles a new village on a map of the given size and returns a
+// viewer for it.
+func NewGame(width, height int) *Game {
+	m := NewMap(height, width)
+	m.Export = nil // We don't record an animation while viewing.
+	m.Settle()
+	return &Game{
+		Map:        m,
+		speed:      1,
+		camX:       float64(m.Root.X * viewerTile),
+		camY:       float64(m.Root.Y * viewerTile),
+		camScale:   2,
+		camScaleTo: 2,
+		mousePanX:  math.MinInt32,
+		mousePanY:  math.MinInt32,
+		frame:      image.NewRGBA(image.Rect(0, 0, m.Width, m.Height)),
+	}
+}
+
+// Update handles the input and advances the simulation.
+func (g *Game) Update() error {
+	// Speed controls.
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		if g.speed == 0 {
+			g.speed = 1
+		} else {
+			g.speed = 0
+		}
+	}
+	for i, k := range []ebiten.Key{ebiten.Key1, ebiten.Key2, ebiten.Key3, ebiten.Key4} {
+		if inpututil.IsKeyJustPressed(k) {
+			g.speed = i + 1
+		}
+	}
+
+	// Update target zoom level.
+	var scrollY float64
+	if ebiten.IsKeyPressed(ebiten.KeyC) || ebiten.IsKeyPressed(ebiten.KeyPageDown) {
+		scrollY = -0.25
+	} else if ebiten.IsKeyPressed(ebiten.KeyE) || ebiten.IsKeyPressed(ebiten.KeyPageUp) {
+		scrollY = 0.25
+	} else {
+		_, scrollY = ebiten.Wheel()
+		scrollY = min(max(scrollY, -1), 1)
+	}
+	g.camScaleTo = min(max(g.camScaleTo+scrollY*(g.camScaleTo/7), 0.25), 16)
+
+	// Smooth zoom transition.
+	g.camScale += (g.camScaleTo - g.camScale) / 10
+
+	// Pan camera via keyboard.
+	pan := 7.0 / g.camScale
+	if ebiten.IsKeyPressed(ebiten.KeyLeft) || ebiten.IsKeyPressed(ebiten.KeyA) {
+		g.camX -= pan
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyRight) || ebiten.IsKeyPressed(ebiten.KeyD) {
+		g.camX += pan
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyUp) || ebiten.IsKeyPressed(ebiten.KeyW) {
+		g.camY -= pan
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyDown) || ebiten.IsKeyPressed(ebiten.KeyS) {
+		g.camY += pan
+	}
+
+	// Pan camera via mouse.
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
+		x, y := ebiten.CursorPosition()
+		if g.mousePanX != math.MinInt32 {
+			g.camX += float64(g.mousePanX-x) / g.camScale
+			g.camY += float64(g.mousePanY-y) / g.camScale
+		}
+		g.mousePanX, g.mousePanY = x, y
+	} else {
+		g.mousePanX, g.mousePanY = math.MinInt32, math.MinInt32
+	}
+
+	// Clamp camera position.
+	g.camX = min(max(g.camX, 0), float64(g.Map.Width*viewerTile))
+	g.camY = min(max(g.camY, 0), float64(g.Map.Height*viewerTile))
+
+	// Select whatever we clicked on (unless we clicked on the panel).
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		if x, y := ebiten.CursorPosition(); x < g.width-panelWidth {
+			g.pick(g.screenToTile(x, y))
+		}
+	}
+
+	// Advance the simulation.
+	for i := 0; i < viewerSpeeds[g.speed]; i++ {
+		g.Map.Tick(1.0 / 60)
+	}
+	if viewerSpeeds[g.speed] > 0 || g.terrain == nil {
+		g.Map.drawTerrain(g.frame)
+		if g.terrain != nil {
+			g.terrain.Dispose()
+		}
+		g.terrain = ebiten.NewImageFromImage(g.frame)
+	}
+	return nil
+}
+
+// screenToTile converts the screen position to tile coordinates.
+func (g *Game) screenToTile(x, y int) (float64, float64) {
+	wx := (float64(x)-float64(g.width-panelWidth)/2)/g.camScale + g.camX
+	wy := (float64(y)-float64(g.height)/2)/g.camScale + g.camY
+	return wx / viewerTile, wy / viewerTile
+}
+
+// tileToScreen converts the tile coordinates to the screen position.
+func (g *Game) tileToScreen(x, y float64) (float32, float32) {
+	sx := (x*viewerTile-g.camX)*g.camScale + float64(g.width-panelWidth)/2
+	sy := (y*viewerTile-g.camY)*g.camScale + float64(g.height)/2
+	return float32(sx), float32(sy)
+}
+
+// pick selects the person closest to the given tile coordinates, or if
+// there is none nearby, the building on the tile.
+func (g *Game) pick(x, y float64) {
+	m := g.Map
+	g.Selected, g.Building = nil, nil
+	best := pickRadius
+	for _, p := range m.RealPop {
+		if d := p.distanceTo(x, y); !p.Dead && p.Missing == nil && d < best {
+			g.Selected, best = p, d
+		}
+	}
+	if g.Selected != nil {
+		return
+	}
+	tx, ty := int(x), int(y)
+	if tx < 0 || ty < 0 || tx >= m.Width || ty >= m.Height {
+		return
+	}
+	if b := m.Zones[tx+ty*m.Width]; b != nil {
+		g.Building = b
+		return
+	}
+	for _, b := range append(append([]*Building{}, m.Buildings...), m.Construction...) {
+		if b.X == tx && b.Y == ty {
+			g.Building = b
+			return
+		}
+	}
+	for _, d := range m.Dungeons {
+		if d.X == tx && d.Y == ty {
+			g.Building = d.Building
+			return
+		}
+	}
+}
+
+// drawTerrain draws the terrain, forests, rocks, rivers and fields.
+func (m *Map) drawTerrain(img *image.RGBA) {
+	for i, e := range m.Elevation {
+		x, y := i%m.Width, i/m.Width
+		switch {
+		case m.Flux[i] > fluxRiverThreshold:
+			img.Set(x, y, color.RGBA{60, 90, 255, 255})
+		case m.TileType[i] == TileTypeForest:
+			img.Set(x, y, color.RGBA{0, uint8(200 - 100*m.Deposits[i]/depositForest), 0, 255})
+		case m.TileType[i] == TileTypeRock:
+			img.Set(x, y, color.RGBA{uint8(200 - 100*m.Deposits[i]/depositRock), 80, 60, 255})
+		case m.Weather.Type == WeatherSnow || m.Weather.IsFreezing() && m.Season() == SeasonWinter:
+			v := uint8(200 + e*55)
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		default:
+			v := uint8(e * 200)
+			img.Set(x, y, color.RGBA{v / 2, 80 + v/2, v / 3, 255})
+		}
+	}
+	for _, b := range m.Buildings {
+		for _, i := range b.Plots {
+			img.Set(i%m.Width, i/m.Width, buildingColors[b.Type])
+		}
+	}
+}
+
+// Draw draws the village and the inspection panel.
+func (g *Game) Draw(screen *ebiten.Image) {
+	m := g.Map
+
+	// Draw the terrain.
+	if g.terrain != nil {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(viewerTile, viewerTile)
+		op.GeoM.Translate(-g.camX, -g.camY)
+		op.GeoM.Scale(g.camScale, g.camScale)
+		op.GeoM.Translate(float64(g.width-panelWidth)/2, float64(g.height)/2)
+		screen.DrawImage(g.terrain, op)
+	}
+	size := float32(viewerTile * g.camScale)
+
+	// Draw the buildings, construction sites and dungeons.
+	for _, b := range m.Buildings {
+		x, y := g.tileToScreen(float64(b.X), float64(b.Y))
+		vector.DrawFilledRect(screen, x, y, size, size, buildingColors[b.Type], true)
+	}
+	for _, b := range m.Construction {
+		x, y := g.tileToScreen(float64(b.X), float64(b.Y))
+		vector.StrokeRect(screen, x, y, size, size, 1, color.RGBA{255, 255, 0, 255}, true)
+	}
+	for _, d := range m.Dungeons {
+		c := color.RGBA{233, 128, 0, 255}
+		if d.Cleared {
+			c = color.RGBA{128, 128, 128, 255}
+		}
+		x, y := g.tileToScreen(float64(d.X), float64(d.Y))
+		vector.DrawFilledRect(screen, x, y, size, size, c, true)
+	}
+	for _, s := range m.Settlements {
+		x, y := g.tileToScreen(float64(s.Root.X), float64(s.Root.Y))
+		ebitenutil.DebugPrintAt(screen, s.Name, int(x), int(y-size)-12)
+	}
+	if b := g.Building; b != nil {
+		x, y := g.tileToScreen(float64(b.X), float64(b.Y))
+		vector.StrokeRect(screen, x-2, y-2, size+4, size+4, 2, color.White, true)
+	}
+
+	// Draw the people (walking along their paths).
+	for _, p := range m.RealPop {
+		if p.Dead || p.Missing != nil {
+			continue
+		}
+		c := color.RGBA{0, 100, 255, 255}
+		if p.isSick() {
+			c = color.RGBA{120, 200, 0, 255}
+		} else if p.Party != nil {
+			c = color.RGBA{255, 60, 200, 255}
+		}
+		x, y := g.tileToScreen(p.X+0.5, p.Y+0.5)
+		vector.DrawFilledCircle(screen, x, y, size/3, c, true)
+		if p == g.Selected {
+			vector.StrokeLine(screen, x, y, x+float32(p.Speed.X)*size*4, y+float32(p.Speed.Y)*size*4, 1, color.White, true)
+			vector.StrokeRect(screen, x-size/2, y-size/2, size, size, 2, color.White, true)
+		}
+	}
+
+	// Draw the panel.
+	px := g.width - panelWidth
+	vector.DrawFilledRect(screen, float32(px), 0, panelWidth, float32(g.height), color.RGBA{20, 20, 30, 230}, false)
+	info := fmt.Sprintf("DAY %d YEAR %d (%s)\nWEATHER %v\nPOP %d  SPEED %dx\nSPACE pause  1-4 speed\nWASD/EC or mouse to pan/zoom\n\n", m.Day, m.Year, m.Season(), &m.Weather, m.Population, viewerSpeeds[g.speed])
+	if g.Selected != nil {
+		info += g.Selected.inspect()
+	} else if g.Building != nil {
+		info += g.Building.inspect()
+	} else {
+		info += "Click a person or building\nto inspect them."
+	}
+	ebitenutil.DebugPrintAt(screen, info, px+8, 8)
+}
+
+// Layout implements ebiten.Game.
+func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	g.width = outsideWidth
+	g.height = outsideHeight
+	return g.width, g.height
+}
+
+// inspect returns a description of the person for the inspection panel.
+func (p *Person) inspect() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n%d years (%s)\n", p.Name(), p.Age, p.genderString())
+	fmt.Fprintf(&sb, "Health %.0f", p.Health)
+	if p.Illness != nil {
+		fmt.Fprintf(&sb, ", %v", p.Illness)
+	}
+	fmt.Fprintf(&sb, "\nJob %s\nCoin %d\n", p.Job, p.Resources[ResourceCoin])
+	if p.Settlement != nil {
+		fmt.Fprintf(&sb, "Lives in %s\n", p.Settlement.Name)
+	}
+	if p.Home != nil {
+		fmt.Fprintf(&sb, "Home %d,%d\n", p.Home.X, p.Home.Y)
+	} else {
+		sb.WriteString("Homeless\n")
+	}
+	if p.Imprisoned > 0 {
+		fmt.Fprintf(&sb, "In prison (%d days)\n", p.Imprisoned)
+	}
+	if p.Convictions > 0 {
+		fmt.Fprintf(&sb, "Convictions %d\n", p.Convictions)
+	}
+
+	sb.WriteString("\nMOTIVES\n")
+	if p.AI != nil {
+		for _, mo := range p.AI.Motives {
+			cur := " "
+			if mo == p.AI.CurrentMotive {
+				cur = ">"
+			}
+			fmt.Fprintf(&sb, "%s%s\n", cur, mo)
+		}
+	}
+	for _, mo := range p.Motives {
+		cur := " "
+		if mo == p.CurrentMotive {
+			cur = ">"
+		}
+		fmt.Fprintf(&sb, "%s%s\n", cur, mo)
+	}
+	fmt.Fprintf(&sb, "GOALS %s\n", p.Goals.String())
+
+	sb.WriteString("\nFAMILY\n")
+	for _, r := range []struct {
+		rel string
+		p   *Person
+	}{{"Mother", p.Mother}, {"Father", p.Father}, {"Spouse", p.Spouse}, {"Fiance", p.Fiance}} {
+		if r.p != nil {
+			fmt.Fprintf(&sb, " %s %s\n", r.rel, r.p.Name())
+		}
+	}
+	for _, c := range p.Children {
+		dead := ""
+		if c.Dead {
+			dead = " (dead)"
+		}
+		fmt.Fprintf(&sb, " Child %s%s\n", c.Name(), dead)
+	}
+
+	sb.WriteString("\nOPINIONS\n")
+	var known []*Person
+	for o := range p.Opinions {
+		if !o.Dead {
+			known = append(known, o)
+		}
+	}
+	sort.Slice(known, func(i, j int) bool {
+		return p.Opinions.Value(known[i]) > p.Opinions.Value(known[j])
+	})
+	for i, o := range known {
+		if i >= 8 {
+			fmt.Fprintf(&sb, " ... %d more\n", len(known)-i)
+			break
+		}
+		fmt.Fprintf(&sb, " %s %d\n", o.Name(), p.Opinions.Value(o))
+	}
+
+	var hated []*Person
+	for o := range p.Grudges {
+		if !o.Dead {
+			hated = append(hated, o)
+		}
+	}
+	if len(hated) > 0 {
+		sb.WriteString("\nGRUDGES\n")
+		sort.Slice(hated, func(i, j int) bool {
+			return p.Grudges.Value(hated[i]) > p.Grudges.Value(hated[j])
+		})
+		for i, o := range hated {
+			if i >= 4 {
+				fmt.Fprintf(&sb, " ... %d more\n", len(hated)-i)
+				break
+			}
+			fmt.Fprintf(&sb, " %s %d\n", o.Name(), p.Grudges.Value(o))
+		}
+	}
+	return sb.String()
+}
+
+// inspect returns a description of the building for the inspection panel.
+func (b *Building) inspect() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s at %d,%d\nCondition %d\n", strings.ToUpper(b.Type), b.X, b.Y, b.Condition)
+	if b.Settlement != nil {
+		fmt.Fprintf(&sb, "Settlement %s\n", b.Settlement.Name)
+	}
+	if b.Remaining > 0 {
+		fmt.Fprintf(&sb, "Under construction (%d days)\n", b.Remaining)
+	}
+	fmt.Fprintf(&sb, "Stock %s\n", b.Stock.String())
+	for _, l := range []struct {
+		name   string
+		people []*Person
+	}{{"OWNERS", b.Owners}, {"OCCUPANTS", b.Occupants}, {"WORKERS", b.Workers}} {
+		if len(l.people) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s\n", l.name)
+		for _, p := range l.people {
+			fmt.Fprintf(&sb, " %s (%d)\n", p.Name(), p.Age)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,221 @@
+package simsettlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+)
+
+// WeatherType is the kind of weather of a day.
+type WeatherType byte
+
+const (
+	WeatherClear WeatherType = iota
+	WeatherCloudy
+	WeatherRain
+	WeatherSnow
+	WeatherStorm
+)
+
+func (w WeatherType) String() string {
+	switch w {
+	case WeatherClear:
+		return "clear"
+	case WeatherCloudy:
+		return "cloudy"
+	case WeatherRain:
+		return "rain"
+	case WeatherSnow:
+		return "snow"
+	case WeatherStorm:
+		return "storm"
+	default:
+		return "unknown"
+	}
+}
+
+// Weather is the weather of the current day.
+type Weather struct {
+	Type        WeatherType
+	Temperature float64 // in degrees Celsius
+	Rain        float64 // precipitation in mm
+	DryDays     int     // consecutive days without precipitation
+	anomaly     float64 // deviation from the seasonal temperature, which changes slowly
+}
+
+// String returns a string representation of the weather.
+func (w *Weather) String() string {
+	return fmt.Sprintf("%s, %.1f°C, %.1fmm", w.Type, w.Temperature, w.Rain)
+}
+
+// IsFreezing returns true if the temperature is below zero.
+func (w *Weather) IsFreezing() bool {
+	return w.Temperature < 0
+}
+
+const (
+	meanTemperature      = 9.0  // Mean temperature over the year
+	temperatureAmplitude = 11.0 // Difference between the mean and the coldest / warmest day
+	coldestDay           = 15   // Day of the year with the lowest mean temperature
+	temperatureVariance  = 1.5  // Daily change of the temperature anomaly
+	anomalyPersistence   = 0.85 // How much of the anomaly carries over to the next day
+	droughtDays          = 20   // Days without rain after which crops wither
+)
+
+// Chance per day of precipitation, storms and clouds, by season.
+var (
+	rainChance   = [4]float64{0.35, 0.4, 0.25, 0.45}
+	stormChance  = [4]float64{0.005, 0.005, 0.01, 0.015}
+	cloudyChance = [4]float64{0.3, 0.25, 0.15, 0.25}
+)
+
+// seasonalTemperature returns the mean temperature of the given day.
+func seasonalTemperature(day uint16) float64 {
+	return meanTemperature - temperatureAmplitude*math.Cos(2*math.Pi*float64(int(day)-coldestDay)/daysInYear)
+}
+
+// tickWeather generates the weather of the day. The temperature follows the
+// seasons, but warm and cold spells last for several days. Precipitation
+// falls as snow if it is freezing.
+func (m *Map) tickWeather() {
+	w := &m.Weather
+	prev := w.Type
+	season := m.Season()
+	w.anomaly = w.anomaly*anomalyPersistence + rand.NormFloat64()*temperatureVariance
+	w.Temperature = seasonalTemperature(m.Day) + w.anomaly
+
+	w.Rain = 0
+	switch r := rand.Float64(); {
+	case r < stormChance[season]:
+		w.Type = WeatherStorm
+		w.Rain = 10 + rand.Float64()*30
+	case r < rainChance[season]:
+		w.Type = WeatherRain
+		w.Rain = 1 + rand.Float64()*10
+		if w.IsFreezing() {
+			w.Type = WeatherSnow
+		}
+	case r < rainChance[season]+cloudyChance[season]:
+		w.Type = WeatherCloudy
+	default:
+		w.Type = WeatherClear
+	}
+	if w.Rain > 0 {
+		w.DryDays = 0
+	} else {
+		w.DryDays++
+	}
+
+	if w.Type != prev {
+		log.Printf("Weather changed to %v", w)
+	}
+	if w.Type == WeatherStorm && prev != WeatherStorm {
+		if w.IsFreezing() {
+			m.recordEvent(EventWeather, "a blizzard buried the village in snow")
+		} else {
+			m.recordEvent(EventWeather, "a storm swept through the village")
+		}
+	}
+}
+
+// Crops is the state of the crops on the fields of the village.
+// Crops are sown in spring, grow if it is warm enough and are harvested
+// in late summer and autumn. Frost, drought and storms damage them.
+type Crops struct {
+	Growth  float64 // 0-1, how far the crops have grown since they were sown
+	Quality float64 // 0-1, how healthy the crops are
+	Sown    bool    // true if the crops were sown this year
+}
+
+const (
+	settleDay          = 60   // Settlers arrive on the 1st of March, in time to sow
+	sowingMonth        = 2    // March
+	harvestStartMonth  = 7    // August
+	harvestEndMonth    = 9    // October
+	cropGrowDays       = 90   // Days the crops need to grow at the optimal temperature
+	cropMinTemperature = 5.0  // Temperature below which crops don't grow
+	cropOptTemperature = 18.0 // Temperature at which crops grow the fastest
+	cropFrostDamage    = 0.05 // Quality lost per day of frost
+	cropDroughtDamage  = 0.01 // Quality lost per day of drought
+	cropStormDamage    = 0.05 // Quality lost per storm
+	cropHarvestYield   = 2.0  // Yield factor of a perfect harvest during the harvest window
+)
+
+// seasonYield is the yield factor of farms and gardens outside of the
+// harvest window (vegetables, eggs, milk, ...).
+var seasonYield = [4]float64{0.5, 0.6, 0.9, 0.7}
+
+// tickCrops lets the crops grow (or wither) depending on the weather.
+func (m *Map) tickCrops() {
+	c := &m.Crops
+	w := &m.Weather
+	month := m.Month()
+	if month < sowingMonth || month > harvestEndMonth {
+		c.Sown = false
+		return
+	}
+	// NOTE: The fields are sown as soon as possible during the sowing month,
+	// so settlers arriving after the 1st still get a harvest.
+	if month == sowingMonth && !c.Sown {
+		log.Printf("The crops were sown")
+		c.Growth, c.Quality, c.Sown = 0, 1, true
+	}
+
+	if w.Temperature > cropMinTemperature && c.Growth < 1 {
+		c.Growth += min((w.Temperature-cropMinTemperature)/(cropOptTemperature-cropMinTemperature), 1) / cropGrowDays
+	}
+	if w.IsFreezing() {
+		// Seedlings are hardier than fully grown crops.
+		c.Quality -= cropFrostDamage * min(c.Growth, 1)
+	}
+	if w.DryDays > droughtDays {
+		c.Quality -= cropDroughtDamage
+	}
+	if w.Type == WeatherStorm {
+		c.Quality -= cropStormDamage
+	}
+	c.Quality = max(c.Quality, 0)
+
+	if d, _ := dayToDate(m.Day); month == harvestEndMonth && d == int(daysInMonth[month]) {
+		m.recordEvent(EventWeather, "the harvest "+c.harvestString())
+	}
+}
+
+// harvestString describes the yield of the harvest.
+func (c *Crops) harvestString() string {
+	switch y := min(c.Growth, 1) * c.Quality; {
+	case y > 0.8:
+		return "was bountiful"
+	case y > 0.5:
+		return "was good"
+	case y > 0.2:
+		return "was meager"
+	default:
+		return "failed"
+	}
+}
+
+// cropYieldFactor returns the factor by which the food yield of farms and
+// gardens is multiplied on the current day.
+func (m *Map) cropYieldFactor() float64 {
+	if month := m.Month(); month >= harvestStartMonth && month <= harvestEndMonth {
+		return max(cropHarvestYield*min(m.Crops.Growth, 1)*m.Crops.Quality, seasonYield[m.Season()])
+	}
+	return seasonYield[m.Season()]
+}
+
+const (
+	coldFoodTemperature = -10.0 // Temperature at which everyone eats an extra ration
+	stormDamageChance   = 0.2   // Chance per storm that a building is damaged
+	stormDamage         = 10    // Maximum condition lost by a building in a storm
+)
+
+// coldFood returns the extra food a person needs to keep warm today.
+// The colder it is, the more likely they eat an extra ration.
+func (m *Map) coldFood() int {
+	if m.Weather.IsFreezing() && rand.Float64() < m.Weather.Temperature/coldFoodTemperature {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,378 @@
+package simsettlers
+
+import (
+	"log"
+	"math"
+	"math/rand"
+)
+
+// placementRule restricts where a building type can be placed.
+type placementRule struct {
+	MinRootDist float64 // Minimum distance to the root building
+	MaxRootDist float64 // Maximum distance to the root building (0 = no limit)
+	MinRise     float64 // Minimum elevation above the root building
+	MaxRise     float64 // Maximum elevation above the root building (0 = no limit)
+	MaxSlope    float64 // Maximum (normalized) steepness of the terrain (0 = no limit)
+	NearWater   bool    // Requires a river right next to the building
+}
+
+var buildingPlacement = map[string]placementRule{
+	BuildingTypeSmithy:     {MinRootDist: 3, MaxRootDist: 15},
+	BuildingTypeMill:       {MinRootDist: 3, NearWater: true},
+	BuildingTypeLumberCamp: {MinRootDist: 6},
+	BuildingTypeMine:       {MinRootDist: 5, MinRise: 0.01},
+	BuildingTypeTemple:     {MaxRootDist: 10},
+	BuildingTypeGuardhouse: {MaxRootDist: 12},
+	BuildingTypeFarm:       {MinRootDist: 5, MaxRootDist: 20, MaxRise: 0.02, MaxSlope: 0.3},
+	BuildingTypeWorkshop:   {MaxRootDist: 15},
+	BuildingTypeTavern:     {MaxRootDist: 8},
+	BuildingTypeWell:       {MaxRootDist: 25, MaxSlope: 0.3},
+	BuildingTypeStorehouse: {MaxRootDist: 8, MaxSlope: 0.3},
+}
+
+const (
+	fieldsPerFarmer    = 2     // Number of fields a farmer can tend to
+	maxFields          = 12    // Maximum number of fields of a farm
+	farmExpandChance   = 0.01  // Chance per day that a fully staffed farm adds a field
+	fieldAbandonChance = 0.005 // Chance per day that an unstaffed farm loses a field
+	waterRadius        = 3     // Distance within which a river provides water
+	wellRadius         = 6     // Distance within which a well provides water
+	storehouseCapacity = 500   // Food the village can store per storehouse before it needs another
+	wallPopulation     = 40    // Population at which the village builds a wall
+	wallMargin         = 2     // Distance between the outermost building and the wall
+)
+
+// fieldCost is the material required to fence in a new field.
+var fieldCost = Stockpile{ResourceWood: 1}
+
+// wallSegmentCost is the material required per wall segment.
+var wallSegmentCost = Stockpile{ResourceStone: 2}
+
+// calcFitnessScoreBuilding returns the fitness score for placing a building
+// of the given type in the settlement. Buildings are placed like houses (no
+// water, not too crowded), but each type has its own placement rules and
+// preferences.
+func (m *Map) calcFitnessScoreBuilding(s *Settlement, t string) []float64 {
+	fitness := m.calcFitnessScoreHouse(s, true)
+	rule := buildingPlacement[t]
+	steepness := m.calcSteepness()
+	normalize(steepness)
+
+	var dryHouses []*Building
+	if t == BuildingTypeWell {
+		dryHouses = m.housesWithoutWater(s)
+	}
+	for i, fit := range fitness {
+		if fit == -1 {
+			continue
+		}
+		x, y := i%m.Width, i/m.Width
+		dist := distanceToBuilding(x, y, s.Root)
+		rise := m.Elevation[i] - m.Elevation[s.Root.X+s.Root.Y*m.Width]
+		if dist < rule.MinRootDist || rule.MaxRootDist > 0 && dist > rule.MaxRootDist ||
+			rise < rule.MinRise || rule.MaxRise > 0 && rise > rule.MaxRise ||
+			rule.MaxSlope > 0 && steepness[i] > rule.MaxSlope {
+			fitness[i] = -1
+			continue
+		}
+		if rule.NearWater {
+			var flux float64
+			for _, n := range m.Neighbors(x, y) {
+				flux = max(flux, m.Flux[n])
+			}
+			if flux <= fluxRiverThreshold {
+				fitness[i] = -1
+				continue
+			}
+		}
+
+		switch t {
+		case BuildingTypeMine:
+			// Mines are dug into the mountainside.
+			fit += 2 * steepness[i]
+		case BuildingTypeLumberCamp:
+			// Woodcutters work on the outskirts.
+			fit += m.fitnessScoreMarketProximity(s, i)
+		case BuildingTypeFarm:
+			// Fields need flat land and water.
+			fit += 1 - steepness[i]
+			if m.hasWaterAccess(x, y) {
+				fit += 0.5
+			}
+		case BuildingTypeWell:
+			// Wells should supply as many houses without water as possible.
+			var supplied int
+			for _, h := range dryHouses {
+				if distanceToBuilding(x, y, h) <= wellRadius {
+					supplied++
+				}
+			}
+			if supplied == 0 {
+				fitness[i] = -1
+				continue
+			}
+			fit += float64(supplied)
+		default:
+			// Everything else belongs in the center of the village.
+			fit += 1 - m.fitnessScoreMarketProximity(s, i)
+		}
+		fitness[i] = fit
+	}
+	return fitness
+}
+
+func (m *Map) getHighestBuildingFitness(s *Settlement, t string) (int, float64) {
+	fitness := m.calcFitnessScoreBuilding(s, t)
+	best := 0
+	for i := range fitness {
+		if fitness[i] > fitness[best] {
+			best = i
+		}
+	}
+	return best, fitness[best]
+}
+
+// hasWaterAccess returns true if there is a river or a well nearby.
+func (m *Map) hasWaterAccess(x, y int) bool {
+	for dy := -waterRadius; dy <= waterRadius; dy++ {
+		for dx := -waterRadius; dx <= waterRadius; dx++ {
+			nx, ny := x+dx, y+dy
+			if nx >= 0 && nx < m.Width && ny >= 0 && ny < m.Height && m.Flux[nx+ny*m.Width] > fluxRiverThreshold {
+				return true
+			}
+		}
+	}
+	for _, b := range m.Buildings {
+		if b.Type == BuildingTypeWell && distanceToBuilding(x, y, b) <= wellRadius {
+			return true
+		}
+	}
+	return false
+}
+
+// housesWithoutWater returns all houses of the settlement that have no river
+// or well nearby.
+func (m *Map) housesWithoutWater(s *Settlement) []*Building {
+	var houses []*Building
+	for _, b := range m.Buildings {
+		if b.Type == BuildingTypeHouse && b.Settlement == s && !m.hasWaterAccess(b.X, b.Y) {
+			houses = append(houses, b)
+		}
+	}
+	return houses
+}
+
+// countBuildings returns the number of completed buildings of the given type.
+func (m *Map) countBuildings(t string) int {
+	var n int
+	for _, b := range m.Buildings {
+		if b.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+// addPlot adds the given tile to the plots of the building.
+// Any forest on the tile is cleared and the wood goes to the village.
+func (m *Map) addPlot(b *Building, i int) {
+	if m.TileType[i] == TileTypeForest {
+		m.Resources[ResourceWood] += m.harvest(i, m.Deposits[i])
+		m.TileType[i] = TileTypeNone
+	}
+	b.Plots = append(b.Plots, i)
+	m.Zones[i] = b
+}
+
+// removePlot removes the given tile from the plots of the building.
+func (m *Map) removePlot(b *Building, i int) {
+	for j, p := range b.Plots {
+		if p == i {
+			b.Plots = append(b.Plots[:j], b.Plots[j+1:]...)
+			break
+		}
+	}
+	if m.Zones[i] == b {
+		m.Zones[i] = nil
+	}
+}
+
+// bestFieldPlot returns the best free tile next to the farm to add a new
+// field (or -1 if there is none). Flat tiles close to the farm are preferred.
+func (m *Map) bestFieldPlot(b *Building) int {
+	steepness := m.calcSteepness()
+	normalize(steepness)
+	var houses []*Building
+	for _, h := range m.Buildings {
+		if h.Type == BuildingTypeHouse {
+			houses = append(houses, h)
+		}
+	}
+	best := -1
+	var bestFit float64
+	for _, t := range append([]int{b.X + b.Y*m.Width}, b.Plots...) {
+		for _, i := range m.Neighbors(t%m.Width, t/m.Width) {
+			if m.Zones[i] != nil || m.TileType[i] == TileTypeWater || m.TileType[i] == TileTypeRock {
+				continue
+			}
+			if steepness[i] > buildingPlacement[BuildingTypeFarm].MaxSlope {
+				continue
+			}
+			// Keep some distance to the houses.
+			if len(houses) > 0 && m.fitnessScoreBuildingProximity(i, houses) < 1.5 {
+				continue
+			}
+			fit := 1 - steepness[i] + 1/(1+distanceToBuilding(i%m.Width, i/m.Width, b))
+			if best == -1 || fit > bestFit {
+				best, bestFit = i, fit
+			}
+		}
+	}
+	return best
+}
+
+// expandFarms adds new fields to fully staffed farms.
+func (m *Map) expandFarms() {
+	for _, b := range m.Buildings {
+		if b.Type != BuildingTypeFarm || b.HasVacancy() || len(b.Plots) >= maxFields || rand.Float64() > farmExpandChance {
+			continue
+		}
+		i := m.bestFieldPlot(b)
+		if i == -1 || !m.Resources.Remove(fieldCost) {
+			continue
+		}
+		log.Printf("Adding a field to %v", b)
+		m.addPlot(b, i)
+	}
+}
+
+// Demolish tears down the building, evicts all occupants and workers, and
+// returns what can be salvaged of the materials to the village.
+func (m *Map) Demolish(b *Building) {
+	if m.isRoot(b) {
+		return
+	}
+	log.Printf("Demolishing %v", b)
+	for len(b.Workers) > 0 {
+		b.Workers[0].quitJob()
+	}
+	for _, p := range b.Occupants {
+		if p.Home == b {
+			p.Home = nil
+		}
+	}
+	b.Occupants = nil
+	for len(b.Owners) > 0 {
+		b.RemoveOwner(b.Owners[0])
+	}
+
+	// Salvage half of the materials (if the building is still in good shape).
+	var salvage Stockpile
+	for r, n := range buildingCosts[b.Type] {
+		salvage[r] = n * int(b.Condition) / 200
+	}
+	m.Resources.Add(salvage)
+
+	for len(b.Plots) > 0 {
+		m.removePlot(b, b.Plots[0])
+	}
+	if m.Zones[b.X+b.Y*m.Width] == b {
+		m.Zones[b.X+b.Y*m.Width] = nil
+	}
+	for i, o := range m.Buildings {
+		if o == b {
+			m.Buildings = append(m.Buildings[:i], m.Buildings[i+1:]...)
+			break
+		}
+	}
+}
+
+// constructCivicBuildings builds the buildings that are maintained by the
+// village if they are needed: wells for houses without water, storehouses
+// if the food storage overflows and a wall once a settlement is big enough.
+func (m *Map) constructCivicBuildings() {
+	// Only build one civic building at a time.
+	for _, b := range m.Construction {
+		if buildingMaintained[b.Type] {
+			return
+		}
+	}
+
+	for _, s := range m.Settlements {
+		if len(m.housesWithoutWater(s)) >= 3 && m.constructCivicBuilding(s, BuildingTypeWell) {
+			return
+		}
+		if m.Resources[ResourceFood] > storehouseCapacity*(m.countBuildings(BuildingTypeStorehouse)+1) &&
+			m.constructCivicBuilding(s, BuildingTypeStorehouse) {
+			return
+		}
+		if len(m.inhabitants(s)) >= wallPopulation && m.countBuildingsIn(s, BuildingTypeWall) == 0 {
+			m.constructWall(s)
+			return
+		}
+	}
+}
+
+// constructCivicBuilding builds a building of the given type at the best
+// location in the settlement if the village can afford it and returns true
+// on success. The village only spends its surplus, so there is enough left
+// for the workplaces.
+func (m *Map) constructCivicBuilding(s *Settlement, t string) bool {
+	reserve := buildingCosts[t]
+	reserve.Add(buildingCosts[t])
+	if !m.Resources.Has(reserve) {
+		return false
+	}
+	i, score := m.getHighestBuildingFitness(s, t)
+	if score == -1 {
+		return false
+	}
+	log.Printf("Building a %s in %s", t, s.Name)
+	m.AddBuilding(i%m.Width, i/m.Width, t).Settlement = s
+	m.Resources.Remove(buildingCosts[t])
+	return true
+}
+
+// constructWall builds a wall around the settlement, just outside of the
+// outermost house or workplace. Rivers and other buildings leave gaps.
+func (m *Map) constructWall(s *Settlement) {
+	var radius float64
+	for _, b := range m.Buildings {
+		if b.Settlement != s {
+			continue
+		}
+		switch b.Type {
+		case BuildingTypeDungeon, BuildingTypeFarm, BuildingTypeLumberCamp, BuildingTypeMine:
+			continue // These are outside the village.
+		}
+		radius = max(radius, distanceToBuilding(b.X, b.Y, s.Root))
+	}
+	radius += wallMargin
+
+	var segments []int
+	for i := range m.Zones {
+		if m.Zones[i] != nil || m.TileType[i] == TileTypeWater {
+			continue
+		}
+		if dist := distanceToBuilding(i%m.Width, i/m.Width, s.Root); math.Abs(dist-radius) < 0.5 {
+			segments = append(segments, i)
+		}
+	}
+	if len(segments) == 0 {
+		return
+	}
+
+	var cost Stockpile
+	for r, n := range wallSegmentCost {
+		cost[r] = n * len(segments)
+	}
+	if !m.Resources.Remove(cost) {
+		return
+	}
+	log.Printf("Building a wall with %d segments around %s", len(segments), s.Name)
+	w := m.AddBuilding(segments[0]%m.Width, segments[0]/m.Width, BuildingTypeWall)
+	w.Settlement = s
+	for _, i := range segments[1:] {
+		m.addPlot(w, i)
+	}
+}